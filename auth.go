@@ -1,7 +1,7 @@
 package rc
 
 import (
-	"fmt"
+	"context"
 	"os"
 	"reflect"
 	"time"
@@ -62,13 +62,15 @@ type ResumeLogin struct {
 	Token string `json:"resume"`
 }
 
+// Login authenticates Client with username and password.
 func (c *Client) Login() error {
-	resp := &LoginResponse{}
-	result := c.c.postJSON("/login", StandardLogin{c.cred.Username, c.cred.Password})
+	return c.LoginContext(context.Background())
+}
 
-	if result.StatusCode() != 200 {
-		return fmt.Errorf("Error logging in. Response: %s", string(result.Body()))
-	}
+// LoginContext is like Login but honors ctx cancellation.
+func (c *Client) LoginContext(ctx context.Context) error {
+	resp := &LoginResponse{}
+	result := c.c.postJSON(ctx, "/login", StandardLogin{c.cred.Username, c.cred.Password})
 
 	if err := result.JSON(&resp); err != nil {
 		return err
@@ -80,19 +82,41 @@ func (c *Client) Login() error {
 	c.c.setAuthHeader(data.UserID, data.Token)
 
 	if c.realtime {
-		if err := c.Resume(); err != nil {
+		if err := c.ResumeContext(ctx); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// Resume logs in to the realtime api with the current token.
 func (c *Client) Resume() error {
+	return c.ResumeContext(context.Background())
+}
+
+// ResumeContext is like Resume but honors ctx cancellation.
+func (c *Client) ResumeContext(ctx context.Context) error {
 	ld := ResumeLogin{
 		Token: c.cred.Token,
 	}
-	if err := c.d.Resume(ld); err != nil {
+	if err := c.d.Resume(ctx, ld); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Logout invalidates the auth token of Client.
+func (c *Client) Logout() error {
+	return c.LogoutContext(context.Background())
+}
+
+// LogoutContext is like Logout but honors ctx cancellation.
+func (c *Client) LogoutContext(ctx context.Context) error {
+	if err := c.c.postJSON(ctx, "/logout", nil).Error(); err != nil {
 		return err
 	}
+
+	c.cred.Token = ""
+	c.connected = false
 	return nil
 }
@@ -0,0 +1,276 @@
+package rc
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// BackpressurePolicy decides what happens when the consumer of
+// MessageStream or EventStream falls behind and the channel is full.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock waits for the consumer. A slow consumer stalls the
+	// realtime connection for every subscription.
+	BackpressureBlock BackpressurePolicy = iota
+	// BackpressureDropOldest discards the oldest buffered item to make room.
+	BackpressureDropOldest
+	// BackpressureDropNewest discards the item that does not fit.
+	BackpressureDropNewest
+	// BackpressureUnbounded queues items in memory without limit.
+	BackpressureUnbounded
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureBlock:
+		return "block"
+	case BackpressureDropOldest:
+		return "drop-oldest"
+	case BackpressureDropNewest:
+		return "drop-newest"
+	case BackpressureUnbounded:
+		return "unbounded"
+	default:
+		return "unknown"
+	}
+}
+
+// Stream names passed to the OnStreamDrop hook.
+const (
+	StreamMessages = "messages"
+	StreamEvents   = "events"
+)
+
+// StreamStats reports how MessageStream and EventStream kept up with their
+// consumer.
+type StreamStats struct {
+	MessagesDropped uint64
+	EventsDropped   uint64
+	// MessagesQueued and EventsQueued are the items waiting in the
+	// unbounded queue, beyond the channel buffer.
+	MessagesQueued int
+	EventsQueued   int
+}
+
+// MessageBackpressure sets the policy and channel buffer size of
+// MessageStream. A size of zero keeps the default buffer.
+func MessageBackpressure(p BackpressurePolicy, size int) StreamOption {
+	return func(str *streams) {
+		str.msgBP.policy = p
+		str.msgBP.size = size
+	}
+}
+
+// EventBackpressure sets the policy and channel buffer size of
+// EventStream. A size of zero keeps the default buffer.
+func EventBackpressure(p BackpressurePolicy, size int) StreamOption {
+	return func(str *streams) {
+		str.evtBP.policy = p
+		str.evtBP.size = size
+	}
+}
+
+// OnStreamDrop sets a function called every time a backpressure policy
+// drops an item, with the stream name and the number dropped so far. It is
+// called from the stream goroutine and must not block.
+func OnStreamDrop(fn func(stream string, total uint64)) StreamOption {
+	return func(str *streams) {
+		str.onDrop = fn
+	}
+}
+
+// StreamStats returns the drop counters and queue lengths of the streams.
+// It is zero without a realtime connection.
+func (c *Client) StreamStats() StreamStats {
+	if c.d == nil {
+		return StreamStats{}
+	}
+	str := c.d.streams
+	return StreamStats{
+		MessagesDropped: atomic.LoadUint64(&str.msgBP.dropped),
+		EventsDropped:   atomic.LoadUint64(&str.evtBP.dropped),
+		MessagesQueued:  str.msgBP.queue.len(),
+		EventsQueued:    str.evtBP.queue.len(),
+	}
+}
+
+// backpressure holds the policy and counters of one stream.
+type backpressure struct {
+	policy  BackpressurePolicy
+	size    int
+	dropped uint64
+	queue   queue
+}
+
+func (str *streams) drop(bp *backpressure, stream string) {
+	total := atomic.AddUint64(&bp.dropped, 1)
+	if str.onDrop != nil {
+		str.onDrop(stream, total)
+	}
+}
+
+// pushMsgs delivers msgs on allMsgs according to the message policy.
+func (str *streams) pushMsgs(s *streamSub, msgs []Message) {
+	bp := &str.msgBP
+	switch bp.policy {
+	case BackpressureDropNewest:
+		select {
+		case str.allMsgs <- msgs:
+		default:
+			str.drop(bp, StreamMessages)
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case str.allMsgs <- msgs:
+				return
+			default:
+			}
+			select {
+			case <-str.allMsgs:
+				str.drop(bp, StreamMessages)
+			default:
+			}
+		}
+	case BackpressureUnbounded:
+		str.startPump(bp, func(v interface{}) bool {
+			select {
+			case str.allMsgs <- v.([]Message):
+				return true
+			case <-str.quit:
+				return false
+			}
+		})
+		bp.queue.push(msgs)
+	default:
+		select {
+		case str.allMsgs <- msgs:
+		case <-s.stop:
+		}
+	}
+}
+
+// pushEvt delivers evt on allEvts according to the event policy.
+func (str *streams) pushEvt(s *streamSub, evt *StreamEvent) {
+	bp := &str.evtBP
+	switch bp.policy {
+	case BackpressureDropNewest:
+		select {
+		case str.allEvts <- evt:
+		default:
+			str.drop(bp, StreamEvents)
+		}
+	case BackpressureDropOldest:
+		for {
+			select {
+			case str.allEvts <- evt:
+				return
+			default:
+			}
+			select {
+			case <-str.allEvts:
+				str.drop(bp, StreamEvents)
+			default:
+			}
+		}
+	case BackpressureUnbounded:
+		str.startPump(bp, func(v interface{}) bool {
+			select {
+			case str.allEvts <- v.(*StreamEvent):
+				return true
+			case <-str.quit:
+				return false
+			}
+		})
+		bp.queue.push(evt)
+	default:
+		select {
+		case str.allEvts <- evt:
+		case <-s.stop:
+		}
+	}
+}
+
+// startPump starts the goroutine moving the unbounded queue of bp to its
+// channel, once.
+func (str *streams) startPump(bp *backpressure, send func(interface{}) bool) {
+	bp.queue.once.Do(func() {
+		if !str.enter() {
+			return
+		}
+		go func() {
+			defer str.senders.Done()
+			bp.queue.pump(send, str.quit)
+		}()
+	})
+}
+
+// queue is an unbounded fifo drained by a single pump goroutine.
+type queue struct {
+	once  sync.Once
+	mu    sync.Mutex
+	items []interface{}
+	ready chan struct{}
+}
+
+func (q *queue) push(v interface{}) {
+	q.mu.Lock()
+	q.items = append(q.items, v)
+	if q.ready == nil {
+		q.ready = make(chan struct{}, 1)
+	}
+	ready := q.ready
+	q.mu.Unlock()
+
+	select {
+	case ready <- struct{}{}:
+	default:
+	}
+}
+
+// peek returns the oldest item without removing it, so len counts the
+// item the pump is waiting to deliver.
+func (q *queue) peek() (interface{}, chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.ready == nil {
+		q.ready = make(chan struct{}, 1)
+	}
+	if len(q.items) == 0 {
+		return nil, q.ready, false
+	}
+	return q.items[0], q.ready, true
+}
+
+func (q *queue) remove() {
+	q.mu.Lock()
+	q.items[0] = nil
+	q.items = q.items[1:]
+	q.mu.Unlock()
+}
+
+func (q *queue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *queue) pump(send func(interface{}) bool, quit chan struct{}) {
+	for {
+		v, ready, ok := q.peek()
+		if !ok {
+			select {
+			case <-ready:
+				continue
+			case <-quit:
+				return
+			}
+		}
+		if !send(v) {
+			return
+		}
+		q.remove()
+	}
+}
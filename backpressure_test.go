@@ -0,0 +1,94 @@
+package rc
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestBackpressure(t *testing.T) {
+	const sent = 20
+
+	tests := []struct {
+		policy  BackpressurePolicy
+		want    []string
+		dropped uint64
+	}{
+		{BackpressureDropNewest, []string{"msg 0", "msg 1"}, sent - 2},
+		{BackpressureDropOldest, []string{"msg 18", "msg 19"}, sent - 2},
+		{BackpressureUnbounded, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			srv := rctest.NewServer()
+			defer srv.Close()
+			bot := srv.AddUser("bot", "secret")
+
+			var hooked uint64
+			client := New(
+				ServerURL(srv.URL),
+				AccessToken(bot.ID, bot.Token),
+				StreamOptions(
+					RoomSubscription(rctest.GeneralID),
+					MessageBackpressure(tt.policy, 2),
+					OnStreamDrop(func(stream string, total uint64) {
+						if stream == StreamMessages {
+							atomic.StoreUint64(&hooked, total)
+						}
+					}),
+				),
+			)
+			if err := client.Connect(); err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close(context.Background())
+
+			want := tt.want
+			for i := 0; i < sent; i++ {
+				text := fmt.Sprintf("msg %d", i)
+				srv.PostMessage(rctest.GeneralID, "bot", text)
+				if tt.want == nil {
+					want = append(want, text)
+				}
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for {
+				st := client.StreamStats()
+				if st.MessagesDropped == tt.dropped && st.MessagesQueued+len(client.MessageStream()) == len(want) {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("stats = %+v with %d buffered", st, len(client.MessageStream()))
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			if got := atomic.LoadUint64(&hooked); got != tt.dropped {
+				t.Errorf("OnStreamDrop saw %d drops, want %d", got, tt.dropped)
+			}
+
+			for _, w := range want {
+				select {
+				case msgs := <-client.MessageStream():
+					if msgs[0].Text != w {
+						t.Fatalf("got %q, want %q", msgs[0].Text, w)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("timed out waiting for %q", w)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamStatsWithoutRealtime(t *testing.T) {
+	c := New(ServerURL("http://localhost:3000"))
+	if got := c.StreamStats(); got != (StreamStats{}) {
+		t.Errorf("StreamStats() = %+v", got)
+	}
+}
@@ -1,6 +1,7 @@
 package rc
 
 import (
+	"context"
 	"net/url"
 	"strconv"
 	"time"
@@ -8,23 +9,26 @@ import (
 
 type ChannelList struct {
 	Channels []Channel `json:"channels"`
-	Offset   int64     `json:"offset"`
-	Count    int64     `json:"count"`
-	Total    int64     `json:"total"`
-	Success  bool      `json:"success"`
+	Pagination
+	Success bool `json:"success"`
 }
 
 type Channel struct {
-	ID        string      `json:"_id"`
-	Name      string      `json:"name"`
-	Type      string      `json:"t"`
-	Usernames []string    `json:"usernames"`
-	Msgs      int64       `json:"msgs"`
-	User      ChannelUser `json:"u"`
-	Timestamp string      `json:"ts"`
-	ReadOnly  bool        `json:"ro"`
-	SysMes    bool        `json:"sysMes"`
-	UpdatedAt string      `json:"_updatedAt"`
+	ID               string      `json:"_id"`
+	Name             string      `json:"name"`
+	Type             string      `json:"t"`
+	Usernames        []string    `json:"usernames"`
+	Msgs             int64       `json:"msgs"`
+	User             ChannelUser `json:"u"`
+	Timestamp        string      `json:"ts"`
+	ReadOnly         bool        `json:"ro"`
+	SysMes           bool        `json:"sysMes"`
+	UpdatedAt        string      `json:"_updatedAt"`
+	Topic            string      `json:"topic,omitempty"`
+	Description      string      `json:"description,omitempty"`
+	Announcement     string      `json:"announcement,omitempty"`
+	Archived         bool        `json:"archived,omitempty"`
+	JoinCodeRequired bool        `json:"joinCodeRequired,omitempty"`
 }
 
 type ChannelUser struct {
@@ -50,19 +54,8 @@ type ChannelInfo struct {
 }
 
 type ChannelHistory struct {
-	Messages []ChannelMessage `json:"messages"`
-	Success  bool             `json:"success"`
-}
-
-type ChannelMessage struct {
-	ID          string      `json:"_id"`
-	RoomID      string      `json:"rid"`
-	Msg         string      `json:"msg"`
-	Timestamp   string      `json:"ts"`
-	User        ChannelUser `json:"u"`
-	UpdatedAt   string      `json:"_updatedAt"`
-	ChannelType *string     `json:"t,omitempty"`
-	Groupable   *bool       `json:"groupable,omitempty"`
+	Messages []Message `json:"messages"`
+	Success  bool      `json:"success"`
 }
 
 type ChannelCounters struct {
@@ -78,17 +71,16 @@ type ChannelCounters struct {
 
 type ChannelMembers struct {
 	Members []ChannelMember `json:"members"`
-	Count   int64           `json:"count"`
-	Offset  int64           `json:"offset"`
-	Total   int64           `json:"total"`
-	Success bool            `json:"success"`
+	Pagination
+	Success bool `json:"success"`
 }
 
 type ChannelMember struct {
-	ID       string `json:"_id"`
-	Username string `json:"username"`
-	Name     string `json:"name"`
-	Status   string `json:"status"`
+	ID        string  `json:"_id"`
+	Username  string  `json:"username"`
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	UtcOffset float64 `json:"utcOffset,omitempty"`
 }
 
 type ChannelOnline struct {
@@ -109,8 +101,12 @@ type ChannelRole struct {
 }
 
 func (c *Client) GetChannelList() (*ChannelList, error) {
+	return c.GetChannelListContext(context.Background())
+}
+
+func (c *Client) GetChannelListContext(ctx context.Context) (*ChannelList, error) {
 	chlist := &ChannelList{}
-	if err := c.c.get("/channels.list", nil).JSON(chlist); err != nil {
+	if err := c.c.get(ctx, "/channels.list", nil).JSON(chlist); err != nil {
 		return nil, err
 	}
 
@@ -118,9 +114,13 @@ func (c *Client) GetChannelList() (*ChannelList, error) {
 }
 
 func (c *Client) GetChannelInfo(roomID string) (*ChannelInfo, error) {
+	return c.GetChannelInfoContext(context.Background(), roomID)
+}
+
+func (c *Client) GetChannelInfoContext(ctx context.Context, roomID string) (*ChannelInfo, error) {
 	chinfo := &ChannelInfoEnv{}
 	q := query("roomId", roomID)
-	if err := c.c.get("/channels.info", q.Q()).JSON(chinfo); err != nil {
+	if err := c.c.get(ctx, "/channels.info", q.Q()).JSON(chinfo); err != nil {
 		return nil, err
 	}
 
@@ -129,9 +129,13 @@ func (c *Client) GetChannelInfo(roomID string) (*ChannelInfo, error) {
 }
 
 func (c *Client) GetChannelCounters(roomID string) (*ChannelCounters, error) {
+	return c.GetChannelCountersContext(context.Background(), roomID)
+}
+
+func (c *Client) GetChannelCountersContext(ctx context.Context, roomID string) (*ChannelCounters, error) {
 	chcounters := &ChannelCounters{}
 	q := query("roomId", roomID)
-	if err := c.c.get("/channels.counters", q.Q()).JSON(chcounters); err != nil {
+	if err := c.c.get(ctx, "/channels.counters", q.Q()).JSON(chcounters); err != nil {
 		return nil, err
 	}
 
@@ -139,9 +143,13 @@ func (c *Client) GetChannelCounters(roomID string) (*ChannelCounters, error) {
 }
 
 func (c *Client) GetChannelMembers(roomID string) (*ChannelMembers, error) {
+	return c.GetChannelMembersContext(context.Background(), roomID)
+}
+
+func (c *Client) GetChannelMembersContext(ctx context.Context, roomID string) (*ChannelMembers, error) {
 	chmembers := &ChannelMembers{}
 	q := query("roomId", roomID)
-	if err := c.c.get("/channels.members", q.Q()).JSON(chmembers); err != nil {
+	if err := c.c.get(ctx, "/channels.members", q.Q()).JSON(chmembers); err != nil {
 		return nil, err
 	}
 
@@ -149,13 +157,17 @@ func (c *Client) GetChannelMembers(roomID string) (*ChannelMembers, error) {
 }
 
 func (c *Client) GetChannelOnline(roomID string) ([]ChannelUser, error) {
+	return c.GetChannelOnlineContext(context.Background(), roomID)
+}
+
+func (c *Client) GetChannelOnlineContext(ctx context.Context, roomID string) ([]ChannelUser, error) {
 	chonline := &ChannelOnline{}
 	vals := url.Values{}
 	if roomID != "*" && roomID != "" {
 		vals = query("_id", roomID).Q()
 	}
 
-	if err := c.c.get("/channels.online", vals).JSON(chonline); err != nil {
+	if err := c.c.get(ctx, "/channels.online", vals).JSON(chonline); err != nil {
 		return nil, err
 	}
 
@@ -164,9 +176,13 @@ func (c *Client) GetChannelOnline(roomID string) ([]ChannelUser, error) {
 }
 
 func (c *Client) GetChannelRoles(roomID string) ([]ChannelRole, error) {
+	return c.GetChannelRolesContext(context.Background(), roomID)
+}
+
+func (c *Client) GetChannelRolesContext(ctx context.Context, roomID string) ([]ChannelRole, error) {
 	chroles := &ChannelRoles{}
 	q := query("roomId", roomID)
-	if err := c.c.get("/channels.roles", q.Q()).JSON(chroles); err != nil {
+	if err := c.c.get(ctx, "/channels.roles", q.Q()).JSON(chroles); err != nil {
 		return nil, err
 	}
 
@@ -174,15 +190,252 @@ func (c *Client) GetChannelRoles(roomID string) ([]ChannelRole, error) {
 	return r, nil
 }
 
+// GetChannelFiles returns a page of the files uploaded to a public channel,
+// newest first. q may be nil.
+func (c *Client) GetChannelFiles(roomID string, q *Query) (*FileList, error) {
+	return c.GetChannelFilesContext(context.Background(), roomID, q)
+}
+
+func (c *Client) GetChannelFilesContext(ctx context.Context, roomID string, q *Query) (*FileList, error) {
+	return c.roomFiles(ctx, "/channels.files", roomID, q)
+}
+
 func (c *Client) GetChannelHistory(q HistoryQuery) (*ChannelHistory, error) {
+	return c.GetChannelHistoryContext(context.Background(), q)
+}
+
+func (c *Client) GetChannelHistoryContext(ctx context.Context, q HistoryQuery) (*ChannelHistory, error) {
 	chhistory := &ChannelHistory{}
-	if err := c.c.get("/channels.history", q.Q()).JSON(chhistory); err != nil {
+	if err := c.c.get(ctx, "/channels.history", q.Q()).JSON(chhistory); err != nil {
 		return nil, err
 	}
 
 	return chhistory, nil
 }
 
+type channelEnv struct {
+	Channel Channel `json:"channel"`
+	Success bool    `json:"success"`
+}
+
+// CreateChannel creates a public channel owned by the logged in user.
+func (c *Client) CreateChannel(name string, opts ...RoomCreateOption) (*Channel, error) {
+	return c.CreateChannelContext(context.Background(), name, opts...)
+}
+
+func (c *Client) CreateChannelContext(ctx context.Context, name string, opts ...RoomCreateOption) (*Channel, error) {
+	env := &channelEnv{}
+	if err := c.c.postStatus(ctx, "/channels.create", newRoomCreate(name, opts), env); err != nil {
+		return nil, err
+	}
+
+	ch := env.Channel
+	return &ch, nil
+}
+
+// DeleteChannel deletes a channel and its messages.
+func (c *Client) DeleteChannel(roomID string) error {
+	return c.DeleteChannelContext(context.Background(), roomID)
+}
+
+func (c *Client) DeleteChannelContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/channels.delete", req, nil)
+}
+
+// ArchiveChannel archives a channel, making it read only for everyone.
+func (c *Client) ArchiveChannel(roomID string) error {
+	return c.ArchiveChannelContext(context.Background(), roomID)
+}
+
+func (c *Client) ArchiveChannelContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/channels.archive", req, nil)
+}
+
+// UnarchiveChannel restores an archived channel.
+func (c *Client) UnarchiveChannel(roomID string) error {
+	return c.UnarchiveChannelContext(context.Background(), roomID)
+}
+
+func (c *Client) UnarchiveChannelContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/channels.unarchive", req, nil)
+}
+
+// RenameChannel changes the name of a channel.
+func (c *Client) RenameChannel(roomID, name string) error {
+	return c.RenameChannelContext(context.Background(), roomID, name)
+}
+
+func (c *Client) RenameChannelContext(ctx context.Context, roomID, name string) error {
+	req := map[string]string{"roomId": roomID, "name": name}
+	return c.c.postStatus(ctx, "/channels.rename", req, nil)
+}
+
+// SetChannelTopic sets the topic shown in the channel header.
+func (c *Client) SetChannelTopic(roomID, topic string) error {
+	return c.SetChannelTopicContext(context.Background(), roomID, topic)
+}
+
+func (c *Client) SetChannelTopicContext(ctx context.Context, roomID, topic string) error {
+	req := map[string]string{"roomId": roomID, "topic": topic}
+	return c.c.postStatus(ctx, "/channels.setTopic", req, nil)
+}
+
+// SetChannelPurpose sets the purpose of a channel. Newer servers store
+// it as the description.
+func (c *Client) SetChannelPurpose(roomID, purpose string) error {
+	return c.SetChannelPurposeContext(context.Background(), roomID, purpose)
+}
+
+func (c *Client) SetChannelPurposeContext(ctx context.Context, roomID, purpose string) error {
+	req := map[string]string{"roomId": roomID, "purpose": purpose}
+	return c.c.postStatus(ctx, "/channels.setPurpose", req, nil)
+}
+
+// SetChannelDescription sets the description of a channel.
+func (c *Client) SetChannelDescription(roomID, description string) error {
+	return c.SetChannelDescriptionContext(context.Background(), roomID, description)
+}
+
+func (c *Client) SetChannelDescriptionContext(ctx context.Context, roomID, description string) error {
+	req := map[string]string{"roomId": roomID, "description": description}
+	return c.c.postStatus(ctx, "/channels.setDescription", req, nil)
+}
+
+// SetChannelAnnouncement sets the announcement banner of a channel.
+func (c *Client) SetChannelAnnouncement(roomID, announcement string) error {
+	return c.SetChannelAnnouncementContext(context.Background(), roomID, announcement)
+}
+
+func (c *Client) SetChannelAnnouncementContext(ctx context.Context, roomID, announcement string) error {
+	req := map[string]string{"roomId": roomID, "announcement": announcement}
+	return c.c.postStatus(ctx, "/channels.setAnnouncement", req, nil)
+}
+
+// SetChannelReadOnly sets whether only owners and moderators can post.
+func (c *Client) SetChannelReadOnly(roomID string, readOnly bool) error {
+	return c.SetChannelReadOnlyContext(context.Background(), roomID, readOnly)
+}
+
+func (c *Client) SetChannelReadOnlyContext(ctx context.Context, roomID string, readOnly bool) error {
+	req := map[string]interface{}{"roomId": roomID, "readOnly": readOnly}
+	return c.c.postStatus(ctx, "/channels.setReadOnly", req, nil)
+}
+
+// SetChannelType converts a channel to RoomTypeChannel or RoomTypeGroup.
+func (c *Client) SetChannelType(roomID, roomType string) error {
+	return c.SetChannelTypeContext(context.Background(), roomID, roomType)
+}
+
+func (c *Client) SetChannelTypeContext(ctx context.Context, roomID, roomType string) error {
+	req := map[string]string{"roomId": roomID, "type": roomType}
+	return c.c.postStatus(ctx, "/channels.setType", req, nil)
+}
+
+// SetChannelJoinCode sets the code required to join a channel. An empty
+// code removes it.
+func (c *Client) SetChannelJoinCode(roomID, joinCode string) error {
+	return c.SetChannelJoinCodeContext(context.Background(), roomID, joinCode)
+}
+
+func (c *Client) SetChannelJoinCodeContext(ctx context.Context, roomID, joinCode string) error {
+	req := map[string]string{"roomId": roomID, "joinCode": joinCode}
+	return c.c.postStatus(ctx, "/channels.setJoinCode", req, nil)
+}
+
+// InviteToChannel adds a user to a channel.
+func (c *Client) InviteToChannel(roomID, userID string) error {
+	return c.InviteToChannelContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) InviteToChannelContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/channels.invite", req, nil)
+}
+
+// KickFromChannel removes a user from a channel.
+func (c *Client) KickFromChannel(roomID, userID string) error {
+	return c.KickFromChannelContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) KickFromChannelContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/channels.kick", req, nil)
+}
+
+// JoinChannel adds the logged in user to a channel. joinCode may be
+// empty for channels without one.
+func (c *Client) JoinChannel(roomID, joinCode string) error {
+	return c.JoinChannelContext(context.Background(), roomID, joinCode)
+}
+
+func (c *Client) JoinChannelContext(ctx context.Context, roomID, joinCode string) error {
+	req := map[string]string{"roomId": roomID, "joinCode": joinCode}
+	return c.c.postStatus(ctx, "/channels.join", req, nil)
+}
+
+// LeaveChannel removes the logged in user from a channel.
+func (c *Client) LeaveChannel(roomID string) error {
+	return c.LeaveChannelContext(context.Background(), roomID)
+}
+
+func (c *Client) LeaveChannelContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/channels.leave", req, nil)
+}
+
+// AddChannelOwner gives a member the owner role.
+func (c *Client) AddChannelOwner(roomID, userID string) error {
+	return c.AddChannelOwnerContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) AddChannelOwnerContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/channels.addOwner", req, nil)
+}
+
+// RemoveChannelOwner takes the owner role from a member.
+func (c *Client) RemoveChannelOwner(roomID, userID string) error {
+	return c.RemoveChannelOwnerContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) RemoveChannelOwnerContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/channels.removeOwner", req, nil)
+}
+
+// AddChannelModerator gives a member the moderator role.
+func (c *Client) AddChannelModerator(roomID, userID string) error {
+	return c.AddChannelModeratorContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) AddChannelModeratorContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/channels.addModerator", req, nil)
+}
+
+// RemoveChannelModerator takes the moderator role from a member.
+func (c *Client) RemoveChannelModerator(roomID, userID string) error {
+	return c.RemoveChannelModeratorContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) RemoveChannelModeratorContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/channels.removeModerator", req, nil)
+}
+
+// AddChannelLeader gives a member the leader role.
+func (c *Client) AddChannelLeader(roomID, userID string) error {
+	return c.AddChannelLeaderContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) AddChannelLeaderContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/channels.addLeader", req, nil)
+}
+
 type HistoryQuery struct {
 	RoomID         string
 	Latest         *time.Time
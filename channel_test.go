@@ -5,6 +5,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/blushft/rc/rctest"
 )
 
 func TestHistoryQueryOptions_Q(t *testing.T) {
@@ -42,3 +44,87 @@ func TestHistoryQueryOptions_Q(t *testing.T) {
 		})
 	}
 }
+
+func TestChannelAdmin(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	alice := srv.AddUser("alice", "secret")
+	srv.AddUser("bob", "secret")
+
+	client := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	as := New(ServerURL(srv.URL), AccessToken(alice.ID, alice.Token))
+	for _, c := range []*Client{client, as} {
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ch, err := client.CreateChannel("ops", RoomMembers("bob"), RoomReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ch.Name != "ops" || !ch.ReadOnly || len(ch.Usernames) != 2 {
+		t.Errorf("created %+v", ch)
+	}
+	if _, err := client.CreateChannel("ops"); !IsBadRequest(err) {
+		t.Errorf("duplicate create: err = %v", err)
+	}
+
+	steps := []struct {
+		name string
+		fn   func() error
+	}{
+		{"rename", func() error { return client.RenameChannel(ch.ID, "operations") }},
+		{"topic", func() error { return client.SetChannelTopic(ch.ID, "incidents") }},
+		{"purpose", func() error { return client.SetChannelPurpose(ch.ID, "on call") }},
+		{"announcement", func() error { return client.SetChannelAnnouncement(ch.ID, "freeze") }},
+		{"read only", func() error { return client.SetChannelReadOnly(ch.ID, false) }},
+		{"join code", func() error { return client.SetChannelJoinCode(ch.ID, "1234") }},
+		{"join", func() error { return as.JoinChannel(ch.ID, "1234") }},
+		{"moderator", func() error { return client.AddChannelModerator(ch.ID, alice.ID) }},
+		{"leader", func() error { return client.AddChannelLeader(ch.ID, alice.ID) }},
+		{"owner", func() error { return client.AddChannelOwner(ch.ID, alice.ID) }},
+		{"remove owner", func() error { return client.RemoveChannelOwner(ch.ID, bot.ID) }},
+		{"archive", func() error { return client.ArchiveChannel(ch.ID) }},
+	}
+	for _, step := range steps {
+		if err := step.fn(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+	}
+
+	r, _ := srv.Room(ch.ID)
+	if r.Name != "operations" || r.Topic != "incidents" || r.Description != "on call" || r.Announcement != "freeze" || r.ReadOnly || !r.Archived {
+		t.Errorf("room = %+v", r)
+	}
+	if roles := r.Roles[alice.ID]; !reflect.DeepEqual(roles, []string{"moderator", "leader", "owner"}) {
+		t.Errorf("alice roles = %v", roles)
+	}
+
+	if err := as.LeaveChannel(ch.ID); err == nil {
+		t.Error("last owner left")
+	} else if apiErr, _ := AsAPIError(err); apiErr.ErrorType != "error-you-are-last-owner" {
+		t.Errorf("leave: err = %v", err)
+	}
+
+	if err := client.KickFromChannel(ch.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.KickFromChannel(ch.ID, alice.ID); !IsBadRequest(err) {
+		t.Errorf("kicking a non member: err = %v", err)
+	}
+	if err := client.InviteToChannel(ch.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SetChannelType(ch.ID, RoomTypeGroup); err != nil {
+		t.Fatal(err)
+	}
+	if r, _ := srv.Room(ch.ID); r.Type != rctest.Group || len(r.Members) != 3 {
+		t.Errorf("room = %+v", r)
+	}
+	if err := client.DeleteChannel(ch.ID); !IsBadRequest(err) {
+		t.Errorf("deleting a group as a channel: err = %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package rc
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blushft/rc/internal/ddp"
+)
+
+// ConnectionState is the state of the realtime connection.
+type ConnectionState int
+
+const (
+	StateDisconnected ConnectionState = iota
+	StateConnecting
+	StateConnected
+)
+
+func (s ConnectionState) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	default:
+		return "unknown"
+	}
+}
+
+// DefaultStateBuffer is the capacity of the ConnectionStates channel. When
+// it is full the oldest state is dropped.
+var DefaultStateBuffer = 16
+
+// DefaultGapFillTimeout bounds how long a restored connection waits for the
+// messages missed while it was down before reporting StateConnected.
+var DefaultGapFillTimeout = 30 * time.Second
+
+// ReconnectBackoff sets the delay before the first attempt to restore a
+// lost realtime connection and the maximum delay it grows to between
+// failed attempts.
+func ReconnectBackoff(min, max time.Duration) ClientOption {
+	return func(c *Client) {
+		c.minBackoff = min
+		c.maxBackoff = max
+	}
+}
+
+// ConnectionStates returns a channel that receives every change of the
+// realtime connection state. After a lost connection is restored the
+// login is resumed, subscriptions are restored and missed room messages are
+// delivered on MessageStream before StateConnected is sent, waiting at most
+// DefaultGapFillTimeout. It returns nil without a realtime connection.
+func (c *Client) ConnectionStates() <-chan ConnectionState {
+	if c.d == nil {
+		return nil
+	}
+	return c.d.conn.states
+}
+
+// connState tracks the realtime session so it can be restored after a
+// reconnect.
+type connState struct {
+	mu     sync.Mutex
+	login  *ResumeLogin
+	closed bool
+
+	// connects counts the connections made. changed is replaced when it
+	// grows and closed to wake waitConnected.
+	connects int
+	changed  chan struct{}
+
+	states chan ConnectionState
+}
+
+func newConnState() *connState {
+	return &connState{
+		changed: make(chan struct{}),
+		states:  make(chan ConnectionState, DefaultStateBuffer),
+	}
+}
+
+// connected records a new connection and wakes waitConnected.
+func (cs *connState) connected() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.closed {
+		return
+	}
+	cs.connects++
+	close(cs.changed)
+	cs.changed = make(chan struct{})
+}
+
+// connections returns the number of connections made.
+func (cs *connState) connections() int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.connects
+}
+
+func (cs *connState) setLogin(ld *ResumeLogin) {
+	cs.mu.Lock()
+	cs.login = ld
+	cs.mu.Unlock()
+}
+
+// publish sends s without blocking, dropping the oldest state if needed.
+func (cs *connState) publish(s ConnectionState) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.closed {
+		return
+	}
+
+	for {
+		select {
+		case cs.states <- s:
+			return
+		default:
+		}
+		select {
+		case <-cs.states:
+		default:
+		}
+	}
+}
+
+func (cs *connState) close() {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if !cs.closed {
+		cs.closed = true
+		close(cs.states)
+		close(cs.changed)
+	}
+}
+
+// waitConnected blocks until more than after connections were made,
+// Client is closed or ctx is done.
+func (d *ddpClient) waitConnected(ctx context.Context, after int) error {
+	for {
+		d.conn.mu.Lock()
+		closed, connects, changed := d.conn.closed, d.conn.connects, d.conn.changed
+		d.conn.mu.Unlock()
+
+		switch {
+		case closed:
+			return ErrClosed
+		case connects > after:
+			return nil
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// relogin resumes the login on a restored connection before the ddp client
+// resends the subscriptions.
+func (d *ddpClient) relogin(ctx context.Context) error {
+	d.conn.mu.Lock()
+	ld := d.conn.login
+	d.conn.mu.Unlock()
+
+	if ld == nil {
+		return nil
+	}
+	_, err := d.call(ctx, "login", *ld)
+	return err
+}
+
+// statusQueue hands status changes from the ddp read goroutine to
+// watchStatus without blocking either of them.
+type statusQueue struct {
+	mu       sync.Mutex
+	statuses []int
+	notify   chan struct{}
+}
+
+func newStatusQueue() *statusQueue {
+	return &statusQueue{notify: make(chan struct{}, 1)}
+}
+
+func (q *statusQueue) push(status int) {
+	q.mu.Lock()
+	q.statuses = append(q.statuses, status)
+	q.mu.Unlock()
+
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *statusQueue) take() []int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	s := q.statuses
+	q.statuses = nil
+	return s
+}
+
+// Status implements ddp.StatusListener. It runs on the ddp read goroutine,
+// so it only records the gaps in the room subscriptions and leaves the
+// rest to watchStatus.
+func (d *ddpClient) Status(status int) {
+	if status == ddp.DISCONNECTED {
+		d.streams.markGaps()
+	}
+	d.statuses.push(status)
+}
+
+// watchStatus follows the status changes of the ddp client until ctx is
+// done. Once a lost connection is restored it fills the gaps before it
+// reports StateConnected.
+func (d *ddpClient) watchStatus(ctx context.Context) {
+	defer d.wg.Done()
+
+	reconnect := false
+	for {
+		select {
+		case <-d.statuses.notify:
+		case <-ctx.Done():
+			return
+		}
+
+		for _, status := range d.statuses.take() {
+			switch status {
+			case ddp.DISCONNECTED:
+				d.log.Debugw("realtime connection lost")
+				d.conn.publish(StateDisconnected)
+			case ddp.DIALING:
+				d.conn.publish(StateConnecting)
+			case ddp.CONNECTED:
+				if reconnect {
+					d.log.Debugw("realtime connection restored")
+					fillCtx, cancel := context.WithTimeout(ctx, DefaultGapFillTimeout)
+					d.fillGaps(fillCtx)
+					cancel()
+				}
+				reconnect = true
+				d.conn.connected()
+				d.conn.publish(StateConnected)
+			}
+		}
+	}
+}
+
+// fillGaps delivers the messages posted to subscribed rooms while the
+// connection was down.
+func (d *ddpClient) fillGaps(ctx context.Context) {
+	disconnects := atomic.LoadUint64(&d.streams.disconnects)
+	for _, s := range d.streams.roomSubs() {
+		since := s.gapStart(disconnects)
+		if since.IsZero() {
+			continue
+		}
+
+		// The server returns messages strictly newer than the timestamp.
+		// Start a millisecond earlier so messages posted in the same
+		// millisecond are kept; accept drops the ones already delivered.
+		res, err := d.call(ctx, "loadMissedMessages", s.room, map[string]int64{"$date": millis(since) - 1})
+		if err != nil {
+			d.streams.forwardErr(s, err)
+			continue
+		}
+
+		msgs, err := decodeRoomMessages(res)
+		if err != nil {
+			d.streams.forwardErr(s, err)
+			continue
+		}
+		sort.Slice(msgs, func(i, j int) bool {
+			return msgs[i].Timestamp.Before(msgs[j].Timestamp.Time)
+		})
+
+		d.streams.forwardMsgs(s, msgs)
+	}
+}
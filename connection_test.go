@@ -0,0 +1,371 @@
+package rc
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestReconnect(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	srv.AddUser("alice", "secret")
+
+	client := New(
+		ServerURL(srv.URL),
+		AccessToken(bot.ID, bot.Token),
+		ReconnectBackoff(100*time.Millisecond, time.Second),
+		StreamOptions(RoomSubscription(rctest.GeneralID)),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	waitState := func(want ConnectionState) {
+		t.Helper()
+		for {
+			select {
+			case s := <-client.ConnectionStates():
+				if s == want {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %v", want)
+			}
+		}
+	}
+	waitMsg := func(want string) {
+		t.Helper()
+		select {
+		case msgs := <-client.MessageStream():
+			if len(msgs) != 1 || msgs[0].Text != want {
+				t.Fatalf("got %+v, want %q", msgs, want)
+			}
+		case err := <-client.StreamErrors():
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	waitState(StateConnected)
+	srv.PostMessage(rctest.GeneralID, "alice", "before")
+	waitMsg("before")
+
+	srv.DropConnections()
+	srv.PostMessage(rctest.GeneralID, "alice", "while down")
+
+	waitState(StateDisconnected)
+	waitState(StateConnected)
+	waitMsg("while down")
+
+	srv.PostMessage(rctest.GeneralID, "alice", "after")
+	waitMsg("after")
+
+	select {
+	case msgs := <-client.MessageStream():
+		t.Errorf("unexpected messages %+v", msgs)
+	default:
+	}
+}
+
+func TestGapFillTimeout(t *testing.T) {
+	defer func(d time.Duration) { DefaultGapFillTimeout = d }(DefaultGapFillTimeout)
+	DefaultGapFillTimeout = 100 * time.Millisecond
+
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	// The server never answers while the client waits.
+	release := make(chan struct{})
+	defer close(release)
+	srv.HandleMethod("loadMissedMessages", func(userID string, params []interface{}) (interface{}, error) {
+		<-release
+		return []interface{}{}, nil
+	})
+
+	bot := srv.AddUser("bot", "secret")
+	client := New(
+		ServerURL(srv.URL),
+		AccessToken(bot.ID, bot.Token),
+		ReconnectBackoff(10*time.Millisecond, 10*time.Millisecond),
+		StreamOptions(RoomSubscription(rctest.GeneralID)),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	waitState := func(want ConnectionState) {
+		t.Helper()
+		for {
+			select {
+			case s := <-client.ConnectionStates():
+				if s == want {
+					return
+				}
+			case <-client.StreamErrors():
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %v", want)
+			}
+		}
+	}
+
+	waitState(StateConnected)
+	srv.PostMessage(rctest.GeneralID, "bot", "before")
+	select {
+	case <-client.MessageStream():
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	srv.DropConnections()
+	waitState(StateDisconnected)
+	waitState(StateConnected)
+}
+
+// frameFunc is a FrameRecorder calling a function.
+type frameFunc func(outgoing bool, frame []byte)
+
+func (f frameFunc) RecordFrame(outgoing bool, frame []byte) { f(outgoing, frame) }
+
+func TestDropWhileSubscribing(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	dev := srv.AddChannel("dev", "bot")
+	release := srv.HoldSubscriptions(dev.ID)
+	defer release()
+
+	sent := make(chan struct{}, 1)
+	client := New(
+		ServerURL(srv.URL),
+		AccessToken(bot.ID, bot.Token),
+		ReconnectBackoff(10*time.Millisecond, 10*time.Millisecond),
+		RecordFrames(frameFunc(func(outgoing bool, frame []byte) {
+			if outgoing && strings.Contains(string(frame), `"sub"`) && strings.Contains(string(frame), dev.ID) {
+				select {
+				case sent <- struct{}{}:
+				default:
+				}
+			}
+		})),
+		StreamOptions(RoomSubscription(rctest.GeneralID)),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	waitState := func(want ConnectionState) {
+		t.Helper()
+		for {
+			select {
+			case s := <-client.ConnectionStates():
+				if s == want {
+					return
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for %v", want)
+			}
+		}
+	}
+
+	waitState(StateConnected)
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- client.SubscribeRoom(dev.ID) }()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the subscription")
+	}
+
+	// The connection must be restored while the subscription is pending.
+	srv.DropConnections()
+	waitState(StateDisconnected)
+	waitState(StateConnected)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.SubscribeEventContext(ctx, SubNotifyLogged, NotifyUserStatus); err != nil {
+		t.Fatalf("SubscribeEvent during a pending subscription: %v", err)
+	}
+
+	release()
+	select {
+	case err := <-subscribed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SubscribeRoom did not return")
+	}
+
+	srv.PostMessage(dev.ID, "bot", "hello")
+	select {
+	case msgs := <-client.MessageStream():
+		if len(msgs) != 1 || msgs[0].Text != "hello" {
+			t.Errorf("got %+v", msgs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the message")
+	}
+}
+
+func TestConnectionStatesWithoutRealtime(t *testing.T) {
+	if ch := New(ServerURL("http://localhost:3000")).ConnectionStates(); ch != nil {
+		t.Errorf("ConnectionStates() = %v, want nil", ch)
+	}
+}
+
+func TestClose(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	dev := srv.AddChannel("dev", "bot")
+
+	verify := checkLeaks(t)
+
+	client := New(
+		ServerURL(srv.URL),
+		Credentials(bot.Username, bot.Password),
+		LogoutOnClose(true),
+		ReconnectBackoff(10*time.Millisecond, 10*time.Millisecond),
+		StreamOptions(
+			RoomSubscription(rctest.GeneralID),
+			EventSubscription(SubNotifyLogged, NotifyUserStatus),
+		),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SubscribeRoom(dev.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave a reconnect in flight and undelivered messages behind.
+	srv.PostMessage(dev.ID, "bot", "unread")
+	srv.DropConnections()
+
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, ch := range []interface{}{client.MessageStream(), client.EventStream(), client.StreamErrors(), client.ConnectionStates()} {
+		if !drained(ch) {
+			t.Errorf("%T not closed", ch)
+		}
+	}
+	if err := client.SubscribeRoom(dev.ID); err != ErrClosed {
+		t.Errorf("SubscribeRoom after Close = %v, want ErrClosed", err)
+	}
+
+	verify()
+
+	check := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	if err := check.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := check.GetUsers(); !IsUnauthorized(err) {
+		t.Errorf("token still valid after logout: %v", err)
+	}
+}
+
+func TestCloseContext(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+
+	verify := checkLeaks(t)
+
+	client := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token), StreamOptions())
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A stream handler that does not return keeps the streams from
+	// draining.
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	var once sync.Once
+	_, err := client.d.streams.watch(context.Background(), SubNotifyLogged, NotifyUserStatus, "", func(*StreamEvent) {
+		once.Do(func() { close(entered) })
+		<-release
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.SetStatus("bot", StatusAway)
+	select {
+	case <-entered:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the event")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	closed := make(chan error, 1)
+	go func() { closed <- client.Close(ctx) }()
+	select {
+	case err := <-closed:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Close() = %v, want DeadlineExceeded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close ignored its context")
+	}
+
+	// The shutdown finishes once the handler returns.
+	close(release)
+	if !drained(client.ConnectionStates()) {
+		t.Error("ConnectionStates not closed")
+	}
+	verify()
+}
+
+// drained reads ch until it is closed, reporting false if that takes long.
+func drained(ch interface{}) bool {
+	timeout := time.After(time.Second)
+	for {
+		var ok bool
+		switch c := ch.(type) {
+		case <-chan []Message:
+			select {
+			case _, ok = <-c:
+			case <-timeout:
+				return false
+			}
+		case <-chan *StreamEvent:
+			select {
+			case _, ok = <-c:
+			case <-timeout:
+				return false
+			}
+		case <-chan error:
+			select {
+			case _, ok = <-c:
+			case <-timeout:
+				return false
+			}
+		case <-chan ConnectionState:
+			select {
+			case _, ok = <-c:
+			case <-timeout:
+				return false
+			}
+		}
+		if !ok {
+			return true
+		}
+	}
+}
@@ -7,8 +7,9 @@ type Pagination struct {
 }
 
 type Status struct {
-	Success bool   `json:"success"`
-	Error   string `json:"error"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error"`
+	ErrorType string `json:"errorType"`
 
 	Status  string `json:"status"`
 	Message string `json:"message"`
@@ -1,22 +1,48 @@
 package rc
 
 import (
+	"context"
+	"errors"
 	"net/url"
+	"sync"
+	"time"
 
-	"github.com/gopackage/ddp"
+	"github.com/blushft/rc/internal/ddp"
 	"go.uber.org/zap"
 )
 
+// ErrNoRealtime is returned by realtime methods when Client was created
+// without StreamOptions or is not connected.
+var ErrNoRealtime = errors.New("rc: realtime api not connected")
+
+// ErrClosed is returned by realtime methods after Client.Close.
+var ErrClosed = errors.New("rc: client closed")
+
 type ddpClient struct {
-	ddp     *ddp.Client
-	streams *streams
+	ddp      *ddp.Client
+	streams  *streams
+	conn     *connState
+	statuses *statusQueue
+
+	// stop ends the goroutines started by the client and wg tracks them
+	// so Close can wait for them.
+	stop context.CancelFunc
+	wg   sync.WaitGroup
 
 	server string
 	debug  bool
 	log    *zap.SugaredLogger
 }
 
-func newDDPClient(server string, debug bool, logger *zap.SugaredLogger, opts ...StreamOption) (*ddpClient, error) {
+// ddpConfig holds the Client settings used to open the realtime connection.
+type ddpConfig struct {
+	dialer     *ddp.Dialer
+	frames     FrameRecorder
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+func newDDPClient(ctx context.Context, server string, cfg ddpConfig, debug bool, logger *zap.SugaredLogger, opts ...StreamOption) (*ddpClient, error) {
 	urlVals, err := url.Parse(server)
 	if err != nil {
 		return nil, err
@@ -32,54 +58,129 @@ func newDDPClient(server string, debug bool, logger *zap.SugaredLogger, opts ...
 
 	u := urlVals.String()
 
-	d := ddp.NewClient(u, server)
+	d := ddp.NewClient(u, server, cfg.dialer)
 
 	if debug {
-		d.SetSocketLogActive(true)
+		d.Logf = logger.Debugw
+	}
+	if cfg.frames != nil {
+		d.Observe = cfg.frames.RecordFrame
+	}
+	if cfg.minBackoff > 0 {
+		d.ReconnectInterval = cfg.minBackoff
+	}
+	if cfg.maxBackoff > 0 {
+		d.MaxReconnectInterval = cfg.maxBackoff
 	}
 
 	str, err := newStreams(opts...)
 	if err != nil {
 		return nil, err
 	}
+	str.c = d
 
-	if err := d.Connect(); err != nil {
-		return nil, err
+	client := &ddpClient{
+		ddp:      d,
+		log:      logger,
+		server:   server,
+		streams:  str,
+		conn:     newConnState(),
+		statuses: newStatusQueue(),
+		debug:    debug,
 	}
 
-	client := &ddpClient{
-		ddp:     d,
-		log:     logger,
-		server:  server,
-		streams: str,
-		debug:   debug,
+	var watchCtx context.Context
+	watchCtx, client.stop = context.WithCancel(context.Background())
+	client.wg.Add(1)
+	go client.watchStatus(watchCtx)
+
+	d.OnReconnect = client.relogin
+	d.AddStatusListener(client)
+
+	if err := d.Connect(ctx); err != nil {
+		d.Close()
+		client.stop()
+		client.wg.Wait()
+		return nil, err
 	}
 
 	return client, nil
 }
 
-func (d *ddpClient) Resume(ld ResumeLogin) error {
-	if _, err := d.call("login", ld); err != nil {
+func (d *ddpClient) Resume(ctx context.Context, ld ResumeLogin) error {
+	res, err := d.call(ctx, "login", ld)
+	if err != nil {
 		return err
 	}
+	d.conn.setLogin(&ld)
+	if m, ok := res.(map[string]interface{}); ok {
+		id, _ := m["id"].(string)
+		d.streams.setUser(id)
+	}
 
-	d.streams.runStreams(d.ddp)
-	return nil
+	return d.streams.runStreams(ctx)
 }
 
-func (d *ddpClient) Reconnect() {
-	d.ddp.Reconnect()
+func (d *ddpClient) Reconnect(ctx context.Context) error {
+	return d.ddp.Reconnect(ctx)
 }
 
+// Close stops the streams, closes their channels and the connection.
 func (d *ddpClient) Close() {
+	d.streams.close()
 	d.ddp.Close()
+	d.stop()
+	d.wg.Wait()
+	d.conn.close()
 }
 
-func (d *ddpClient) call(method string, args ...interface{}) (interface{}, error) {
-	return d.ddp.Call(method, args...)
+// call invokes a ddp method and waits for the result or for ctx to be done.
+// A cancelled call is abandoned; the server may still execute it.
+func (d *ddpClient) call(ctx context.Context, method string, args ...interface{}) (interface{}, error) {
+	call := d.ddp.Go(method, make(chan *ddp.Call, 1), args...)
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-call.Done:
+		return res.Reply, res.Error
+	}
 }
 
-func (c *Client) MessageStream() <-chan []RoomMessage {
+// maxCallRetries is how many times callIdempotent resends a call that was
+// lost with the connection.
+const maxCallRetries = 3
+
+// callIdempotent is like call but resends the call once the connection is
+// restored if it was lost before the result arrived. Only use it for methods
+// that are safe to repeat, such as sendMessage with a client generated id.
+func (d *ddpClient) callIdempotent(ctx context.Context, method string, args ...interface{}) (interface{}, error) {
+	for attempt := 0; ; attempt++ {
+		// A lost call is resent on a connection made after it was sent.
+		connects := d.conn.connections()
+		res, err := d.call(ctx, method, args...)
+		if err != ddp.ErrDisconnected || attempt == maxCallRetries {
+			return res, err
+		}
+		if err := d.waitConnected(ctx, connects); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sub sends a subscription request and waits until it is ready or ctx is
+// done. It returns the subscription id.
+func sub(ctx context.Context, c *ddp.Client, name string, args ...interface{}) (string, error) {
+	call := c.Subscribe(name, make(chan *ddp.Call, 1), args...)
+	select {
+	case <-ctx.Done():
+		c.Unsubscribe(call.ID)
+		return "", ctx.Err()
+	case res := <-call.Done:
+		return call.ID, res.Error
+	}
+}
+
+func (c *Client) MessageStream() <-chan []Message {
 	return c.d.streams.allMsgs
 }
 
@@ -91,7 +192,82 @@ func (c *Client) StreamErrors() <-chan error {
 	return c.d.streams.allErrs
 }
 
+// SubscribeRoom starts delivering the messages of a room on MessageStream.
+// Subscribing to a room twice has no effect.
+func (c *Client) SubscribeRoom(roomID string) error {
+	return c.SubscribeRoomContext(context.Background(), roomID)
+}
+
+// SubscribeRoomContext is like SubscribeRoom but stops waiting for the
+// server when ctx is done.
+func (c *Client) SubscribeRoomContext(ctx context.Context, roomID string) error {
+	if c.d == nil {
+		return ErrNoRealtime
+	}
+	return c.d.streams.subscribeRoom(ctx, roomID)
+}
+
+// UnsubscribeRoom stops delivering the messages of a room.
+func (c *Client) UnsubscribeRoom(roomID string) error {
+	if c.d == nil {
+		return ErrNoRealtime
+	}
+	return c.d.streams.unsubscribeRoom(roomID)
+}
+
+// SubscribeEvent starts delivering evt from sub on EventStream.
+// Subscribing to an event twice has no effect.
+func (c *Client) SubscribeEvent(sub StreamSubscription, evt NotificationEvent) error {
+	return c.SubscribeEventContext(context.Background(), sub, evt)
+}
+
+// SubscribeEventContext is like SubscribeEvent but stops waiting for the
+// server when ctx is done.
+func (c *Client) SubscribeEventContext(ctx context.Context, sub StreamSubscription, evt NotificationEvent) error {
+	if c.d == nil {
+		return ErrNoRealtime
+	}
+	return c.d.streams.subscribeEvent(ctx, sub, evt, "")
+}
+
+// UnsubscribeEvent stops delivering evt from sub.
+func (c *Client) UnsubscribeEvent(sub StreamSubscription, evt NotificationEvent) error {
+	if c.d == nil {
+		return ErrNoRealtime
+	}
+	return c.d.streams.unsubscribeEvent(sub, evt, "")
+}
+
+// SubscribeRoomEvent starts delivering evt in a room, such as NotifyTyping,
+// on EventStream. Subscribing to an event twice has no effect.
+func (c *Client) SubscribeRoomEvent(roomID string, evt NotificationEvent) error {
+	return c.SubscribeRoomEventContext(context.Background(), roomID, evt)
+}
+
+// SubscribeRoomEventContext is like SubscribeRoomEvent but stops waiting
+// for the server when ctx is done.
+func (c *Client) SubscribeRoomEventContext(ctx context.Context, roomID string, evt NotificationEvent) error {
+	if c.d == nil {
+		return ErrNoRealtime
+	}
+	return c.d.streams.subscribeEvent(ctx, roomEventSub(evt), evt, roomID)
+}
+
+// UnsubscribeRoomEvent stops delivering evt in a room.
+func (c *Client) UnsubscribeRoomEvent(roomID string, evt NotificationEvent) error {
+	if c.d == nil {
+		return ErrNoRealtime
+	}
+	return c.d.streams.unsubscribeEvent(roomEventSub(evt), evt, roomID)
+}
+
 func NewUpdateListener(fn func(ddp.Update) (interface{}, error)) (ddp.UpdateListener, *SubChannel) {
+	return newUpdateListener(fn, nil)
+}
+
+// newUpdateListener creates a listener that stops delivering once stop is
+// closed, so a removed listener never blocks the ddp reader.
+func newUpdateListener(fn func(ddp.Update) (interface{}, error), stop chan struct{}) (*updateListener, *SubChannel) {
 	u := make(chan interface{}, 10)
 	e := make(chan error, 10)
 
@@ -99,6 +275,7 @@ func NewUpdateListener(fn func(ddp.Update) (interface{}, error)) (ddp.UpdateList
 		updates: u,
 		errors:  e,
 		process: fn,
+		stop:    stop,
 	}
 
 	return ml, &SubChannel{Updates: u, Errors: e}
@@ -113,12 +290,22 @@ type updateListener struct {
 	updates chan interface{}
 	errors  chan error
 	process func(ddp.Update) (interface{}, error)
+	stop    chan struct{}
 }
 
-func (ul updateListener) CollectionUpdate(coll, op, id string, update ddp.Update) {
+func (ul *updateListener) CollectionUpdate(coll, op, id string, update ddp.Update) {
 	u, err := ul.process(update)
 	if err != nil {
-		ul.errors <- err
+		select {
+		case ul.errors <- err:
+		case <-ul.stop:
+		}
+		return
+	}
+	if u != nil {
+		select {
+		case ul.updates <- u:
+		case <-ul.stop:
+		}
 	}
-	ul.updates <- u
 }
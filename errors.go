@@ -0,0 +1,90 @@
+package rc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// APIError is returned when the Rocket.Chat api responds with a non-success
+// status code. It carries the http status along with the error fields of the
+// Status envelope.
+type APIError struct {
+	StatusCode int
+	Endpoint   string
+	ErrorType  string
+	Message    string
+	Body       []byte
+}
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = http.StatusText(e.StatusCode)
+	}
+	if e.ErrorType != "" {
+		return fmt.Sprintf("rc: %s returned %d: %s (%s)", e.Endpoint, e.StatusCode, msg, e.ErrorType)
+	}
+	return fmt.Sprintf("rc: %s returned %d: %s", e.Endpoint, e.StatusCode, msg)
+}
+
+func newAPIError(endpoint string, code int, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: code,
+		Endpoint:   endpoint,
+		Body:       body,
+	}
+
+	st := &Status{}
+	if err := json.Unmarshal(body, st); err == nil {
+		apiErr.ErrorType = st.ErrorType
+		apiErr.Message = st.Error
+		if apiErr.Message == "" {
+			apiErr.Message = st.Message
+		}
+	}
+
+	return apiErr
+}
+
+// AsAPIError returns err as an *APIError if it is one.
+func AsAPIError(err error) (*APIError, bool) {
+	apiErr, ok := err.(*APIError)
+	return apiErr, ok
+}
+
+func hasStatus(err error, code int) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.StatusCode == code
+}
+
+// IsBadRequest reports whether err is an APIError with status 400.
+func IsBadRequest(err error) bool {
+	return hasStatus(err, http.StatusBadRequest)
+}
+
+// IsUnauthorized reports whether err is an APIError with status 401.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsForbidden reports whether err is an APIError with status 403.
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsNotFound reports whether err is an APIError with status 404.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsRateLimited reports whether err is an APIError with status 429.
+func IsRateLimited(err error) bool {
+	return hasStatus(err, http.StatusTooManyRequests)
+}
+
+// IsServerError reports whether err is an APIError with a 5xx status.
+func IsServerError(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.StatusCode >= http.StatusInternalServerError
+}
@@ -0,0 +1,87 @@
+package rc
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name    string
+		code    int
+		body    string
+		check   func(error) bool
+		errType string
+	}{
+		{
+			name:    "not_found",
+			code:    http.StatusNotFound,
+			body:    `{"success":false,"error":"The required \"roomId\" or \"roomName\" param provided does not match any channel [error-room-not-found]","errorType":"error-room-not-found"}`,
+			check:   IsNotFound,
+			errType: "error-room-not-found",
+		},
+		{
+			name:  "unauthorized",
+			code:  http.StatusUnauthorized,
+			body:  `{"status":"error","message":"You must be logged in to do this."}`,
+			check: IsUnauthorized,
+		},
+		{
+			name:    "rate_limited",
+			code:    http.StatusTooManyRequests,
+			body:    `{"success":false,"error":"Error, too many requests. Please slow down.","errorType":"error-too-many-requests"}`,
+			check:   IsRateLimited,
+			errType: "error-too-many-requests",
+		},
+		{
+			name:  "server_error",
+			code:  http.StatusInternalServerError,
+			body:  `internal error`,
+			check: IsServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.code)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			client := New(ServerURL(srv.URL))
+			ch, err := client.GetChannelInfo("GENERAL")
+			if ch != nil {
+				t.Errorf("GetChannelInfo() = %v, want nil", ch)
+			}
+			if !tt.check(err) {
+				t.Fatalf("GetChannelInfo() error = %#v, want status %d", err, tt.code)
+			}
+
+			apiErr, _ := AsAPIError(err)
+			if apiErr.Endpoint != "/channels.info" {
+				t.Errorf("APIError.Endpoint = %s, want /channels.info", apiErr.Endpoint)
+			}
+			if apiErr.ErrorType != tt.errType {
+				t.Errorf("APIError.ErrorType = %s, want %s", apiErr.ErrorType, tt.errType)
+			}
+		})
+	}
+}
+
+func TestStatusEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"success":false,"error":"Not allowed [error-action-not-allowed]","errorType":"error-action-not-allowed"}`))
+	}))
+	defer srv.Close()
+
+	client := New(ServerURL(srv.URL))
+	err := client.ArchiveChannel("GENERAL")
+	apiErr, ok := AsAPIError(err)
+	if !ok {
+		t.Fatalf("ArchiveChannel() error = %#v, want *APIError", err)
+	}
+	if apiErr.StatusCode != http.StatusOK || apiErr.ErrorType != "error-action-not-allowed" {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+}
@@ -0,0 +1,338 @@
+package rc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnknownEvent is returned by StreamEvent.Decode for events without a
+// typed payload.
+var ErrUnknownEvent = errors.New("rc: unknown stream event")
+
+// AvatarUpdatedEvent is sent for NotifyUpdateAvatar.
+type AvatarUpdatedEvent struct {
+	Username string `json:"username"`
+	ETag     string `json:"etag"`
+}
+
+// RolesChangeEvent is sent for NotifyRolesChange. Type is "added",
+// "removed" or "changed".
+type RolesChangeEvent struct {
+	Type  string   `json:"type"`
+	Role  string   `json:"_id"`
+	Scope string   `json:"scope"`
+	User  RoomUser `json:"u"`
+}
+
+type CustomEmoji struct {
+	ID        string   `json:"_id"`
+	Name      string   `json:"name"`
+	Aliases   []string `json:"aliases"`
+	Extension string   `json:"extension"`
+}
+
+// EmojiUpdatedEvent is sent for NotifyUpdateEmoji.
+type EmojiUpdatedEvent struct {
+	Emoji CustomEmoji `json:"emojiData"`
+}
+
+// EmojiDeletedEvent is sent for NotifyDeleteEmoji.
+type EmojiDeletedEvent struct {
+	Emoji CustomEmoji `json:"emojiData"`
+}
+
+// SettingChangedEvent is sent for NotifyPublicSettingsChanged. Action is
+// "inserted", "updated" or "removed".
+type SettingChangedEvent struct {
+	Action string
+	ID     string      `json:"_id"`
+	Value  interface{} `json:"value"`
+}
+
+// PermissionsChangedEvent is sent for NotifyPermissionsChanged.
+type PermissionsChangedEvent struct {
+	Action string
+	ID     string   `json:"_id"`
+	Roles  []string `json:"roles"`
+}
+
+// UserNameChangedEvent is sent for NotifyNameChanged.
+type UserNameChangedEvent struct {
+	UserID   string `json:"_id"`
+	Username string `json:"username"`
+	Name     string `json:"name"`
+}
+
+// UserDeletedEvent is sent for NotifyUserDeleted.
+type UserDeletedEvent struct {
+	UserID string `json:"userId"`
+}
+
+// UserStatusEvent is sent for NotifyUserStatus. Status is "offline",
+// "online", "away" or "busy".
+type UserStatusEvent struct {
+	UserID     string
+	Username   string
+	Status     string
+	StatusText string
+}
+
+// MessageEvent is sent for NotifyMessage.
+type MessageEvent struct {
+	Message Message
+}
+
+// OTREvent is sent for NotifyOTR.
+type OTREvent struct {
+	Type   string
+	RoomID string `json:"roomId"`
+	UserID string `json:"userId"`
+}
+
+// WebRTCEvent is sent for NotifyWebRTC.
+type WebRTCEvent struct {
+	Type string
+	Data map[string]interface{}
+}
+
+// UserNotificationEvent is sent for NotifyNotification.
+type UserNotificationEvent struct {
+	Title   string              `json:"title"`
+	Text    string              `json:"text"`
+	Payload NotificationPayload `json:"payload"`
+}
+
+type NotificationPayload struct {
+	ID      string   `json:"_id"`
+	RoomID  string   `json:"rid"`
+	Type    string   `json:"type"`
+	Name    string   `json:"name"`
+	Sender  RoomUser `json:"sender"`
+	Message struct {
+		Msg string `json:"msg"`
+	} `json:"message"`
+}
+
+// RoomsChangedEvent is sent for NotifyRoomsChanged. Action is "inserted",
+// "updated" or "removed".
+type RoomsChangedEvent struct {
+	Action string
+	Room   ChangedRoom
+}
+
+type ChangedRoom struct {
+	ID          string    `json:"_id"`
+	Name        string    `json:"name"`
+	Type        string    `json:"t"`
+	Topic       string    `json:"topic"`
+	ReadOnly    bool      `json:"ro"`
+	UpdatedAt   Timestamp `json:"_updatedAt"`
+	LastMessage *Message  `json:"lastMessage"`
+}
+
+// SubscriptionsChangedEvent is sent for NotifySubsChanged. Action is
+// "inserted", "updated" or "removed".
+type SubscriptionsChangedEvent struct {
+	Action       string
+	Subscription ChangedSubscription
+}
+
+type ChangedSubscription struct {
+	ID            string    `json:"_id"`
+	RoomID        string    `json:"rid"`
+	Name          string    `json:"name"`
+	Type          string    `json:"t"`
+	Open          bool      `json:"open"`
+	Alert         bool      `json:"alert"`
+	Unread        int64     `json:"unread"`
+	UserMentions  int64     `json:"userMentions"`
+	GroupMentions int64     `json:"groupMentions"`
+	User          RoomUser  `json:"u"`
+	UpdatedAt     Timestamp `json:"_updatedAt"`
+}
+
+// DeleteMessageEvent is sent for NotifyDeleteMessage.
+type DeleteMessageEvent struct {
+	RoomID    string
+	MessageID string `json:"_id"`
+}
+
+// TypingEvent is sent for NotifyTyping.
+type TypingEvent struct {
+	RoomID   string
+	Username string
+	Typing   bool
+}
+
+// eventKinds maps event names, without any room or user prefix, to their
+// NotificationEvent.
+var eventKinds = func() map[string]NotificationEvent {
+	kinds := map[string]NotificationEvent{}
+	for _, sub := range []StreamSubscription{SubNotifyAll, SubNotifyLogged, SubNotifyUser, SubNotifyRoom, SubNotifyRoomUsers} {
+		for evt, name := range sub.events {
+			kinds[name] = evt
+		}
+	}
+	return kinds
+}()
+
+// splitEvent splits a scoped event name such as "GENERAL/typing" into its
+// scope and name.
+func splitEvent(event string) (string, string) {
+	i := strings.LastIndex(event, "/")
+	if i < 0 {
+		return "", event
+	}
+	return event[:i], event[i+1:]
+}
+
+// Kind returns the NotificationEvent of e.
+func (e *StreamEvent) Kind() (NotificationEvent, bool) {
+	_, name := splitEvent(e.Event)
+	k, ok := eventKinds[name]
+	return k, ok
+}
+
+// Decode returns the typed payload of e, for example *UserStatusEvent for
+// a NotifyUserStatus event.
+func (e *StreamEvent) Decode() (interface{}, error) {
+	kind, ok := e.Kind()
+	if !ok {
+		return nil, ErrUnknownEvent
+	}
+	scope, _ := splitEvent(e.Event)
+
+	var v interface{}
+	var err error
+
+	switch kind {
+	case NotifyUpdateAvatar:
+		evt := &AvatarUpdatedEvent{}
+		v, err = evt, e.arg(0, evt)
+	case NotifyRolesChange:
+		evt := &RolesChangeEvent{}
+		v, err = evt, e.arg(0, evt)
+	case NotifyUpdateEmoji:
+		evt := &EmojiUpdatedEvent{}
+		v, err = evt, e.arg(0, evt)
+	case NotifyDeleteEmoji:
+		evt := &EmojiDeletedEvent{}
+		v, err = evt, e.arg(0, evt)
+	case NotifyPublicSettingsChanged:
+		evt := &SettingChangedEvent{}
+		v, err = evt, e.actionArgs(&evt.Action, evt)
+	case NotifyPermissionsChanged:
+		evt := &PermissionsChangedEvent{}
+		v, err = evt, e.actionArgs(&evt.Action, evt)
+	case NotifyNameChanged:
+		evt := &UserNameChangedEvent{}
+		v, err = evt, e.arg(0, evt)
+	case NotifyUserDeleted:
+		evt := &UserDeletedEvent{}
+		v, err = evt, e.arg(0, evt)
+	case NotifyUserStatus:
+		v, err = e.userStatus()
+	case NotifyMessage:
+		evt := &MessageEvent{}
+		v, err = evt, e.arg(0, &evt.Message)
+	case NotifyOTR:
+		evt := &OTREvent{}
+		v, err = evt, e.actionArgs(&evt.Type, evt)
+	case NotifyWebRTC:
+		evt := &WebRTCEvent{}
+		v, err = evt, e.actionArgs(&evt.Type, &evt.Data)
+	case NotifyNotification:
+		evt := &UserNotificationEvent{}
+		v, err = evt, e.arg(0, evt)
+	case NotifyRoomsChanged:
+		evt := &RoomsChangedEvent{}
+		v, err = evt, e.actionArgs(&evt.Action, &evt.Room)
+	case NotifySubsChanged:
+		evt := &SubscriptionsChangedEvent{}
+		v, err = evt, e.actionArgs(&evt.Action, &evt.Subscription)
+	case NotifyDeleteMessage:
+		evt := &DeleteMessageEvent{RoomID: scope}
+		v, err = evt, e.arg(0, evt)
+	case NotifyTyping:
+		evt := &TypingEvent{RoomID: scope}
+		err = e.arg(0, &evt.Username)
+		if err == nil {
+			err = e.arg(1, &evt.Typing)
+		}
+		v = evt
+	default:
+		return nil, ErrUnknownEvent
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("rc: decoding %s event: %v", e.Event, err)
+	}
+	return v, nil
+}
+
+// arg decodes the i-th argument into v.
+func (e *StreamEvent) arg(i int, v interface{}) error {
+	if i >= len(e.Args) {
+		return fmt.Errorf("missing argument %d", i)
+	}
+	b, err := json.Marshal(e.Args[i])
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// actionArgs decodes events sent as an action name followed by a document.
+func (e *StreamEvent) actionArgs(action *string, v interface{}) error {
+	if err := e.arg(0, action); err != nil {
+		return err
+	}
+	return e.arg(1, v)
+}
+
+// userStatus decodes the [id, username, status, text] tuple of a
+// user-status event. The status arrives as a json number.
+func (e *StreamEvent) userStatus() (*UserStatusEvent, error) {
+	var tuple []interface{}
+	if err := e.arg(0, &tuple); err != nil {
+		return nil, err
+	}
+	if len(tuple) < 3 {
+		return nil, errors.New("not a status message")
+	}
+
+	evt := &UserStatusEvent{}
+	var ok bool
+	if evt.UserID, ok = tuple[0].(string); !ok {
+		return nil, errors.New("invalid user id")
+	}
+	if evt.Username, ok = tuple[1].(string); !ok {
+		return nil, errors.New("invalid username")
+	}
+	status, ok := tuple[2].(float64)
+	if !ok {
+		return nil, errors.New("invalid status")
+	}
+	evt.Status = userStatus(int(status))
+	if len(tuple) > 3 {
+		evt.StatusText, _ = tuple[3].(string)
+	}
+	return evt, nil
+}
+
+func userStatus(i int) string {
+	switch i {
+	case 0:
+		return StatusOffline
+	case 1:
+		return StatusOnline
+	case 2:
+		return StatusAway
+	case 3:
+		return StatusBusy
+	default:
+		return "unknown"
+	}
+}
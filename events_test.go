@@ -0,0 +1,104 @@
+package rc
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestDecodeEvent(t *testing.T) {
+	tests := []struct {
+		evt  StreamEvent
+		want interface{}
+	}{
+		{
+			StreamEvent{Event: "user-status", Args: []interface{}{[]interface{}{"u1", "alice", float64(2), "lunch"}}},
+			&UserStatusEvent{UserID: "u1", Username: "alice", Status: "away", StatusText: "lunch"},
+		},
+		{
+			StreamEvent{Event: "roles-change", Args: []interface{}{map[string]interface{}{
+				"type": "added", "_id": "moderator", "scope": "GENERAL",
+				"u": map[string]interface{}{"_id": "u1", "username": "alice"},
+			}}},
+			&RolesChangeEvent{Type: "added", Role: "moderator", Scope: "GENERAL", User: RoomUser{ID: "u1", Username: "alice"}},
+		},
+		{
+			StreamEvent{Event: "GENERAL/deleteMessage", Args: []interface{}{map[string]interface{}{"_id": "m1"}}},
+			&DeleteMessageEvent{RoomID: "GENERAL", MessageID: "m1"},
+		},
+		{
+			StreamEvent{Event: "GENERAL/typing", Args: []interface{}{"alice", true}},
+			&TypingEvent{RoomID: "GENERAL", Username: "alice", Typing: true},
+		},
+		{
+			StreamEvent{Event: "u1/subscriptions-changed", Args: []interface{}{"updated", map[string]interface{}{
+				"_id": "s1", "rid": "GENERAL", "name": "general", "t": "c", "unread": float64(3),
+			}}},
+			&SubscriptionsChangedEvent{Action: "updated", Subscription: ChangedSubscription{
+				ID: "s1", RoomID: "GENERAL", Name: "general", Type: "c", Unread: 3,
+			}},
+		},
+		{
+			StreamEvent{Event: "u1/rooms-changed", Args: []interface{}{"removed", map[string]interface{}{"_id": "r1", "t": "p"}}},
+			&RoomsChangedEvent{Action: "removed", Room: ChangedRoom{ID: "r1", Type: "p"}},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.evt.Decode()
+		if err != nil {
+			t.Errorf("%s: %v", tt.evt.Event, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.evt.Event, got, tt.want)
+		}
+	}
+
+	if _, err := (&StreamEvent{Event: "unknown"}).Decode(); err != ErrUnknownEvent {
+		t.Errorf("unknown event: err = %v", err)
+	}
+	bad := &StreamEvent{Event: "user-status", Args: []interface{}{[]interface{}{"u1", "alice", "away"}}}
+	if _, err := bad.Decode(); err == nil {
+		t.Error("malformed user-status: want error")
+	}
+}
+
+func TestDecodeUserStatus(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	srv.AddUser("alice", "secret")
+
+	client := New(
+		ServerURL(srv.URL),
+		Credentials(bot.Username, bot.Password),
+		StreamOptions(EventSubscription(SubNotifyLogged, NotifyUserStatus)),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	srv.SetStatus("alice", "busy")
+
+	select {
+	case evt := <-client.EventStream():
+		v, err := evt.Decode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		status, ok := v.(*UserStatusEvent)
+		if !ok || status.Username != "alice" || status.Status != "busy" {
+			t.Errorf("got %#v", v)
+		}
+	case err := <-client.StreamErrors():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/blushft/rc"
@@ -29,20 +30,19 @@ func main() {
 		log.Fatal(err)
 	}
 
-	for {
-		select {
-		case e := <-client.EventStream():
-			log.Printf("Event: %s\n", e.Event)
-			log.Printf("Args: %#v", e.Args)
-		case m := <-client.MessageStream():
-			log.Printf("%d messages\n", len(m))
-			for _, msg := range m {
-				log.Printf("From: %s - %s\n", msg.User.Username, msg.Msg)
-			}
+	r := rc.NewRouter(client)
+	r.OnMessage("", func(msg rc.Message) {
+		log.Printf("From: %s - %s\n", msg.User.Username, msg.Text)
+	})
+	r.OnEventFunc(func(*rc.StreamEvent) bool { return true }, func(e *rc.StreamEvent) {
+		log.Printf("Event: %s\n", e.Event)
+		log.Printf("Args: %#v", e.Args)
+	})
+	r.OnError(func(err error) {
+		log.Fatal(err)
+	})
 
-		case serr := <-client.StreamErrors():
-			log.Fatal(serr)
-		default:
-		}
+	if err := r.Run(context.Background()); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -0,0 +1,125 @@
+package rc
+
+import (
+	"context"
+	"io"
+	"net/url"
+)
+
+type FileList struct {
+	Files []RoomFile `json:"files"`
+	Pagination
+	Success bool `json:"success"`
+}
+
+// RoomFile is a file uploaded to a room. URL is relative to the server.
+type RoomFile struct {
+	ID          string      `json:"_id"`
+	Name        string      `json:"name"`
+	Type        string      `json:"type"`
+	Size        int64       `json:"size"`
+	RoomID      string      `json:"rid"`
+	UserID      string      `json:"userId"`
+	User        ChannelUser `json:"user"`
+	Description string      `json:"description"`
+	URL         string      `json:"url"`
+	UploadedAt  string      `json:"uploadedAt"`
+	Complete    bool        `json:"complete"`
+}
+
+type fileUpload struct {
+	description string
+	msg         string
+	tmid        string
+}
+
+// UploadOption is a functional argument that sets optional values on a
+// file upload
+type UploadOption func(*fileUpload)
+
+// UploadDescription sets the description of the file.
+func UploadDescription(desc string) UploadOption {
+	return func(u *fileUpload) {
+		u.description = desc
+	}
+}
+
+// UploadMessage sets the text of the message posted with the file.
+func UploadMessage(text string) UploadOption {
+	return func(u *fileUpload) {
+		u.msg = text
+	}
+}
+
+// UploadThread posts the file as a reply in the thread started by tmid.
+func UploadThread(tmid string) UploadOption {
+	return func(u *fileUpload) {
+		u.tmid = tmid
+	}
+}
+
+// UploadFile uploads the content of r as filename to a room and returns the
+// message posted with it. r is streamed to the server, not buffered, so the
+// upload is never retried.
+func (c *Client) UploadFile(roomID string, r io.Reader, filename string, opts ...UploadOption) (*Message, error) {
+	return c.UploadFileContext(context.Background(), roomID, r, filename, opts...)
+}
+
+func (c *Client) UploadFileContext(ctx context.Context, roomID string, r io.Reader, filename string, opts ...UploadOption) (*Message, error) {
+	u := &fileUpload{}
+	for _, opt := range opts {
+		opt(u)
+	}
+
+	fields := url.Values{}
+	for k, v := range map[string]string{"description": u.description, "msg": u.msg, "tmid": u.tmid} {
+		if v != "" {
+			fields.Set(k, v)
+		}
+	}
+
+	path := "/rooms.upload/" + url.PathEscape(roomID)
+	res := c.c.postMultipart(ctx, path, fields, filename, r)
+	env := &msgEnv{}
+	if err := res.JSON(env); err != nil {
+		return nil, err
+	}
+	if !env.Success {
+		return nil, newAPIError(path, res.StatusCode(), res.Body())
+	}
+
+	m := env.Message
+	return &m, nil
+}
+
+// DefaultMaxRedirects is the number of redirects DownloadFile follows.
+var DefaultMaxRedirects = 10
+
+// DownloadFile writes the file at fileURL, such as RoomFile.URL, to w and
+// returns the number of bytes written. Relative urls are resolved against
+// the server, which is the only host the auth headers are sent to, also
+// when a redirect leads elsewhere.
+func (c *Client) DownloadFile(fileURL string, w io.Writer) (int64, error) {
+	return c.DownloadFileContext(context.Background(), fileURL, w)
+}
+
+func (c *Client) DownloadFileContext(ctx context.Context, fileURL string, w io.Writer) (int64, error) {
+	return c.c.download(ctx, fileURL, w)
+}
+
+// roomFiles gets a page of the files of a room from one of the
+// channels.files, groups.files or im.files endpoints.
+func (c *Client) roomFiles(ctx context.Context, path, roomID string, q *Query) (*FileList, error) {
+	if q == nil {
+		q = NewQuery()
+	}
+	vals := q.URLValues()
+	vals.Set("roomId", roomID)
+
+	files := &FileList{}
+	if err := c.c.get(ctx, path, vals).JSON(files); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
@@ -0,0 +1,161 @@
+package rc
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestFiles(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	alice := srv.AddUser("alice", "secret")
+	builds := srv.AddChannel("builds", "bot")
+	ops := srv.AddGroup("ops", "bot")
+
+	client := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A pipe has no length, so the upload has to be streamed.
+	log := strings.Repeat("ok\n", 100000)
+	pr, pw := io.Pipe()
+	go func() {
+		io.Copy(pw, strings.NewReader(log))
+		pw.Close()
+	}()
+	msg, err := client.UploadFile(builds.ID, pr, "build.log",
+		UploadDescription("nightly"),
+		UploadMessage("build 42 passed"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Text != "build 42 passed" || msg.File == nil || msg.File.Name != "build.log" {
+		t.Fatalf("message = %+v", msg)
+	}
+	if len(msg.Attachments) != 1 || msg.Attachments[0].Description != "nightly" {
+		t.Errorf("attachments = %+v", msg.Attachments)
+	}
+
+	reply, err := client.UploadFile(builds.ID, strings.NewReader("\x89PNG\r\n\x1a\n"), "shot.png", UploadThread(msg.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.ThreadID != msg.ID || reply.File.Type != "image/png" {
+		t.Errorf("reply = %+v", reply)
+	}
+
+	files, err := client.GetChannelFiles(builds.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files.Files) != 2 || files.Total != 2 {
+		t.Fatalf("files = %+v", files)
+	}
+	var f RoomFile
+	for _, rf := range files.Files {
+		if rf.Name == "build.log" {
+			f = rf
+		}
+	}
+	if f.Size != int64(len(log)) || f.Description != "nightly" || f.User.Username != "bot" {
+		t.Errorf("file = %+v", f)
+	}
+
+	var buf bytes.Buffer
+	n, err := client.DownloadFile(f.URL, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(log)) || buf.String() != log {
+		t.Errorf("downloaded %d bytes", n)
+	}
+
+	if _, err := client.UploadFile(ops.ID, strings.NewReader("secret"), "keys.txt"); err != nil {
+		t.Fatal(err)
+	}
+	groupFiles, err := client.GetGroupFiles(ops.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groupFiles.Files) != 1 {
+		t.Fatalf("group files = %+v", groupFiles)
+	}
+
+	other := New(ServerURL(srv.URL), AccessToken(alice.ID, alice.Token))
+	if err := other.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	_, err = other.DownloadFile(groupFiles.Files[0].URL, &buf)
+	if apiErr, ok := AsAPIError(err); !ok || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("download by non-member err = %v", err)
+	}
+	if _, err := other.UploadFile(ops.ID, strings.NewReader("x"), "x.txt"); err == nil {
+		t.Error("upload by non-member succeeded")
+	}
+
+	// The auth headers stay on the server.
+	var token string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("X-Auth-Token")
+		io.WriteString(w, "avatar")
+	}))
+	defer cdn.Close()
+	buf.Reset()
+	if _, err := client.DownloadFile(cdn.URL+"/avatar.png", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "avatar" || token != "" {
+		t.Errorf("got %q with token %q", buf.String(), token)
+	}
+}
+
+func TestDownloadRedirect(t *testing.T) {
+	var cdnToken string
+	cdn := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cdnToken = r.Header.Get("X-Auth-Token")
+		io.WriteString(w, "stored")
+	}))
+	defer cdn.Close()
+
+	// The server moves the file once on its own host and then to storage.
+	var token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/file-upload/a/report.txt":
+			http.Redirect(w, r, "/file-upload/b/report.txt", http.StatusFound)
+		case "/file-upload/b/report.txt":
+			token = r.Header.Get("X-Auth-Token")
+			http.Redirect(w, r, cdn.URL+"/report.txt", http.StatusTemporaryRedirect)
+		default:
+			http.Redirect(w, r, r.URL.Path, http.StatusFound)
+		}
+	}))
+	defer srv.Close()
+
+	client := New(ServerURL(srv.URL), AccessToken("bot", "token"))
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := client.DownloadFile("/file-upload/a/report.txt", &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "stored" || token != "token" || cdnToken != "" {
+		t.Errorf("got %q, token %q on the server and %q on the cdn", buf.String(), token, cdnToken)
+	}
+
+	if _, err := client.DownloadFile("/loop", &buf); err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("redirect loop err = %v", err)
+	}
+}
@@ -1,3 +1,258 @@
 package rc
 
 // Private Group API calls
+
+import "context"
+
+type groupEnv struct {
+	Group   Group `json:"group"`
+	Success bool  `json:"success"`
+}
+
+// CreateGroup creates a private group owned by the logged in user.
+func (c *Client) CreateGroup(name string, opts ...RoomCreateOption) (*Group, error) {
+	return c.CreateGroupContext(context.Background(), name, opts...)
+}
+
+func (c *Client) CreateGroupContext(ctx context.Context, name string, opts ...RoomCreateOption) (*Group, error) {
+	env := &groupEnv{}
+	if err := c.c.postStatus(ctx, "/groups.create", newRoomCreate(name, opts), env); err != nil {
+		return nil, err
+	}
+
+	g := env.Group
+	return &g, nil
+}
+
+func (c *Client) GetGroupInfo(roomID string) (*Group, error) {
+	return c.GetGroupInfoContext(context.Background(), roomID)
+}
+
+func (c *Client) GetGroupInfoContext(ctx context.Context, roomID string) (*Group, error) {
+	env := &groupEnv{}
+	q := query("roomId", roomID)
+	if err := c.c.get(ctx, "/groups.info", q.Q()).JSON(env); err != nil {
+		return nil, err
+	}
+
+	g := env.Group
+	return &g, nil
+}
+
+// GetJoinedGroups returns the private groups the logged in user is a
+// member of. GetGroupList returns every group and needs admin rights.
+func (c *Client) GetJoinedGroups() (*GroupList, error) {
+	return c.GetJoinedGroupsContext(context.Background())
+}
+
+func (c *Client) GetJoinedGroupsContext(ctx context.Context) (*GroupList, error) {
+	glist := &GroupList{}
+	if err := c.c.get(ctx, "/groups.list", nil).JSON(glist); err != nil {
+		return nil, err
+	}
+
+	return glist, nil
+}
+
+func (c *Client) GetGroupHistory(q HistoryQuery) (*ChannelHistory, error) {
+	return c.GetGroupHistoryContext(context.Background(), q)
+}
+
+func (c *Client) GetGroupHistoryContext(ctx context.Context, q HistoryQuery) (*ChannelHistory, error) {
+	history := &ChannelHistory{}
+	if err := c.c.get(ctx, "/groups.history", q.Q()).JSON(history); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+func (c *Client) GetGroupCounters(roomID string) (*ChannelCounters, error) {
+	return c.GetGroupCountersContext(context.Background(), roomID)
+}
+
+func (c *Client) GetGroupCountersContext(ctx context.Context, roomID string) (*ChannelCounters, error) {
+	counters := &ChannelCounters{}
+	q := query("roomId", roomID)
+	if err := c.c.get(ctx, "/groups.counters", q.Q()).JSON(counters); err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+func (c *Client) GetGroupRoles(roomID string) ([]ChannelRole, error) {
+	return c.GetGroupRolesContext(context.Background(), roomID)
+}
+
+func (c *Client) GetGroupRolesContext(ctx context.Context, roomID string) ([]ChannelRole, error) {
+	roles := &ChannelRoles{}
+	q := query("roomId", roomID)
+	if err := c.c.get(ctx, "/groups.roles", q.Q()).JSON(roles); err != nil {
+		return nil, err
+	}
+
+	r := roles.Roles
+	return r, nil
+}
+
+// GetGroupFiles returns a page of the files uploaded to a private group,
+// newest first. q may be nil.
+func (c *Client) GetGroupFiles(roomID string, q *Query) (*FileList, error) {
+	return c.GetGroupFilesContext(context.Background(), roomID, q)
+}
+
+func (c *Client) GetGroupFilesContext(ctx context.Context, roomID string, q *Query) (*FileList, error) {
+	return c.roomFiles(ctx, "/groups.files", roomID, q)
+}
+
+// DeleteGroup deletes a private group and its messages.
+func (c *Client) DeleteGroup(roomID string) error {
+	return c.DeleteGroupContext(context.Background(), roomID)
+}
+
+func (c *Client) DeleteGroupContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/groups.delete", req, nil)
+}
+
+// ArchiveGroup archives a private group.
+func (c *Client) ArchiveGroup(roomID string) error {
+	return c.ArchiveGroupContext(context.Background(), roomID)
+}
+
+func (c *Client) ArchiveGroupContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/groups.archive", req, nil)
+}
+
+// UnarchiveGroup restores an archived private group.
+func (c *Client) UnarchiveGroup(roomID string) error {
+	return c.UnarchiveGroupContext(context.Background(), roomID)
+}
+
+func (c *Client) UnarchiveGroupContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/groups.unarchive", req, nil)
+}
+
+// OpenGroup shows a closed group in the room list of the logged in user.
+func (c *Client) OpenGroup(roomID string) error {
+	return c.OpenGroupContext(context.Background(), roomID)
+}
+
+func (c *Client) OpenGroupContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/groups.open", req, nil)
+}
+
+// CloseGroup hides a group from the room list of the logged in user
+// without leaving it.
+func (c *Client) CloseGroup(roomID string) error {
+	return c.CloseGroupContext(context.Background(), roomID)
+}
+
+func (c *Client) CloseGroupContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/groups.close", req, nil)
+}
+
+// RenameGroup changes the name of a private group.
+func (c *Client) RenameGroup(roomID, name string) error {
+	return c.RenameGroupContext(context.Background(), roomID, name)
+}
+
+func (c *Client) RenameGroupContext(ctx context.Context, roomID, name string) error {
+	req := map[string]string{"roomId": roomID, "name": name}
+	return c.c.postStatus(ctx, "/groups.rename", req, nil)
+}
+
+// SetGroupType converts a group to RoomTypeGroup or RoomTypeChannel.
+func (c *Client) SetGroupType(roomID, roomType string) error {
+	return c.SetGroupTypeContext(context.Background(), roomID, roomType)
+}
+
+func (c *Client) SetGroupTypeContext(ctx context.Context, roomID, roomType string) error {
+	req := map[string]string{"roomId": roomID, "type": roomType}
+	return c.c.postStatus(ctx, "/groups.setType", req, nil)
+}
+
+// InviteToGroup adds a user to a private group.
+func (c *Client) InviteToGroup(roomID, userID string) error {
+	return c.InviteToGroupContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) InviteToGroupContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/groups.invite", req, nil)
+}
+
+// KickFromGroup removes a user from a private group.
+func (c *Client) KickFromGroup(roomID, userID string) error {
+	return c.KickFromGroupContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) KickFromGroupContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/groups.kick", req, nil)
+}
+
+// LeaveGroup removes the logged in user from a private group.
+func (c *Client) LeaveGroup(roomID string) error {
+	return c.LeaveGroupContext(context.Background(), roomID)
+}
+
+func (c *Client) LeaveGroupContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/groups.leave", req, nil)
+}
+
+// AddGroupOwner gives a member the owner role.
+func (c *Client) AddGroupOwner(roomID, userID string) error {
+	return c.AddGroupOwnerContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) AddGroupOwnerContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/groups.addOwner", req, nil)
+}
+
+// RemoveGroupOwner takes the owner role from a member.
+func (c *Client) RemoveGroupOwner(roomID, userID string) error {
+	return c.RemoveGroupOwnerContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) RemoveGroupOwnerContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/groups.removeOwner", req, nil)
+}
+
+// AddGroupModerator gives a member the moderator role.
+func (c *Client) AddGroupModerator(roomID, userID string) error {
+	return c.AddGroupModeratorContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) AddGroupModeratorContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/groups.addModerator", req, nil)
+}
+
+// RemoveGroupModerator takes the moderator role from a member.
+func (c *Client) RemoveGroupModerator(roomID, userID string) error {
+	return c.RemoveGroupModeratorContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) RemoveGroupModeratorContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/groups.removeModerator", req, nil)
+}
+
+// AddGroupLeader gives a member the leader role.
+func (c *Client) AddGroupLeader(roomID, userID string) error {
+	return c.AddGroupLeaderContext(context.Background(), roomID, userID)
+}
+
+func (c *Client) AddGroupLeaderContext(ctx context.Context, roomID, userID string) error {
+	req := map[string]string{"roomId": roomID, "userId": userID}
+	return c.c.postStatus(ctx, "/groups.addLeader", req, nil)
+}
@@ -0,0 +1,124 @@
+package rc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestGroupAdmin(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	alice := srv.AddUser("alice", "secret")
+	bob := srv.AddUser("bob", "secret")
+
+	client := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	outsider := New(ServerURL(srv.URL), AccessToken(bob.ID, bob.Token))
+	for _, c := range []*Client{client, outsider} {
+		if err := c.Connect(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	g, err := client.CreateGroup("secret", RoomMembers("alice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.T != RoomTypeGroup || g.U.Username != "bot" {
+		t.Errorf("created %+v", g)
+	}
+
+	if _, err := outsider.GetGroupInfo(g.ID); !IsBadRequest(err) {
+		t.Errorf("non member info: err = %v", err)
+	}
+	if err := outsider.RenameGroup(g.ID, "mine"); !IsBadRequest(err) {
+		t.Errorf("non member rename: err = %v", err)
+	}
+
+	srv.PostMessage(g.ID, "alice", "psst")
+	history, err := client.GetGroupHistory(HistoryQuery{RoomID: g.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Messages) != 1 || history.Messages[0].Text != "psst" {
+		t.Errorf("history = %+v", history.Messages)
+	}
+
+	if err := client.RenameGroup(g.ID, "hush"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddGroupModerator(g.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.AddGroupModerator(g.ID, alice.ID); !IsBadRequest(err) {
+		t.Errorf("duplicate moderator: err = %v", err)
+	}
+	roles, err := client.GetGroupRoles(g.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 2 || roles[1].User.Username != "alice" || roles[1].Roles[0] != "moderator" {
+		t.Errorf("roles = %+v", roles)
+	}
+
+	if err := client.CloseGroup(g.ID); err != nil {
+		t.Fatal(err)
+	}
+	subs, err := client.GetSubscriptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range subs {
+		if s.RoomID == g.ID && s.Open {
+			t.Error("closed group is open")
+		}
+	}
+	if err := client.CloseGroup(g.ID); !IsBadRequest(err) {
+		t.Errorf("closing twice: err = %v", err)
+	}
+	if err := client.OpenGroup(g.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := client.InviteToGroup(g.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	joined, err := outsider.GetJoinedGroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(joined.Groups) != 1 || joined.Groups[0].Name != "hush" {
+		t.Errorf("joined = %+v", joined.Groups)
+	}
+	counters, err := outsider.GetGroupCountersContext(context.Background(), g.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !counters.Joined || counters.Members != 3 || counters.Msgs != 1 {
+		t.Errorf("counters = %+v", counters)
+	}
+
+	if err := client.KickFromGroup(g.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ArchiveGroup(g.ID); err != nil {
+		t.Fatal(err)
+	}
+	info, err := client.GetGroupInfo(g.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "hush" || !info.Archived {
+		t.Errorf("info = %+v", info)
+	}
+
+	if err := client.SetGroupType(g.ID, RoomTypeChannel); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetChannelInfo(g.ID); err != nil {
+		t.Errorf("converted group: %v", err)
+	}
+}
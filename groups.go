@@ -1,51 +1,47 @@
 package rc
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type (
 	GroupList struct {
-		Groups []struct {
-			ID    string `json:"_id"`
-			Name  string `json:"name"`
-			Fname string `json:"fname"`
-			T     string `json:"t"`
-			Msgs  int    `json:"msgs"`
-			U     struct {
-				ID       string `json:"_id"`
-				Username string `json:"username"`
-			} `json:"u"`
-			CustomFields struct {
-				CompanyID string `json:"companyId"`
-			} `json:"customFields"`
-			Ts        time.Time `json:"ts"`
-			Ro        bool      `json:"ro"`
-			SysMes    bool      `json:"sysMes"`
-			UpdatedAt time.Time `json:"_updatedAt"`
-		} `json:"groups"`
-		Offset  int  `json:"offset"`
-		Count   int  `json:"count"`
-		Total   int  `json:"total"`
+		Groups []Group `json:"groups"`
+		Pagination
 		Success bool `json:"success"`
 	}
 
-	GroupMembers struct {
-		Members []struct {
-			ID        string  `json:"_id"`
-			Status    string  `json:"status"`
-			Name      string  `json:"name"`
-			UtcOffset float64 `json:"utcOffset"`
-			Username  string  `json:"username"`
-		} `json:"members"`
-		Count   int  `json:"count"`
-		Offset  int  `json:"offset"`
-		Total   int  `json:"total"`
-		Success bool `json:"success"`
+	Group struct {
+		ID               string       `json:"_id"`
+		Name             string       `json:"name"`
+		Fname            string       `json:"fname"`
+		T                string       `json:"t"`
+		Msgs             int          `json:"msgs"`
+		U                ChannelUser  `json:"u"`
+		CustomFields     CustomFields `json:"customFields"`
+		Ts               time.Time    `json:"ts"`
+		Ro               bool         `json:"ro"`
+		SysMes           bool         `json:"sysMes"`
+		UpdatedAt        time.Time    `json:"_updatedAt"`
+		Topic            string       `json:"topic,omitempty"`
+		Description      string       `json:"description,omitempty"`
+		Announcement     string       `json:"announcement,omitempty"`
+		Archived         bool         `json:"archived,omitempty"`
+		JoinCodeRequired bool         `json:"joinCodeRequired,omitempty"`
 	}
+
+	// GroupMembers shares ChannelMember with channels.members.
+	GroupMembers = ChannelMembers
 )
 
 func (c *Client) GetGroupList() (*GroupList, error) {
+	return c.GetGroupListContext(context.Background())
+}
+
+func (c *Client) GetGroupListContext(ctx context.Context) (*GroupList, error) {
 	glist := &GroupList{}
-	if err := c.c.get("/groups.listAll", nil).JSON(glist); err != nil {
+	if err := c.c.get(ctx, "/groups.listAll", nil).JSON(glist); err != nil {
 		return nil, err
 	}
 
@@ -53,9 +49,13 @@ func (c *Client) GetGroupList() (*GroupList, error) {
 }
 
 func (c *Client) GetGroupMembers(roomID string) (*GroupMembers, error) {
+	return c.GetGroupMembersContext(context.Background(), roomID)
+}
+
+func (c *Client) GetGroupMembersContext(ctx context.Context, roomID string) (*GroupMembers, error) {
 	gmembers := &GroupMembers{}
 	q := query("roomId", roomID)
-	if err := c.c.get("/groups.members", q.Q()).JSON(gmembers); err != nil {
+	if err := c.c.get(ctx, "/groups.members", q.Q()).JSON(gmembers); err != nil {
 		return nil, err
 	}
 
@@ -63,9 +63,13 @@ func (c *Client) GetGroupMembers(roomID string) (*GroupMembers, error) {
 }
 
 func (c *Client) GetGroupMembersByRoomName(roomName string) (*GroupMembers, error) {
+	return c.GetGroupMembersByRoomNameContext(context.Background(), roomName)
+}
+
+func (c *Client) GetGroupMembersByRoomNameContext(ctx context.Context, roomName string) (*GroupMembers, error) {
 	gmembers := &GroupMembers{}
 	q := query("roomName", roomName)
-	if err := c.c.get("/groups.members", q.Q()).JSON(gmembers); err != nil {
+	if err := c.c.get(ctx, "/groups.members", q.Q()).JSON(gmembers); err != nil {
 		return nil, err
 	}
 
@@ -1,6 +1,9 @@
 package rc
 
 import (
+	"context"
+	"net/http"
+
 	"gopkg.in/resty.v1"
 )
 
@@ -10,7 +13,27 @@ type WebHook struct {
 	c *resty.Client
 }
 
-func NewWebHook(url string) *WebHook {
+// WebHookOption is a functional argument that sets optional values on WebHook
+type WebHookOption func(*WebHook)
+
+// WebHookTransport sets the http.RoundTripper used to post to the hook.
+func WebHookTransport(rt http.RoundTripper) WebHookOption {
+	return func(h *WebHook) {
+		h.c.SetTransport(rt)
+	}
+}
+
+// webHookMessage is the payload of an incoming webhook.
+type webHookMessage struct {
+	Channel     string       `json:"channel,omitempty"`
+	Text        string       `json:"text,omitempty"`
+	Alias       string       `json:"alias,omitempty"`
+	Emoji       string       `json:"emoji,omitempty"`
+	Avatar      string       `json:"avatar,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+func NewWebHook(url string, opts ...WebHookOption) *WebHook {
 	r := resty.New()
 	r.HostURL = url
 	h := &WebHook{
@@ -18,12 +41,28 @@ func NewWebHook(url string) *WebHook {
 		c:   r,
 	}
 
+	for _, o := range opts {
+		o(h)
+	}
+
 	return h
 }
 
 func (h *WebHook) Send(msg Message) error {
+	return h.SendContext(context.Background(), msg)
+}
+
+func (h *WebHook) SendContext(ctx context.Context, msg Message) error {
 	_, err := h.c.R().
-		SetBody(msg).
+		SetContext(ctx).
+		SetBody(webHookMessage{
+			Channel:     msg.Channel,
+			Text:        msg.Text,
+			Alias:       msg.Alias,
+			Emoji:       msg.Emoji,
+			Avatar:      msg.Avatar,
+			Attachments: msg.Attachments,
+		}).
 		Post("")
 
 	if err != nil {
@@ -1,10 +1,19 @@
 package rc
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
 func TestWebHook_Send(t *testing.T) {
+	rec := testRecorder(t)
+	defer func() {
+		if err := rec.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
 
 	type args struct {
 		msg Message
@@ -17,7 +26,7 @@ func TestWebHook_Send(t *testing.T) {
 	}{
 		{
 			name: "hook_test",
-			h:    NewWebHook("http://localhost:3000/hooks/pfGsyM2NjiMxntNK9/5wpZd8XMDN2izBeFhkoAeEPjQujgrhZfabJoHi2BA6yr4z5e"),
+			h:    NewWebHook("http://localhost:3000/hooks/pfGsyM2NjiMxntNK9/5wpZd8XMDN2izBeFhkoAeEPjQujgrhZfabJoHi2BA6yr4z5e", WebHookTransport(rec)),
 			args: args{
 				msg: Message{
 					Text:  "this is a test",
@@ -35,3 +44,37 @@ func TestWebHook_Send(t *testing.T) {
 		})
 	}
 }
+
+func TestWebHook_Payload(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+		w.Write([]byte(`{"success":true}`))
+	}))
+	defer srv.Close()
+
+	h := NewWebHook(srv.URL + "/hooks/id/token")
+	err := h.Send(Message{
+		Channel:     "#ops",
+		Text:        "deploy done",
+		Alias:       "ci",
+		Attachments: []Attachment{{Title: "log"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if body["text"] != "deploy done" || body["channel"] != "#ops" || body["alias"] != "ci" {
+		t.Errorf("body = %v", body)
+	}
+	if atts, ok := body["attachments"].([]interface{}); !ok || len(atts) != 1 {
+		t.Errorf("attachments = %v", body["attachments"])
+	}
+	for _, k := range []string{"msg", "u", "ts", "_updatedAt", "tlm"} {
+		if _, ok := body[k]; ok {
+			t.Errorf("body has %q: %v", k, body)
+		}
+	}
+}
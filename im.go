@@ -1,3 +1,185 @@
 package rc
 
 // Direct message API calls
+
+import (
+	"context"
+	"strings"
+)
+
+type IMList struct {
+	IMs []IM `json:"ims"`
+	Pagination
+	Success bool `json:"success"`
+}
+
+// IM is a direct message room. Rooms between two users have the
+// concatenated ids of both users as ID.
+type IM struct {
+	ID        string   `json:"_id"`
+	Type      string   `json:"t"`
+	Usernames []string `json:"usernames"`
+	UserIDs   []string `json:"uids"`
+	Msgs      int64    `json:"msgs"`
+	Timestamp string   `json:"ts"`
+	UpdatedAt string   `json:"_updatedAt"`
+	LM        string   `json:"lm"`
+}
+
+type imEnv struct {
+	Room    IM   `json:"room"`
+	Success bool `json:"success"`
+}
+
+type IMMessages struct {
+	Messages []Message `json:"messages"`
+	Pagination
+	Success bool `json:"success"`
+}
+
+// CreateIM returns the direct message room between the logged in user and
+// usernames, creating it if needed. More than one username creates a
+// multi-user room.
+func (c *Client) CreateIM(usernames ...string) (*IM, error) {
+	return c.CreateIMContext(context.Background(), usernames...)
+}
+
+func (c *Client) CreateIMContext(ctx context.Context, usernames ...string) (*IM, error) {
+	req := map[string]string{}
+	if len(usernames) == 1 {
+		req["username"] = usernames[0]
+	} else {
+		req["usernames"] = strings.Join(usernames, ",")
+	}
+
+	env := &imEnv{}
+	if err := c.c.postStatus(ctx, "/im.create", req, env); err != nil {
+		return nil, err
+	}
+
+	im := env.Room
+	return &im, nil
+}
+
+// DirectMessage sends msg to username, creating the direct message room if
+// needed.
+func (c *Client) DirectMessage(username string, msg Message) (*MessageResult, error) {
+	return c.DirectMessageContext(context.Background(), username, msg)
+}
+
+func (c *Client) DirectMessageContext(ctx context.Context, username string, msg Message) (*MessageResult, error) {
+	im, err := c.CreateIMContext(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	msg.RoomID = im.ID
+	msg.Channel = ""
+	return c.SendMessageContext(ctx, msg)
+}
+
+func (c *Client) GetIMList() (*IMList, error) {
+	return c.GetIMListContext(context.Background())
+}
+
+func (c *Client) GetIMListContext(ctx context.Context) (*IMList, error) {
+	list := &IMList{}
+	if err := c.c.get(ctx, "/im.list", nil).JSON(list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (c *Client) GetIMHistory(q HistoryQuery) (*ChannelHistory, error) {
+	return c.GetIMHistoryContext(context.Background(), q)
+}
+
+func (c *Client) GetIMHistoryContext(ctx context.Context, q HistoryQuery) (*ChannelHistory, error) {
+	history := &ChannelHistory{}
+	if err := c.c.get(ctx, "/im.history", q.Q()).JSON(history); err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// GetIMMessages returns a page of messages, newest first. q may be nil.
+func (c *Client) GetIMMessages(roomID string, q *Query) (*IMMessages, error) {
+	return c.GetIMMessagesContext(context.Background(), roomID, q)
+}
+
+func (c *Client) GetIMMessagesContext(ctx context.Context, roomID string, q *Query) (*IMMessages, error) {
+	if q == nil {
+		q = NewQuery()
+	}
+	vals := q.URLValues()
+	vals.Set("roomId", roomID)
+
+	msgs := &IMMessages{}
+	if err := c.c.get(ctx, "/im.messages", vals).JSON(msgs); err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+func (c *Client) GetIMMembers(roomID string) (*ChannelMembers, error) {
+	return c.GetIMMembersContext(context.Background(), roomID)
+}
+
+func (c *Client) GetIMMembersContext(ctx context.Context, roomID string) (*ChannelMembers, error) {
+	members := &ChannelMembers{}
+	q := query("roomId", roomID)
+	if err := c.c.get(ctx, "/im.members", q.Q()).JSON(members); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (c *Client) GetIMCounters(roomID string) (*ChannelCounters, error) {
+	return c.GetIMCountersContext(context.Background(), roomID)
+}
+
+func (c *Client) GetIMCountersContext(ctx context.Context, roomID string) (*ChannelCounters, error) {
+	counters := &ChannelCounters{}
+	q := query("roomId", roomID)
+	if err := c.c.get(ctx, "/im.counters", q.Q()).JSON(counters); err != nil {
+		return nil, err
+	}
+
+	return counters, nil
+}
+
+// GetIMFiles returns a page of the files uploaded to a direct message room,
+// newest first. q may be nil.
+func (c *Client) GetIMFiles(roomID string, q *Query) (*FileList, error) {
+	return c.GetIMFilesContext(context.Background(), roomID, q)
+}
+
+func (c *Client) GetIMFilesContext(ctx context.Context, roomID string, q *Query) (*FileList, error) {
+	return c.roomFiles(ctx, "/im.files", roomID, q)
+}
+
+// OpenIM shows a closed direct message room in the room list of the logged
+// in user.
+func (c *Client) OpenIM(roomID string) error {
+	return c.OpenIMContext(context.Background(), roomID)
+}
+
+func (c *Client) OpenIMContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/im.open", req, nil)
+}
+
+// CloseIM hides a direct message room from the room list of the logged in
+// user.
+func (c *Client) CloseIM(roomID string) error {
+	return c.CloseIMContext(context.Background(), roomID)
+}
+
+func (c *Client) CloseIMContext(ctx context.Context, roomID string) error {
+	req := map[string]string{"roomId": roomID}
+	return c.c.postStatus(ctx, "/im.close", req, nil)
+}
@@ -0,0 +1,110 @@
+package rc
+
+import (
+	"testing"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestDirectMessages(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	alice := srv.AddUser("alice", "secret")
+	srv.AddUser("bob", "secret")
+
+	client := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, text := range []string{"disk full", "disk ok"} {
+		if _, err := client.DirectMessage("alice", Message{Text: text}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := client.GetIMList()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list.IMs) != 1 {
+		t.Fatalf("got %d rooms, want 1", len(list.IMs))
+	}
+	im := list.IMs[0]
+	if im.Type != RoomTypeDirect || len(im.UserIDs) != 2 {
+		t.Errorf("im = %+v", im)
+	}
+	if msgs := srv.Messages(im.ID); len(msgs) != 2 || msgs[0].Username != "bot" {
+		t.Errorf("messages = %+v", msgs)
+	}
+
+	history, err := client.GetIMHistory(HistoryQuery{RoomID: im.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history.Messages) != 2 || history.Messages[0].Text != "disk ok" {
+		t.Errorf("history = %+v", history.Messages)
+	}
+	page, err := client.GetIMMessages(im.ID, NewQuery().Count(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Messages) != 1 || page.Total != 2 {
+		t.Errorf("page = %+v", page)
+	}
+
+	members, err := client.GetIMMembers(im.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if members.Total != 2 {
+		t.Errorf("members = %+v", members)
+	}
+	counters, err := client.GetIMCounters(im.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counters.Msgs != 2 || !counters.Joined {
+		t.Errorf("counters = %+v", counters)
+	}
+
+	srv.AddFile(im.ID, "alice", "df.txt", "text/plain", []byte("/dev/sda1 100%"))
+	files, err := client.GetIMFiles(im.ID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files.Files) != 1 || files.Files[0].Name != "df.txt" || files.Files[0].User.ID != alice.ID || files.Files[0].Size != 14 {
+		t.Errorf("files = %+v", files.Files)
+	}
+
+	if err := client.CloseIM(im.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CloseIM(im.ID); !IsBadRequest(err) {
+		t.Errorf("closing twice: err = %v", err)
+	}
+	if err := client.OpenIM(im.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	group, err := client.CreateIM("alice", "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if group.ID == im.ID || len(group.Usernames) != 3 {
+		t.Errorf("multi-user room = %+v", group)
+	}
+	again, err := client.CreateIM("bob", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != group.ID {
+		t.Errorf("CreateIM created %s, want existing %s", again.ID, group.ID)
+	}
+
+	if _, err := client.CreateIM("nobody"); !IsBadRequest(err) {
+		t.Errorf("unknown user: err = %v", err)
+	}
+}
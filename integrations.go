@@ -1,5 +1,7 @@
 package rc
 
+import "context"
+
 type IntegrationEvent string
 
 const (
@@ -133,8 +135,12 @@ type IntegrationCreatedBy struct {
 }
 
 func (c *Client) CreateIntegration(i *Integration) (*IntegrationInfo, error) {
+	return c.CreateIntegrationContext(context.Background(), i)
+}
+
+func (c *Client) CreateIntegrationContext(ctx context.Context, i *Integration) (*IntegrationInfo, error) {
 	result := &IntegrationResponse{}
-	if err := c.c.postJSON("/integrations.create", i).JSON(result); err != nil {
+	if err := c.c.postJSON(ctx, "/integrations.create", i).JSON(result); err != nil {
 		return nil, err
 	}
 	info := result.Integration
@@ -142,8 +148,12 @@ func (c *Client) CreateIntegration(i *Integration) (*IntegrationInfo, error) {
 }
 
 func (c *Client) GetIntegrations() ([]IntegrationInfo, error) {
+	return c.GetIntegrationsContext(context.Background())
+}
+
+func (c *Client) GetIntegrationsContext(ctx context.Context) ([]IntegrationInfo, error) {
 	is := &IntegrationList{}
-	if err := c.c.get("/integrations.list", nil).JSON(is); err != nil {
+	if err := c.c.get(ctx, "/integrations.list", nil).JSON(is); err != nil {
 		return nil, err
 	}
 	result := is.Integrations
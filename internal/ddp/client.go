@@ -0,0 +1,645 @@
+package ddp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Client is a DDP client connection. Method calls and subscriptions may be
+// used from multiple goroutines.
+type Client struct {
+	// HeartbeatInterval is the idle time after which a ping is sent.
+	HeartbeatInterval time.Duration
+	// HeartbeatTimeout is how long to wait for traffic after a ping before
+	// the connection is considered lost.
+	HeartbeatTimeout time.Duration
+	// ReconnectInterval is the delay before the first attempt to reconnect a
+	// lost connection. It doubles after every failed attempt up to
+	// MaxReconnectInterval. Zero disables automatic reconnection.
+	ReconnectInterval time.Duration
+	// MaxReconnectInterval caps the delay between reconnect attempts.
+	MaxReconnectInterval time.Duration
+	// OnReconnect, when set, is called once a lost connection has been
+	// re-established and before subscriptions are resent, for example to
+	// log in again. If it fails the connection is dropped and retried.
+	OnReconnect func(ctx context.Context) error
+
+	// Logf, when set, receives every frame read from or written to the socket.
+	Logf func(msg string, keysAndValues ...interface{})
+	// Observe, when set, is called with every frame read from or written to
+	// the socket. It must not block.
+	Observe func(outgoing bool, frame []byte)
+
+	url    string
+	origin string
+	dialer *Dialer
+
+	nextID uint64
+
+	writeMu sync.Mutex
+
+	mu              sync.Mutex
+	conn            *conn
+	session         string
+	status          int
+	closed          bool
+	calls           map[string]*Call
+	subs            map[string]*Call
+	collections     map[string]*Collection
+	statusListeners []StatusListener
+	reconnectTimer  *time.Timer
+	attempts        uint
+
+	// reconnects run with ctx, which is cancelled by Close, and are
+	// tracked by reconnecting so Close can wait for them.
+	ctx          context.Context
+	cancel       context.CancelFunc
+	reconnecting sync.WaitGroup
+}
+
+// conn is a single websocket connection. A Client moves to a new conn on
+// every reconnect.
+type conn struct {
+	ws        *websocket.Conn
+	connected chan struct{}
+	done      chan struct{}
+	lastRead  int64
+	once      sync.Once
+	err       error
+}
+
+func (cn *conn) setConnected() {
+	cn.once.Do(func() {
+		close(cn.connected)
+	})
+}
+
+func (cn *conn) isConnected() bool {
+	select {
+	case <-cn.connected:
+		return true
+	default:
+		return false
+	}
+}
+
+// NewClient creates a client for the websocket at url. If dialer is nil the
+// zero Dialer is used. The connection is not opened until Connect.
+func NewClient(url, origin string, dialer *Dialer) *Client {
+	if dialer == nil {
+		dialer = &Dialer{}
+	}
+
+	return &Client{
+		HeartbeatInterval:    time.Minute,
+		HeartbeatTimeout:     15 * time.Second,
+		ReconnectInterval:    time.Second,
+		MaxReconnectInterval: time.Minute,
+		url:                  url,
+		origin:               origin,
+		dialer:               dialer,
+		status:               DISCONNECTED,
+		calls:                make(map[string]*Call),
+		subs:                 make(map[string]*Call),
+		collections:          make(map[string]*Collection),
+	}
+}
+
+// Connect dials the server and waits for the DDP session to be established.
+func (c *Client) Connect(ctx context.Context) error {
+	c.mu.Lock()
+	c.closed = false
+	if c.cancel == nil {
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+	}
+	c.mu.Unlock()
+
+	return c.connect(ctx, false)
+}
+
+// Reconnect drops the current connection and dials a new one, resending
+// active subscriptions.
+func (c *Client) Reconnect(ctx context.Context) error {
+	c.mu.Lock()
+	c.stopReconnect()
+	cn := c.conn
+	c.mu.Unlock()
+
+	if cn != nil {
+		c.drop(cn)
+		cn.ws.Close()
+		<-cn.done
+	}
+
+	return c.connect(ctx, true)
+}
+
+// Close closes the connection and stops all goroutines started by the
+// client, waiting for a reconnect in progress to give up. Pending calls and
+// subscriptions that are not ready yet fail with ErrDisconnected.
+func (c *Client) Close() {
+	c.mu.Lock()
+	c.closed = true
+	c.stopReconnect()
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+	cn := c.conn
+	c.mu.Unlock()
+
+	if cn != nil {
+		c.drop(cn)
+		cn.ws.Close()
+		<-cn.done
+	}
+	c.reconnecting.Wait()
+	c.failPendingSubs()
+	c.setStatus(DISCONNECTED)
+}
+
+// stopReconnect cancels a scheduled reconnect. c.mu must be held.
+func (c *Client) stopReconnect() {
+	if c.reconnectTimer != nil {
+		if c.reconnectTimer.Stop() {
+			c.reconnecting.Done()
+		}
+		c.reconnectTimer = nil
+	}
+}
+
+// Session returns the session id of the current connection.
+func (c *Client) Session() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.session
+}
+
+// Status returns the current connection status.
+func (c *Client) Status() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// AddStatusListener registers a listener for connection status changes.
+func (c *Client) AddStatusListener(listener StatusListener) {
+	c.mu.Lock()
+	c.statusListeners = append(c.statusListeners, listener)
+	c.mu.Unlock()
+}
+
+// CollectionByName returns the named collection, creating it if needed.
+func (c *Client) CollectionByName(name string) *Collection {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	coll, ok := c.collections[name]
+	if !ok {
+		coll = newCollection(name)
+		c.collections[name] = coll
+	}
+	return coll
+}
+
+// Go invokes a method asynchronously. Done is signaled with the call when
+// the result arrives. If done is nil a buffered channel is allocated.
+func (c *Client) Go(serviceMethod string, done chan *Call, args ...interface{}) *Call {
+	call := c.newCall(serviceMethod, done, args)
+
+	c.mu.Lock()
+	c.calls[call.ID] = call
+	c.mu.Unlock()
+
+	if err := c.Send(&method{
+		Message:       Message{Type: "method", ID: call.ID},
+		ServiceMethod: serviceMethod,
+		Args:          call.Args,
+	}); err != nil {
+		c.mu.Lock()
+		delete(c.calls, call.ID)
+		c.mu.Unlock()
+		call.Error = err
+		call.done()
+	}
+
+	return call
+}
+
+// Call invokes a method and waits for the result.
+func (c *Client) Call(serviceMethod string, args ...interface{}) (interface{}, error) {
+	call := <-c.Go(serviceMethod, make(chan *Call, 1), args...).Done
+	return call.Reply, call.Error
+}
+
+// Subscribe sends a subscription request. Done is signaled when the
+// subscription is ready. Subscriptions are resent after a reconnect.
+func (c *Client) Subscribe(subName string, done chan *Call, args ...interface{}) *Call {
+	call := c.newCall(subName, done, args)
+
+	c.mu.Lock()
+	c.subs[call.ID] = call
+	c.mu.Unlock()
+
+	if err := c.Send(&sub{
+		Message: Message{Type: "sub", ID: call.ID},
+		SubName: subName,
+		Args:    call.Args,
+	}); err != nil {
+		c.mu.Lock()
+		delete(c.subs, call.ID)
+		c.mu.Unlock()
+		call.Error = err
+		call.done()
+	}
+
+	return call
+}
+
+// Unsubscribe stops the subscription with the given id. It is not resent
+// after a reconnect. Unknown ids are ignored.
+func (c *Client) Unsubscribe(id string) error {
+	c.mu.Lock()
+	_, ok := c.subs[id]
+	delete(c.subs, id)
+	c.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return c.Send(&Message{Type: "unsub", ID: id})
+}
+
+// Sub subscribes and waits until the subscription is ready.
+func (c *Client) Sub(subName string, args ...interface{}) error {
+	call := <-c.Subscribe(subName, make(chan *Call, 1), args...).Done
+	return call.Error
+}
+
+// Send writes a message to the socket as json.
+func (c *Client) Send(msg interface{}) error {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	cn := c.conn
+	c.mu.Unlock()
+	if cn == nil {
+		return ErrDisconnected
+	}
+
+	if c.Logf != nil {
+		c.Logf("ddp_send", "frame", string(b))
+	}
+	if c.Observe != nil {
+		c.Observe(true, b)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return websocket.Message.Send(cn.ws, string(b))
+}
+
+func (c *Client) newCall(name string, done chan *Call, args []interface{}) *Call {
+	if args == nil {
+		args = []interface{}{}
+	}
+	if done == nil {
+		done = make(chan *Call, 10)
+	} else if cap(done) == 0 {
+		panic("ddp: done channel is unbuffered")
+	}
+
+	return &Call{
+		ID:            strconv.FormatUint(atomic.AddUint64(&c.nextID, 1), 16),
+		ServiceMethod: name,
+		Args:          args,
+		Done:          done,
+	}
+}
+
+// connect dials a new connection. When reconnecting, OnReconnect runs
+// before the subscriptions are resent.
+func (c *Client) connect(ctx context.Context, reconnect bool) error {
+	c.setStatus(DIALING)
+	ws, err := c.dialer.Dial(ctx, c.url, c.origin)
+	if err != nil {
+		c.setStatus(DISCONNECTED)
+		return err
+	}
+
+	cn := &conn{
+		ws:        ws,
+		connected: make(chan struct{}),
+		done:      make(chan struct{}),
+		lastRead:  time.Now().UnixNano(),
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		ws.Close()
+		return ErrDisconnected
+	}
+	c.conn = cn
+	session := c.session
+	c.mu.Unlock()
+
+	c.setStatus(CONNECTING)
+	go c.read(cn)
+	go c.heartbeat(cn)
+
+	if err := c.Send(&connect{
+		Message: Message{Type: "connect"},
+		Version: "1",
+		Support: []string{"1"},
+		Session: session,
+	}); err != nil {
+		cn.ws.Close()
+		return err
+	}
+
+	select {
+	case <-cn.connected:
+	case <-cn.done:
+		if cn.err != nil {
+			return cn.err
+		}
+		return ErrDisconnected
+	case <-ctx.Done():
+		cn.ws.Close()
+		return ctx.Err()
+	}
+
+	if reconnect && c.OnReconnect != nil {
+		if err := c.OnReconnect(ctx); err != nil {
+			c.drop(cn)
+			cn.ws.Close()
+			<-cn.done
+			c.setStatus(DISCONNECTED)
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.attempts = 0
+	subs := make([]*Call, 0, len(c.subs))
+	for _, s := range c.subs {
+		subs = append(subs, s)
+	}
+	c.mu.Unlock()
+
+	for _, s := range subs {
+		c.Send(&sub{
+			Message: Message{Type: "sub", ID: s.ID},
+			SubName: s.ServiceMethod,
+			Args:    s.Args,
+		})
+	}
+
+	c.setStatus(CONNECTED)
+	return nil
+}
+
+// drop detaches cn from the client and fails the calls in flight on it.
+// It reports whether cn was the current connection.
+func (c *Client) drop(cn *conn) bool {
+	c.mu.Lock()
+	if c.conn != cn {
+		c.mu.Unlock()
+		return false
+	}
+	c.conn = nil
+	calls := c.calls
+	c.calls = make(map[string]*Call)
+	c.mu.Unlock()
+
+	for _, call := range calls {
+		call.Error = ErrDisconnected
+		call.done()
+	}
+	return true
+}
+
+func (c *Client) lost(cn *conn) {
+	if !c.drop(cn) {
+		return
+	}
+	c.setStatus(DISCONNECTED)
+
+	if !cn.isConnected() || !c.reconnectLater() {
+		c.failPendingSubs()
+	}
+}
+
+// failPendingSubs fails the subscriptions that are not ready yet, which
+// would otherwise wait for a connection that is not coming back.
+func (c *Client) failPendingSubs() {
+	c.mu.Lock()
+	var pending []*Call
+	for id, s := range c.subs {
+		if !s.ready {
+			pending = append(pending, s)
+			delete(c.subs, id)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, s := range pending {
+		s.Error = ErrDisconnected
+		s.done()
+	}
+}
+
+// reconnectLater schedules a reconnect and reports whether one is pending.
+func (c *Client) reconnectLater() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed || c.ReconnectInterval <= 0 {
+		return false
+	}
+	if c.reconnectTimer != nil {
+		return true
+	}
+
+	delay := backoff(c.ReconnectInterval, c.MaxReconnectInterval, c.attempts)
+	c.attempts++
+
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	c.reconnecting.Add(1)
+	c.reconnectTimer = time.AfterFunc(delay, func() {
+		defer c.reconnecting.Done()
+
+		c.mu.Lock()
+		c.reconnectTimer = nil
+		closed := c.closed
+		c.mu.Unlock()
+
+		if closed {
+			return
+		}
+		if err := c.connect(ctx, true); err != nil {
+			if c.Logf != nil {
+				c.Logf("ddp_reconnect_failed", "error", err)
+			}
+			c.reconnectLater()
+		}
+	})
+	return true
+}
+
+// backoff doubles min for every attempt up to max and adds up to 20%
+// jitter so many clients do not reconnect in lockstep.
+func backoff(min, max time.Duration, attempt uint) time.Duration {
+	d := min
+	for i := uint(0); i < attempt && (max <= 0 || d < max); i++ {
+		d *= 2
+	}
+	if max > 0 && d > max {
+		d = max
+	}
+	return d + time.Duration(rand.Int63n(int64(d)/5+1))
+}
+
+func (c *Client) read(cn *conn) {
+	defer close(cn.done)
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(cn.ws, &data); err != nil {
+			c.lost(cn)
+			return
+		}
+		atomic.StoreInt64(&cn.lastRead, time.Now().UnixNano())
+
+		if c.Logf != nil {
+			c.Logf("ddp_recv", "frame", string(data))
+		}
+		if c.Observe != nil {
+			c.Observe(false, data)
+		}
+
+		msg := map[string]interface{}{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+		c.dispatch(cn, msg)
+	}
+}
+
+func (c *Client) heartbeat(cn *conn) {
+	if c.HeartbeatInterval <= 0 {
+		return
+	}
+
+	t := time.NewTicker(c.HeartbeatInterval / 2)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-cn.done:
+			return
+		case <-t.C:
+			idle := time.Since(time.Unix(0, atomic.LoadInt64(&cn.lastRead)))
+			if idle > c.HeartbeatInterval+c.HeartbeatTimeout {
+				cn.ws.Close()
+				return
+			}
+			if idle > c.HeartbeatInterval {
+				c.Send(&Message{Type: "ping"})
+			}
+		}
+	}
+}
+
+func (c *Client) dispatch(cn *conn, msg map[string]interface{}) {
+	mtype, _ := msg["msg"].(string)
+	id, _ := msg["id"].(string)
+
+	switch mtype {
+	case "connected":
+		c.mu.Lock()
+		c.session, _ = msg["session"].(string)
+		c.mu.Unlock()
+		cn.setConnected()
+	case "failed":
+		cn.err = fmt.Errorf("ddp: server does not support version 1 (wants %v)", msg["version"])
+		cn.ws.Close()
+	case "ping":
+		c.Send(&Message{Type: "pong", ID: id})
+	case "pong":
+	case "nosub":
+		c.mu.Lock()
+		call, ok := c.subs[id]
+		delete(c.subs, id)
+		c.mu.Unlock()
+		if ok {
+			call.Error = ErrNoSub
+			if e, ok := msg["error"]; ok {
+				call.Error = newError(e)
+			}
+			call.done()
+		}
+	case "ready":
+		ids, _ := msg["subs"].([]interface{})
+		for _, v := range ids {
+			sid, _ := v.(string)
+			c.mu.Lock()
+			call, ok := c.subs[sid]
+			if ok {
+				call.ready = true
+			}
+			c.mu.Unlock()
+			if ok {
+				call.done()
+			}
+		}
+	case "added", "changed", "removed":
+		if name, ok := msg["collection"].(string); ok {
+			c.CollectionByName(name).update(mtype, msg)
+		}
+	case "result":
+		c.mu.Lock()
+		call, ok := c.calls[id]
+		delete(c.calls, id)
+		c.mu.Unlock()
+		if ok {
+			if e, ok := msg["error"]; ok && e != nil {
+				call.Error = newError(e)
+				call.Reply = e
+			} else {
+				call.Reply = msg["result"]
+			}
+			call.done()
+		}
+	}
+}
+
+func (c *Client) setStatus(status int) {
+	c.mu.Lock()
+	if c.status == status {
+		c.mu.Unlock()
+		return
+	}
+	c.status = status
+	listeners := make([]StatusListener, len(c.statusListeners))
+	copy(listeners, c.statusListeners)
+	c.mu.Unlock()
+
+	for _, l := range listeners {
+		l.Status(status)
+	}
+}
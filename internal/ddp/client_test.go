@@ -0,0 +1,404 @@
+package ddp
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// testServer is a minimal DDP server. Method "echo" returns its params,
+// "fail" returns an error and "hang" never answers. Subscriptions publish
+// one document to a collection of their name and become ready, except
+// "hang" which never does.
+type testServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	conns    []*websocket.Conn
+	sessions int
+	noPong   bool
+	frames   []map[string]interface{}
+	changed  chan struct{}
+}
+
+func newTestServer(secure bool) *testServer {
+	s := &testServer{changed: make(chan struct{}, 1)}
+	s.Server = httptest.NewUnstartedServer(websocket.Handler(s.serve))
+	// Rejected handshakes are expected.
+	s.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	if secure {
+		s.StartTLS()
+	} else {
+		s.Start()
+	}
+	return s
+}
+
+func (s *testServer) url() string {
+	u := strings.Replace(s.URL, "https://", "wss://", 1)
+	return strings.Replace(u, "http://", "ws://", 1) + "/websocket"
+}
+
+func (s *testServer) serve(ws *websocket.Conn) {
+	s.mu.Lock()
+	s.conns = append(s.conns, ws)
+	s.mu.Unlock()
+
+	send := func(v map[string]interface{}) {
+		websocket.JSON.Send(ws, v)
+	}
+
+	for {
+		var msg map[string]interface{}
+		if err := websocket.JSON.Receive(ws, &msg); err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.frames = append(s.frames, msg)
+		noPong := s.noPong
+		s.mu.Unlock()
+		select {
+		case s.changed <- struct{}{}:
+		default:
+		}
+
+		id, _ := msg["id"].(string)
+		switch msg["msg"] {
+		case "connect":
+			s.mu.Lock()
+			s.sessions++
+			session := "session-" + strconv.Itoa(s.sessions)
+			s.mu.Unlock()
+			send(map[string]interface{}{"msg": "connected", "session": session})
+		case "ping":
+			if !noPong {
+				send(map[string]interface{}{"msg": "pong", "id": id})
+			}
+		case "method":
+			switch msg["method"] {
+			case "echo":
+				send(map[string]interface{}{"msg": "result", "id": id, "result": msg["params"]})
+			case "fail":
+				send(map[string]interface{}{"msg": "result", "id": id, "error": map[string]interface{}{"error": 400, "reason": "bad"}})
+			}
+		case "sub":
+			name, _ := msg["name"].(string)
+			if name == "hang" {
+				continue
+			}
+			send(map[string]interface{}{"msg": "added", "collection": name, "id": "doc", "fields": map[string]interface{}{"n": 1}})
+			send(map[string]interface{}{"msg": "ready", "subs": []interface{}{id}})
+		case "unsub":
+			send(map[string]interface{}{"msg": "nosub", "id": id})
+		}
+	}
+}
+
+// drop closes every open connection.
+func (s *testServer) drop() {
+	s.mu.Lock()
+	conns := s.conns
+	s.conns = nil
+	s.mu.Unlock()
+	for _, ws := range conns {
+		ws.Close()
+	}
+}
+
+// waitFrame waits for the n-th frame, counting from one, that matches.
+func (s *testServer) waitFrame(t *testing.T, n int, match func(map[string]interface{}) bool) map[string]interface{} {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		s.mu.Lock()
+		seen := 0
+		for _, f := range s.frames {
+			if match(f) {
+				seen++
+				if seen == n {
+					s.mu.Unlock()
+					return f
+				}
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.changed:
+		case <-time.After(10 * time.Millisecond):
+		case <-timeout:
+			t.Fatalf("timed out waiting for frame %d", n)
+		}
+	}
+}
+
+func frameType(typ string) func(map[string]interface{}) bool {
+	return func(f map[string]interface{}) bool { return f["msg"] == typ }
+}
+
+type statusFunc func(int)
+
+func (f statusFunc) Status(status int) { f(status) }
+
+type listenerFunc func(collection, operation, id string, doc Update)
+
+func (f listenerFunc) CollectionUpdate(collection, operation, id string, doc Update) {
+	f(collection, operation, id, doc)
+}
+
+// statuses returns a channel receiving every status change of c.
+func statuses(c *Client) <-chan int {
+	ch := make(chan int, 100)
+	c.AddStatusListener(statusFunc(func(s int) { ch <- s }))
+	return ch
+}
+
+func waitStatus(t *testing.T, ch <-chan int, want int) {
+	t.Helper()
+	for {
+		select {
+		case s := <-ch:
+			if s == want {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for status %d", want)
+		}
+	}
+}
+
+// connectClient connects to s, reconnecting after interval if the
+// connection is lost.
+func connectClient(t *testing.T, s *testServer, d *Dialer, interval time.Duration) *Client {
+	t.Helper()
+	c := NewClient(s.url(), "http://localhost", d)
+	c.ReconnectInterval = interval
+	c.MaxReconnectInterval = interval
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCall(t *testing.T) {
+	s := newTestServer(false)
+	defer s.Close()
+	c := connectClient(t, s, nil, 10*time.Millisecond)
+	defer c.Close()
+
+	if c.Status() != CONNECTED || c.Session() != "session-1" {
+		t.Errorf("status %d, session %q", c.Status(), c.Session())
+	}
+
+	res, err := c.Call("echo", "a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(res); string(b) != `["a",1]` {
+		t.Errorf("echo = %s", b)
+	}
+
+	_, err = c.Call("fail")
+	if e, ok := err.(*Error); !ok || e.Reason != "bad" {
+		t.Errorf("fail err = %v", err)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	s := newTestServer(false)
+	defer s.Close()
+	c := connectClient(t, s, nil, 10*time.Millisecond)
+	defer c.Close()
+
+	docs := make(chan string, 10)
+	c.CollectionByName("stream").AddUpdateListener(listenerFunc(func(coll, op, id string, doc Update) {
+		docs <- coll + "/" + op + "/" + id
+	}))
+
+	if err := c.Sub("stream", "room"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case d := <-docs:
+		if d != "stream/create/doc" {
+			t.Errorf("update %s", d)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for document")
+	}
+}
+
+func TestDisconnectFailsCalls(t *testing.T) {
+	s := newTestServer(false)
+	defer s.Close()
+	c := connectClient(t, s, nil, 0)
+	defer c.Close()
+
+	call := c.Go("hang", nil)
+	pending := c.Subscribe("hang", nil)
+	s.waitFrame(t, 1, func(f map[string]interface{}) bool { return f["name"] == "hang" })
+
+	s.drop()
+	for _, done := range []chan *Call{call.Done, pending.Done} {
+		select {
+		case res := <-done:
+			if res.Error != ErrDisconnected {
+				t.Errorf("%s err = %v, want ErrDisconnected", res.ServiceMethod, res.Error)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("call not failed on disconnect")
+		}
+	}
+
+	// Without a connection calls and subscriptions fail at once.
+	if _, err := c.Call("echo"); err != ErrDisconnected {
+		t.Errorf("Call err = %v", err)
+	}
+	if err := c.Sub("stream"); err != ErrDisconnected {
+		t.Errorf("Sub err = %v", err)
+	}
+}
+
+func TestCloseFailsPendingSubs(t *testing.T) {
+	s := newTestServer(false)
+	defer s.Close()
+	c := connectClient(t, s, nil, 10*time.Millisecond)
+	defer c.Close()
+
+	pending := c.Subscribe("hang", nil)
+	s.waitFrame(t, 1, func(f map[string]interface{}) bool { return f["name"] == "hang" })
+
+	c.Close()
+	select {
+	case res := <-pending.Done:
+		if res.Error != ErrDisconnected {
+			t.Errorf("err = %v, want ErrDisconnected", res.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("subscription not failed on Close")
+	}
+}
+
+func TestResubscribe(t *testing.T) {
+	s := newTestServer(false)
+	defer s.Close()
+	c := NewClient(s.url(), "http://localhost", nil)
+	c.ReconnectInterval = 10 * time.Millisecond
+	// OnReconnect logs in again before subscriptions are resent.
+	c.OnReconnect = func(ctx context.Context) error {
+		_, err := c.Call("echo", "login")
+		return err
+	}
+	states := statuses(c)
+
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if err := c.Sub("kept", "a"); err != nil {
+		t.Fatal(err)
+	}
+	dropped := c.Subscribe("dropped", nil)
+	if res := <-dropped.Done; res.Error != nil {
+		t.Fatal(res.Error)
+	}
+	if err := c.Unsubscribe(dropped.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.waitFrame(t, 1, frameType("unsub"))
+
+	s.drop()
+	waitStatus(t, states, DISCONNECTED)
+	waitStatus(t, states, CONNECTED)
+
+	connect := s.waitFrame(t, 2, frameType("connect"))
+	if connect["session"] != "session-1" {
+		t.Errorf("reconnect sent session %v", connect["session"])
+	}
+	first := s.waitFrame(t, 1, func(f map[string]interface{}) bool { return f["name"] == "kept" })
+	again := s.waitFrame(t, 2, func(f map[string]interface{}) bool { return f["name"] == "kept" })
+	if again["id"] != first["id"] {
+		t.Errorf("resubscribed as %v, want %v", again["id"], first["id"])
+	}
+	if b, _ := json.Marshal(again["params"]); string(b) != `["a"]` {
+		t.Errorf("resubscribed with %s", b)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var seq []string
+	for _, f := range s.frames {
+		switch {
+		case f["msg"] == "connect":
+			seq = append(seq, "connect")
+		case f["msg"] == "method":
+			seq = append(seq, "login")
+		case f["msg"] == "sub":
+			seq = append(seq, f["name"].(string))
+		}
+	}
+	if got := strings.Join(seq, " "); got != "connect kept dropped connect login kept" {
+		t.Errorf("frames = %s", got)
+	}
+}
+
+func TestHeartbeatTimeout(t *testing.T) {
+	s := newTestServer(false)
+	defer s.Close()
+	s.noPong = true
+
+	c := NewClient(s.url(), "http://localhost", nil)
+	c.HeartbeatInterval = 50 * time.Millisecond
+	c.HeartbeatTimeout = 50 * time.Millisecond
+	c.ReconnectInterval = 0
+	states := statuses(c)
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s.waitFrame(t, 1, frameType("ping"))
+	waitStatus(t, states, DISCONNECTED)
+	if c.Status() != DISCONNECTED {
+		t.Errorf("status = %d", c.Status())
+	}
+}
+
+func TestHeartbeatKeepsConnection(t *testing.T) {
+	s := newTestServer(false)
+	defer s.Close()
+
+	c := NewClient(s.url(), "http://localhost", nil)
+	c.HeartbeatInterval = 50 * time.Millisecond
+	c.HeartbeatTimeout = 50 * time.Millisecond
+	if err := c.Connect(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	s.waitFrame(t, 3, frameType("ping"))
+	if c.Status() != CONNECTED || c.Session() != "session-1" {
+		t.Errorf("status %d, session %q after pongs", c.Status(), c.Session())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt, want := range []time.Duration{100, 200, 400, 500, 500} {
+		d := backoff(100*time.Millisecond, 500*time.Millisecond, uint(attempt))
+		min := want * time.Millisecond
+		if d < min || d > min+min/5 {
+			t.Errorf("attempt %d: %v, want %v plus jitter", attempt, d, min)
+		}
+	}
+}
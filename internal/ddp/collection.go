@@ -0,0 +1,68 @@
+package ddp
+
+import "sync"
+
+// Update is a document sent by the server in a livedata message.
+type Update map[string]interface{}
+
+// UpdateListener receives the documents published to a collection.
+type UpdateListener interface {
+	CollectionUpdate(collection, operation, id string, doc Update)
+}
+
+// Collection dispatches livedata messages for a named collection to its
+// listeners. Rocket.Chat streams are not cached so no documents are kept.
+type Collection struct {
+	name string
+
+	mu        sync.Mutex
+	listeners []UpdateListener
+}
+
+func newCollection(name string) *Collection {
+	return &Collection{name: name}
+}
+
+// AddUpdateListener adds a listener for updates on the collection.
+func (c *Collection) AddUpdateListener(listener UpdateListener) {
+	c.mu.Lock()
+	c.listeners = append(c.listeners, listener)
+	c.mu.Unlock()
+}
+
+// RemoveUpdateListener removes a listener previously added.
+func (c *Collection) RemoveUpdateListener(listener UpdateListener) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, l := range c.listeners {
+		if l == listener {
+			c.listeners = append(c.listeners[:i], c.listeners[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *Collection) notify(operation, id string, doc Update) {
+	c.mu.Lock()
+	listeners := make([]UpdateListener, len(c.listeners))
+	copy(listeners, c.listeners)
+	c.mu.Unlock()
+
+	for _, l := range listeners {
+		l.CollectionUpdate(c.name, operation, id, doc)
+	}
+}
+
+func (c *Collection) update(msgType string, msg map[string]interface{}) {
+	id, _ := msg["id"].(string)
+	fields, _ := msg["fields"].(map[string]interface{})
+
+	switch msgType {
+	case "added":
+		c.notify("create", id, Update(fields))
+	case "changed":
+		c.notify("update", id, Update(fields))
+	case "removed":
+		c.notify("remove", id, nil)
+	}
+}
@@ -0,0 +1,107 @@
+// Package ddp implements the subset of the Meteor DDP protocol used by the
+// Rocket.Chat realtime api. It follows the shape of github.com/gopackage/ddp
+// but lets the caller control how the websocket is dialed and shut down.
+package ddp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Connection states reported to StatusListeners.
+const (
+	DISCONNECTED = iota
+	DIALING
+	CONNECTING
+	CONNECTED
+)
+
+// ErrDisconnected is returned for calls and subscriptions that were in
+// flight when the connection was lost or closed.
+var ErrDisconnected = errors.New("ddp: disconnected")
+
+// ErrNoSub is returned when the server stops a subscription without an error.
+var ErrNoSub = errors.New("ddp: subscription stopped by server")
+
+// StatusListener is informed when the connection status changes.
+type StatusListener interface {
+	Status(status int)
+}
+
+// Error is a method or subscription error returned by the server.
+type Error struct {
+	Code      interface{} `json:"error"`
+	Reason    string      `json:"reason"`
+	Message   string      `json:"message"`
+	ErrorType string      `json:"errorType"`
+}
+
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return "ddp: " + e.Message
+	}
+	if e.Reason != "" {
+		return fmt.Sprintf("ddp: %v %s", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("ddp: %v", e.Code)
+}
+
+func newError(v interface{}) error {
+	e := &Error{}
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(b, e)
+	}
+	if err != nil {
+		return fmt.Errorf("ddp: %v", v)
+	}
+	return e
+}
+
+// Call represents an active method call or subscription.
+type Call struct {
+	ID            string
+	ServiceMethod string
+	Args          []interface{}
+	Reply         interface{}
+	Error         error
+	Done          chan *Call
+
+	// ready is set once a subscription is ready. It is guarded by the
+	// Client mutex.
+	ready bool
+}
+
+func (call *Call) done() {
+	select {
+	case call.Done <- call:
+	default:
+		// The caller is responsible for buffering Done.
+	}
+}
+
+// Message contains the fields common to all DDP messages.
+type Message struct {
+	Type string `json:"msg"`
+	ID   string `json:"id,omitempty"`
+}
+
+type connect struct {
+	Message
+	Version string   `json:"version"`
+	Support []string `json:"support"`
+	Session string   `json:"session,omitempty"`
+}
+
+type method struct {
+	Message
+	ServiceMethod string        `json:"method"`
+	Args          []interface{} `json:"params"`
+}
+
+type sub struct {
+	Message
+	SubName string        `json:"name"`
+	Args    []interface{} `json:"params"`
+}
@@ -0,0 +1,161 @@
+package ddp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// Dialer holds the settings used to open the websocket. The zero value
+// dials directly with no extra headers and the default tls configuration.
+type Dialer struct {
+	// TLSConfig is used for wss connections.
+	TLSConfig *tls.Config
+	// Proxy returns the proxy for a request, as in http.Transport.
+	Proxy func(*http.Request) (*url.URL, error)
+	// DialContext opens the tcp connection.
+	DialContext func(ctx context.Context, network, addr string) (net.Conn, error)
+	// Header is sent with the websocket handshake.
+	Header http.Header
+	// HandshakeTimeout bounds dialing and the websocket handshake.
+	HandshakeTimeout time.Duration
+}
+
+var defaultPorts = map[string]string{
+	"ws":  "80",
+	"wss": "443",
+}
+
+// Dial opens a websocket connection to rawurl.
+func (d *Dialer) Dial(ctx context.Context, rawurl, origin string) (*websocket.Conn, error) {
+	cfg, err := websocket.NewConfig(rawurl, origin)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range d.Header {
+		cfg.Header[k] = v
+	}
+
+	if d.HandshakeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.HandshakeTimeout)
+		defer cancel()
+	}
+
+	target := cfg.Location.Host
+	if _, _, err := net.SplitHostPort(target); err != nil {
+		target = net.JoinHostPort(target, defaultPorts[cfg.Location.Scheme])
+	}
+
+	proxyURL, err := d.proxyFor(cfg.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := target
+	if proxyURL != nil {
+		addr = proxyURL.Host
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(addr, "80")
+		}
+	}
+
+	dial := d.DialContext
+	if dial == nil {
+		dial = (&net.Dialer{}).DialContext
+	}
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	ws, err := d.handshake(conn, cfg, target, proxyURL)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return ws, nil
+}
+
+func (d *Dialer) handshake(conn net.Conn, cfg *websocket.Config, target string, proxyURL *url.URL) (*websocket.Conn, error) {
+	if proxyURL != nil {
+		if err := connectProxy(conn, target, proxyURL); err != nil {
+			return nil, err
+		}
+	}
+
+	var rwc net.Conn = conn
+	if cfg.Location.Scheme == "wss" {
+		tlsCfg := &tls.Config{}
+		if d.TLSConfig != nil {
+			tlsCfg = d.TLSConfig.Clone()
+		}
+		if tlsCfg.ServerName == "" {
+			host, _, _ := net.SplitHostPort(target)
+			tlsCfg.ServerName = host
+		}
+		tlsConn := tls.Client(conn, tlsCfg)
+		if err := tlsConn.Handshake(); err != nil {
+			return nil, err
+		}
+		rwc = tlsConn
+	}
+
+	return websocket.NewClient(cfg, rwc)
+}
+
+func (d *Dialer) proxyFor(loc *url.URL) (*url.URL, error) {
+	if d.Proxy == nil {
+		return nil, nil
+	}
+
+	u := *loc
+	if u.Scheme == "wss" {
+		u.Scheme = "https"
+	} else {
+		u.Scheme = "http"
+	}
+	return d.Proxy(&http.Request{URL: &u, Header: http.Header{}})
+}
+
+// connectProxy establishes a tunnel to target through an http proxy.
+func connectProxy(conn net.Conn, target string, proxyURL *url.URL) error {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: http.Header{},
+	}
+	if u := proxyURL.User; u != nil {
+		pass, _ := u.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(u.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ddp: proxy CONNECT %s: %s", target, resp.Status)
+	}
+	return nil
+}
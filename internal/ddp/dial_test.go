@@ -0,0 +1,138 @@
+package ddp
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testProxy is an http proxy supporting only CONNECT. It replies with
+// status to every request and tunnels the accepted ones.
+type testProxy struct {
+	net.Listener
+	status int
+
+	mu   sync.Mutex
+	reqs []*http.Request
+}
+
+func newTestProxy(t *testing.T, status int) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &testProxy{Listener: l, status: status}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *testProxy) serve(conn net.Conn) {
+	defer conn.Close()
+
+	req, err := http.ReadRequest(bufio.NewReader(conn))
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	p.reqs = append(p.reqs, req)
+	p.mu.Unlock()
+
+	if p.status != http.StatusOK {
+		io.WriteString(conn, "HTTP/1.1 "+strconv.Itoa(p.status)+" "+http.StatusText(p.status)+"\r\n\r\n")
+		return
+	}
+
+	upstream, err := net.Dial("tcp", req.Host)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+func (p *testProxy) url(user string) *url.URL {
+	u := &url.URL{Scheme: "http", Host: p.Addr().String()}
+	if user != "" {
+		u.User = url.UserPassword(user, "secret")
+	}
+	return u
+}
+
+func TestDialProxy(t *testing.T) {
+	s := newTestServer(false)
+	defer s.Close()
+	p := newTestProxy(t, http.StatusOK)
+	defer p.Close()
+
+	c := connectClient(t, s, &Dialer{Proxy: http.ProxyURL(p.url("bot"))}, 0)
+	defer c.Close()
+	if _, err := c.Call("echo"); err != nil {
+		t.Fatal(err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.reqs) != 1 {
+		t.Fatalf("proxy saw %d requests", len(p.reqs))
+	}
+	req := p.reqs[0]
+	target := strings.TrimPrefix(s.URL, "http://")
+	if req.Method != http.MethodConnect || req.Host != target {
+		t.Errorf("proxy request %s %s, want CONNECT %s", req.Method, req.Host, target)
+	}
+	// base64("bot:secret")
+	if auth := req.Header.Get("Proxy-Authorization"); auth != "Basic Ym90OnNlY3JldA==" {
+		t.Errorf("Proxy-Authorization = %q", auth)
+	}
+}
+
+func TestDialProxyDenied(t *testing.T) {
+	s := newTestServer(false)
+	defer s.Close()
+	p := newTestProxy(t, http.StatusForbidden)
+	defer p.Close()
+
+	d := &Dialer{Proxy: http.ProxyURL(p.url(""))}
+	_, err := d.Dial(context.Background(), s.url(), "http://localhost")
+	if err == nil || !strings.Contains(err.Error(), "proxy CONNECT") {
+		t.Errorf("err = %v, want proxy CONNECT error", err)
+	}
+}
+
+func TestDialTLS(t *testing.T) {
+	s := newTestServer(true)
+	defer s.Close()
+
+	if _, err := new(Dialer).Dial(context.Background(), s.url(), "https://localhost"); err == nil {
+		t.Error("dialed an untrusted certificate")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(s.Certificate())
+	d := &Dialer{TLSConfig: &tls.Config{RootCAs: roots}}
+	c := connectClient(t, s, d, 0)
+	defer c.Close()
+	if _, err := c.Call("echo"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,286 @@
+package rc
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// DefaultPageSize is the page size used by iterators when the Query
+// does not set a count.
+var DefaultPageSize = 100
+
+type pageFunc func(ctx context.Context, vals url.Values) (int, Pagination, error)
+
+// pager walks an offset/count endpoint one page at a time until the
+// server reported total is reached.
+type pager struct {
+	q      *Query
+	size   int
+	offset int
+	total  int
+	done   bool
+	err    error
+	fetch  pageFunc
+}
+
+func newPager(q *Query, fetch pageFunc) pager {
+	if q == nil {
+		q = NewQuery()
+	}
+
+	size := q.count
+	if size <= 0 {
+		size = DefaultPageSize
+	}
+
+	return pager{
+		q:      q,
+		size:   size,
+		offset: q.offset,
+		total:  -1,
+		fetch:  fetch,
+	}
+}
+
+func (p *pager) page(ctx context.Context) bool {
+	if p.done {
+		return false
+	}
+
+	vals := p.q.URLValues()
+	vals.Set("offset", strconv.Itoa(p.offset))
+	vals.Set("count", strconv.Itoa(p.size))
+
+	n, pg, err := p.fetch(ctx, vals)
+	if err != nil {
+		p.err = err
+		p.done = true
+		return false
+	}
+
+	p.offset += n
+	p.total = pg.Total
+	if n == 0 || p.offset >= p.total {
+		p.done = true
+	}
+
+	return n > 0
+}
+
+// Err returns the first error encountered while fetching pages.
+func (p *pager) Err() error {
+	return p.err
+}
+
+// Total returns the total reported by the server, or -1 before the first
+// page has been fetched.
+func (p *pager) Total() int {
+	return p.total
+}
+
+// ChannelIterator iterates over all channels from channels.list.
+type ChannelIterator struct {
+	pager
+	buf []Channel
+	cur Channel
+}
+
+// IterateChannels returns an iterator over channels.list. The page size is
+// taken from q.Count and defaults to DefaultPageSize.
+func (c *Client) IterateChannels(q *Query) *ChannelIterator {
+	it := &ChannelIterator{}
+	it.pager = newPager(q, func(ctx context.Context, vals url.Values) (int, Pagination, error) {
+		list := &ChannelList{}
+		if err := c.c.get(ctx, "/channels.list", vals).JSON(list); err != nil {
+			return 0, Pagination{}, err
+		}
+		it.buf = append(it.buf, list.Channels...)
+		return len(list.Channels), list.Pagination, nil
+	})
+	return it
+}
+
+// Next advances to the next channel, fetching a page when needed.
+// It returns false when iteration is complete or an error occurred.
+func (it *ChannelIterator) Next(ctx context.Context) bool {
+	for len(it.buf) == 0 {
+		if !it.page(ctx) {
+			return false
+		}
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Channel returns the current channel.
+func (it *ChannelIterator) Channel() Channel {
+	return it.cur
+}
+
+// UserIterator iterates over all users from users.list.
+type UserIterator struct {
+	pager
+	buf []User
+	cur User
+}
+
+// IterateUsers returns an iterator over users.list.
+func (c *Client) IterateUsers(q *Query) *UserIterator {
+	it := &UserIterator{}
+	it.pager = newPager(q, func(ctx context.Context, vals url.Values) (int, Pagination, error) {
+		list := &UserList{}
+		if err := c.c.get(ctx, "/users.list", vals).JSON(list); err != nil {
+			return 0, Pagination{}, err
+		}
+		it.buf = append(it.buf, list.Users...)
+		return len(list.Users), list.Pagination, nil
+	})
+	return it
+}
+
+// Next advances to the next user, fetching a page when needed.
+// It returns false when iteration is complete or an error occurred.
+func (it *UserIterator) Next(ctx context.Context) bool {
+	for len(it.buf) == 0 {
+		if !it.page(ctx) {
+			return false
+		}
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// User returns the current user.
+func (it *UserIterator) User() User {
+	return it.cur
+}
+
+// MemberIterator iterates over the members of a channel or private group.
+type MemberIterator struct {
+	pager
+	buf []ChannelMember
+	cur ChannelMember
+}
+
+func (c *Client) iterateMembers(path, roomID string, q *Query) *MemberIterator {
+	it := &MemberIterator{}
+	it.pager = newPager(q, func(ctx context.Context, vals url.Values) (int, Pagination, error) {
+		vals.Set("roomId", roomID)
+		list := &ChannelMembers{}
+		if err := c.c.get(ctx, path, vals).JSON(list); err != nil {
+			return 0, Pagination{}, err
+		}
+		it.buf = append(it.buf, list.Members...)
+		return len(list.Members), list.Pagination, nil
+	})
+	return it
+}
+
+// IterateChannelMembers returns an iterator over the members of a channel.
+func (c *Client) IterateChannelMembers(roomID string, q *Query) *MemberIterator {
+	return c.iterateMembers("/channels.members", roomID, q)
+}
+
+// IterateGroupMembers returns an iterator over the members of a private group.
+func (c *Client) IterateGroupMembers(roomID string, q *Query) *MemberIterator {
+	return c.iterateMembers("/groups.members", roomID, q)
+}
+
+// Next advances to the next member, fetching a page when needed.
+// It returns false when iteration is complete or an error occurred.
+func (it *MemberIterator) Next(ctx context.Context) bool {
+	for len(it.buf) == 0 {
+		if !it.page(ctx) {
+			return false
+		}
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Member returns the current member.
+func (it *MemberIterator) Member() ChannelMember {
+	return it.cur
+}
+
+// GroupIterator iterates over all private groups from groups.listAll.
+type GroupIterator struct {
+	pager
+	buf []Group
+	cur Group
+}
+
+// IterateGroups returns an iterator over groups.listAll.
+func (c *Client) IterateGroups(q *Query) *GroupIterator {
+	it := &GroupIterator{}
+	it.pager = newPager(q, func(ctx context.Context, vals url.Values) (int, Pagination, error) {
+		list := &GroupList{}
+		if err := c.c.get(ctx, "/groups.listAll", vals).JSON(list); err != nil {
+			return 0, Pagination{}, err
+		}
+		it.buf = append(it.buf, list.Groups...)
+		return len(list.Groups), list.Pagination, nil
+	})
+	return it
+}
+
+// Next advances to the next group, fetching a page when needed.
+// It returns false when iteration is complete or an error occurred.
+func (it *GroupIterator) Next(ctx context.Context) bool {
+	for len(it.buf) == 0 {
+		if !it.page(ctx) {
+			return false
+		}
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Group returns the current group.
+func (it *GroupIterator) Group() Group {
+	return it.cur
+}
+
+// IntegrationIterator iterates over all integrations from integrations.list.
+type IntegrationIterator struct {
+	pager
+	buf []IntegrationInfo
+	cur IntegrationInfo
+}
+
+// IterateIntegrations returns an iterator over integrations.list.
+func (c *Client) IterateIntegrations(q *Query) *IntegrationIterator {
+	it := &IntegrationIterator{}
+	it.pager = newPager(q, func(ctx context.Context, vals url.Values) (int, Pagination, error) {
+		list := &IntegrationList{}
+		if err := c.c.get(ctx, "/integrations.list", vals).JSON(list); err != nil {
+			return 0, Pagination{}, err
+		}
+		it.buf = append(it.buf, list.Integrations...)
+		pg := Pagination{
+			Count:  list.Items,
+			Offset: list.Offset,
+			Total:  list.Total,
+		}
+		return len(list.Integrations), pg, nil
+	})
+	return it
+}
+
+// Next advances to the next integration, fetching a page when needed.
+// It returns false when iteration is complete or an error occurred.
+func (it *IntegrationIterator) Next(ctx context.Context) bool {
+	for len(it.buf) == 0 {
+		if !it.page(ctx) {
+			return false
+		}
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Integration returns the current integration.
+func (it *IntegrationIterator) Integration() IntegrationInfo {
+	return it.cur
+}
@@ -0,0 +1,214 @@
+package rc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUserIterator(t *testing.T) {
+	const total = 250
+	pages := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages++
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+
+		users := []string{}
+		for i := offset; i < offset+count && i < total; i++ {
+			users = append(users, fmt.Sprintf(`{"_id":"u%d","username":"user%d"}`, i, i))
+		}
+		fmt.Fprintf(w, `{"users":[%s],"count":%d,"offset":%d,"total":%d,"success":true}`,
+			strings.Join(users, ","), len(users), offset, total)
+	}))
+	defer srv.Close()
+
+	client := New(ServerURL(srv.URL))
+	it := client.IterateUsers(NewQuery().Count(100))
+
+	seen := 0
+	for it.Next(context.Background()) {
+		if want := fmt.Sprintf("u%d", seen); it.User().ID != want {
+			t.Fatalf("User().ID = %s, want %s", it.User().ID, want)
+		}
+		seen++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if seen != total {
+		t.Errorf("iterated %d users, want %d", seen, total)
+	}
+	if pages != 3 {
+		t.Errorf("fetched %d pages, want 3", pages)
+	}
+	if it.Total() != total {
+		t.Errorf("Total() = %d, want %d", it.Total(), total)
+	}
+}
+
+// pagedServer serves total items named key on every path, reporting the
+// page size as countKey. It fails requests for offsets from failAt on,
+// unless failAt is negative.
+func pagedServer(key, countKey string, total, failAt int) (*httptest.Server, func() []*url.URL) {
+	var mu sync.Mutex
+	var reqs []*url.URL
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		reqs = append(reqs, r.URL)
+		mu.Unlock()
+
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		if failAt >= 0 && offset >= failAt {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"success":false,"error":"boom"}`))
+			return
+		}
+
+		items := []string{}
+		for i := offset; i < offset+count && i < total; i++ {
+			items = append(items, fmt.Sprintf(`{"_id":"%s%d"}`, key, i))
+		}
+		fmt.Fprintf(w, `{%q:[%s],%q:%d,"offset":%d,"total":%d,"success":true}`,
+			key, strings.Join(items, ","), countKey, len(items), offset, total)
+	}))
+	return srv, func() []*url.URL {
+		mu.Lock()
+		defer mu.Unlock()
+		return reqs
+	}
+}
+
+// iteration adapts the typed iterators for table tests.
+type iteration struct {
+	next func(ctx context.Context) bool
+	id   func() string
+	err  func() error
+}
+
+func TestIterators(t *testing.T) {
+	const total = 25
+
+	tests := []struct {
+		name string
+		key  string
+		path string
+		room string
+		iter func(c *Client, q *Query) iteration
+	}{
+		{"channels", "channels", "/api/v1/channels.list", "", func(c *Client, q *Query) iteration {
+			it := c.IterateChannels(q)
+			return iteration{it.Next, func() string { return it.Channel().ID }, it.Err}
+		}},
+		{"groups", "groups", "/api/v1/groups.listAll", "", func(c *Client, q *Query) iteration {
+			it := c.IterateGroups(q)
+			return iteration{it.Next, func() string { return it.Group().ID }, it.Err}
+		}},
+		{"channel_members", "members", "/api/v1/channels.members", "GENERAL", func(c *Client, q *Query) iteration {
+			it := c.IterateChannelMembers("GENERAL", q)
+			return iteration{it.Next, func() string { return it.Member().ID }, it.Err}
+		}},
+		{"group_members", "members", "/api/v1/groups.members", "GENERAL", func(c *Client, q *Query) iteration {
+			it := c.IterateGroupMembers("GENERAL", q)
+			return iteration{it.Next, func() string { return it.Member().ID }, it.Err}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, reqs := pagedServer(tt.key, "count", total, -1)
+			defer srv.Close()
+
+			it := tt.iter(New(ServerURL(srv.URL)), NewQuery().Count(10))
+			seen := 0
+			for it.next(context.Background()) {
+				if want := fmt.Sprintf("%s%d", tt.key, seen); it.id() != want {
+					t.Fatalf("item %d = %s, want %s", seen, it.id(), want)
+				}
+				seen++
+			}
+			if err := it.err(); err != nil {
+				t.Fatal(err)
+			}
+			if seen != total {
+				t.Errorf("iterated %d, want %d", seen, total)
+			}
+
+			got := reqs()
+			if len(got) != 3 {
+				t.Fatalf("fetched %d pages, want 3", len(got))
+			}
+			for i, u := range got {
+				q := u.Query()
+				if u.Path != tt.path || q.Get("offset") != strconv.Itoa(i*10) || q.Get("roomId") != tt.room {
+					t.Errorf("page %d requested %s", i, u)
+				}
+			}
+		})
+	}
+}
+
+func TestIntegrationIterator(t *testing.T) {
+	const total = 15
+
+	// integrations.list reports the page size as items instead of count.
+	srv, reqs := pagedServer("integrations", "items", total, -1)
+	defer srv.Close()
+
+	it := New(ServerURL(srv.URL)).IterateIntegrations(NewQuery().Count(10))
+	n, pg, err := it.fetch(context.Background(), url.Values{"offset": {"10"}, "count": {"10"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 5 || pg != (Pagination{Count: 5, Offset: 10, Total: total}) {
+		t.Errorf("page = %d %+v, want 5 items at offset 10 of %d", n, pg, total)
+	}
+	// Drop the page fetched above before iterating from the start.
+	it.buf = nil
+
+	seen := 0
+	for it.Next(context.Background()) {
+		if want := fmt.Sprintf("integrations%d", seen); it.Integration().ID != want {
+			t.Fatalf("Integration().ID = %s, want %s", it.Integration().ID, want)
+		}
+		seen++
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if seen != total || len(reqs()) != 3 {
+		t.Errorf("iterated %d in %d requests, want %d in 3", seen, len(reqs()), total)
+	}
+}
+
+func TestIteratorPageError(t *testing.T) {
+	srv, reqs := pagedServer("users", "count", 25, 10)
+	defer srv.Close()
+
+	it := New(ServerURL(srv.URL)).IterateUsers(NewQuery().Count(10))
+	seen := 0
+	for it.Next(context.Background()) {
+		seen++
+	}
+	if seen != 10 {
+		t.Errorf("iterated %d users, want the first page of 10", seen)
+	}
+
+	if err, ok := it.Err().(*APIError); !ok || err.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Err() = %v, want the page error", it.Err())
+	}
+
+	// A failed iterator stays done.
+	if it.Next(context.Background()) {
+		t.Error("Next() = true after a failed page")
+	}
+	if len(reqs()) != 2 {
+		t.Errorf("fetched %d pages, want 2", len(reqs()))
+	}
+}
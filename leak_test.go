@@ -0,0 +1,53 @@
+package rc
+
+import (
+	"bytes"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// goroutines returns the stacks of the running goroutines keyed by their
+// header line, which holds the goroutine id.
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+
+	gs := map[string]string{}
+	for _, g := range bytes.Split(buf, []byte("\n\n")) {
+		lines := strings.SplitN(string(g), "\n", 2)
+		id := strings.Fields(lines[0])
+		if len(id) < 2 {
+			continue
+		}
+		gs[id[1]] = string(g)
+	}
+	return gs
+}
+
+// checkLeaks records the running goroutines and returns a function that
+// fails t if goroutines started since are still running shortly after.
+func checkLeaks(t *testing.T) func() {
+	before := goroutines()
+	return func() {
+		t.Helper()
+
+		var leaked []string
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			leaked = leaked[:0]
+			for id, stack := range goroutines() {
+				if _, ok := before[id]; ok || strings.Contains(stack, "checkLeaks") {
+					continue
+				}
+				leaked = append(leaked, stack)
+			}
+			if len(leaked) == 0 {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Errorf("%d goroutines leaked:\n\n%s", len(leaked), strings.Join(leaked, "\n\n"))
+	}
+}
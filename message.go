@@ -1,6 +1,9 @@
 package rc
 
 import (
+	"context"
+	"errors"
+	"strings"
 	"time"
 )
 
@@ -9,33 +12,98 @@ type msgEnv struct {
 	Success bool    `json:"success"`
 }
 
+// Message is a chat message. It is the one model of a message the client
+// uses: every REST endpoint and realtime stream returning messages decodes
+// into it, whatever shape the server uses for its times.
+//
+// SendMessage and PostMessage only send the fields a client may set: ID,
+// RoomID, Channel, ThreadID, Text, Alias, Emoji, Avatar and Attachments.
 type Message struct {
-	Alias       string       `json:"alias,omitempty"`
-	Avatar      string       `json:"avatar,omitempty"`
-	Channel     string       `json:"channel,omitempty"`
-	Emoji       string       `json:"emoji,omitempty"`
-	RoomID      string       `json:"room_id,omitempty"`
-	Text        string       `json:"text,omitempty"`
-	Attachments []Attachment `json:"attachments,omitempty"`
+	// ID is generated by the client when sending over the realtime api so
+	// a send lost with the connection can be retried without duplicates.
+	ID     string `json:"_id,omitempty"`
+	RoomID string `json:"rid,omitempty"`
+	// Channel is the #channel or @user PostMessage posts to when RoomID is
+	// empty.
+	Channel string `json:"channel,omitempty"`
+	// Type is the type of system messages, such as "uj" for a user joining
+	// or "message_pinned", and empty for messages sent by users.
+	Type      string    `json:"t,omitempty"`
+	Text      string    `json:"msg"`
+	Alias     string    `json:"alias,omitempty"`
+	Emoji     string    `json:"emoji,omitempty"`
+	Avatar    string    `json:"avatar,omitempty"`
+	User      RoomUser  `json:"u"`
+	Timestamp Timestamp `json:"ts"`
+	UpdatedAt Timestamp `json:"_updatedAt"`
+	Unread    bool      `json:"unread,omitempty"`
+	Groupable *bool     `json:"groupable,omitempty"`
+
+	Mentions    []RoomUser                 `json:"mentions,omitempty"`
+	Channels    []MessageChannel           `json:"channels,omitempty"`
+	URLs        []MessageURL               `json:"urls,omitempty"`
+	Attachments []Attachment               `json:"attachments,omitempty"`
+	File        *MessageFile               `json:"file,omitempty"`
+	Reactions   map[string]MessageReaction `json:"reactions,omitempty"`
+
+	// EditedBy is nil unless the message was edited.
+	EditedAt Timestamp     `json:"editedAt"`
+	EditedBy *RoomUser     `json:"editedBy,omitempty"`
+	Pinned   bool          `json:"pinned,omitempty"`
+	PinnedAt Timestamp     `json:"pinnedAt"`
+	PinnedBy *RoomUser     `json:"pinnedBy,omitempty"`
+	Starred  []MessageStar `json:"starred,omitempty"`
+
+	// ThreadID sends the message as a reply in the thread started by the
+	// message with that id.
+	ThreadID          string    `json:"tmid,omitempty"`
+	ThreadCount       int64     `json:"tcount,omitempty"`
+	ThreadLastMessage Timestamp `json:"tlm"`
+	Replies           []string  `json:"replies,omitempty"`
+	DiscussionID      string    `json:"drid,omitempty"`
 }
 
+// The old message types only keep their names. Their fields are those of
+// Message, which breaks code using the old ones: Msg is now Text, Rid is
+// now RoomID, and times held in RoomTS or strings are now Timestamp.
+type (
+	// RoomMessage is a message received from a room stream.
+	//
+	// Deprecated: use Message.
+	RoomMessage = Message
+
+	// MessageInfo is a message returned by the chat.* endpoints.
+	//
+	// Deprecated: use Message.
+	MessageInfo = Message
+
+	// ChannelMessage is a message of a room history.
+	//
+	// Deprecated: use Message.
+	ChannelMessage = Message
+)
+
+// Attachment is a rich attachment of a message. Timestamp is nil unless
+// set, so it is left out when sending.
 type Attachment struct {
-	AudioURL          string    `json:"audio_url,omitempty"`
-	AuthorName        string    `json:"author_name,omitempty"`
-	AuthorLink        string    `json:"author_link,omitempty"`
-	AuthorIcon        string    `json:"author_icon,omitempty"`
-	Collapsed         bool      `json:"collapsed,omitempty"`
-	Color             string    `json:"color,omitempty"`
-	Fields            []Field   `json:"fields,omitempty"`
-	ImageURL          string    `json:"image_url,omitempty"`
-	MessageLink       string    `json:"message_link,omitempty"`
-	Text              string    `json:"text,omitempty"`
-	ThumbURL          string    `json:"thumb_url,omitempty"`
-	Title             string    `json:"title,omitempty"`
-	TitleLink         string    `json:"title_link,omitempty"`
-	TitleLinkDownload bool      `json:"title_link_download,omitempty"`
-	Timestamp         time.Time `json:"ts,omitempty"`
-	VideoURL          string    `json:"video_url,omitempty"`
+	AudioURL          string     `json:"audio_url,omitempty"`
+	AuthorName        string     `json:"author_name,omitempty"`
+	AuthorLink        string     `json:"author_link,omitempty"`
+	AuthorIcon        string     `json:"author_icon,omitempty"`
+	Collapsed         bool       `json:"collapsed,omitempty"`
+	Color             string     `json:"color,omitempty"`
+	Description       string     `json:"description,omitempty"`
+	Fields            []Field    `json:"fields,omitempty"`
+	ImageURL          string     `json:"image_url,omitempty"`
+	MessageLink       string     `json:"message_link,omitempty"`
+	Text              string     `json:"text,omitempty"`
+	ThumbURL          string     `json:"thumb_url,omitempty"`
+	Title             string     `json:"title,omitempty"`
+	TitleLink         string     `json:"title_link,omitempty"`
+	TitleLinkDownload bool       `json:"title_link_download,omitempty"`
+	Timestamp         *Timestamp `json:"ts,omitempty"`
+	Type              string     `json:"type,omitempty"`
+	VideoURL          string     `json:"video_url,omitempty"`
 }
 
 type Field struct {
@@ -44,36 +112,136 @@ type Field struct {
 	Short bool   `json:"short"`
 }
 
-// Generated by https://quicktype.io
-
 type MessageResult struct {
 	Message Message `json:"message"`
 	Success bool    `json:"success"`
 }
 
-type MessageInfo struct {
-	Rid       string        `json:"rid"`
-	Msg       string        `json:"msg"`
-	Ts        string        `json:"ts"`
-	User      User          `json:"u"`
-	Unread    bool          `json:"unread"`
-	Mentions  []interface{} `json:"mentions"`
-	Channels  []interface{} `json:"channels"`
-	UpdatedAt string        `json:"_updatedAt"`
-	ID        string        `json:"_id"`
+// MessageURL is a link in a message. Meta holds the preview the server
+// fetched for it, such as ogTitle and ogImage, and Headers the contentType
+// and contentLength of the page.
+type MessageURL struct {
+	URL         string            `json:"url"`
+	Meta        map[string]string `json:"meta,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	IgnoreParse bool              `json:"ignoreParse,omitempty"`
+}
+
+// MessageChannel is a channel linked from a message with #name.
+type MessageChannel struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+}
+
+// MessageFile is the file uploaded with a message.
+type MessageFile struct {
+	ID   string `json:"_id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+type MessageStar struct {
+	UserID string `json:"_id"`
+}
+
+type MessageReaction struct {
+	Usernames []string `json:"usernames"`
+}
+
+type MessageList struct {
+	Messages []Message `json:"messages"`
+	Pagination
+	Success bool `json:"success"`
+}
+
+type DeletedMessages struct {
+	Messages []DeletedMessage `json:"messages"`
+	Pagination
+	Success bool `json:"success"`
+}
+
+type DeletedMessage struct {
+	ID        string    `json:"_id"`
+	DeletedAt Timestamp `json:"_deletedAt"`
+}
+
+// MessageSync holds the changes to the messages of a room since a time.
+type MessageSync struct {
+	Updated []Message        `json:"updated"`
+	Deleted []DeletedMessage `json:"deleted"`
+}
+
+type PostMessageResult struct {
+	Ts      int64   `json:"ts"`
+	Channel string  `json:"channel"`
+	Message Message `json:"message"`
+	Success bool    `json:"success"`
+}
+
+type postMessage struct {
+	RoomID      string       `json:"roomId,omitempty"`
+	Channel     string       `json:"channel,omitempty"`
+	ThreadID    string       `json:"tmid,omitempty"`
+	Text        string       `json:"text,omitempty"`
+	Alias       string       `json:"alias,omitempty"`
+	Emoji       string       `json:"emoji,omitempty"`
+	Avatar      string       `json:"avatar,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+func (c *Client) GetMessage(msgID string) (*Message, error) {
+	return c.GetMessageContext(context.Background(), msgID)
 }
 
-func (c *Client) GetMessage(msgID string) (*MessageResult, error) {
-	msg := &MessageResult{}
+func (c *Client) GetMessageContext(ctx context.Context, msgID string) (*Message, error) {
+	env := &msgEnv{}
 	q := query("msgId", msgID)
-	if err := c.c.get("chat.getMessage", q.Q()).JSON(msg); err != nil {
+	if err := c.c.get(ctx, "/chat.getMessage", q.Q()).JSON(env); err != nil {
 		return nil, err
 	}
-	return msg, nil
+
+	msg := env.Message
+	return &msg, nil
+}
+
+// PostMessage posts msg to a room, by RoomID, or to a #channel or @user,
+// by Channel, with chat.postMessage.
+func (c *Client) PostMessage(msg Message) (*PostMessageResult, error) {
+	return c.PostMessageContext(context.Background(), msg)
 }
 
+func (c *Client) PostMessageContext(ctx context.Context, msg Message) (*PostMessageResult, error) {
+	req := postMessage{
+		RoomID:      msg.RoomID,
+		Channel:     msg.Channel,
+		ThreadID:    msg.ThreadID,
+		Text:        msg.Text,
+		Alias:       msg.Alias,
+		Emoji:       msg.Emoji,
+		Avatar:      msg.Avatar,
+		Attachments: msg.Attachments,
+	}
+
+	res := &PostMessageResult{}
+	if err := c.c.postStatus(ctx, "/chat.postMessage", req, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// SendMessage posts msg to the room RoomID with chat.sendMessage, or over
+// the realtime api with StreamOptions. Use PostMessage to post by Channel.
 func (c *Client) SendMessage(msg Message) (*MessageResult, error) {
-	res := c.c.postJSON("/chat.sendMessage", msg)
+	return c.SendMessageContext(context.Background(), msg)
+}
+
+func (c *Client) SendMessageContext(ctx context.Context, msg Message) (*MessageResult, error) {
+	if c.d != nil && msg.RoomID != "" {
+		return c.d.sendMessage(ctx, msg)
+	}
+
+	req := map[string]ddpMessage{"message": newDDPMessage(msg)}
+	res := c.c.postJSON(ctx, "/chat.sendMessage", req)
 	if res.Error() != nil {
 		return nil, res.Error()
 	}
@@ -83,3 +251,284 @@ func (c *Client) SendMessage(msg Message) (*MessageResult, error) {
 	}
 	return mres, nil
 }
+
+// UpdateMessage replaces the text of a message.
+func (c *Client) UpdateMessage(roomID, msgID, text string) error {
+	return c.UpdateMessageContext(context.Background(), roomID, msgID, text)
+}
+
+func (c *Client) UpdateMessageContext(ctx context.Context, roomID, msgID, text string) error {
+	if c.d != nil {
+		return c.d.updateMessage(ctx, roomID, msgID, text)
+	}
+
+	req := map[string]string{"roomId": roomID, "msgId": msgID, "text": text}
+	return c.c.postStatus(ctx, "/chat.update", req, nil)
+}
+
+// DeleteMessage deletes a message.
+func (c *Client) DeleteMessage(roomID, msgID string) error {
+	return c.DeleteMessageContext(context.Background(), roomID, msgID)
+}
+
+func (c *Client) DeleteMessageContext(ctx context.Context, roomID, msgID string) error {
+	if c.d != nil {
+		return c.d.deleteMessage(ctx, msgID)
+	}
+
+	req := map[string]string{"roomId": roomID, "msgId": msgID}
+	return c.c.postStatus(ctx, "/chat.delete", req, nil)
+}
+
+// SetReaction adds the emoji reaction of the user to a message, or removes
+// it if react is false. The emoji can be given with or without colons.
+func (c *Client) SetReaction(msgID, emoji string, react bool) error {
+	return c.SetReactionContext(context.Background(), msgID, emoji, react)
+}
+
+func (c *Client) SetReactionContext(ctx context.Context, msgID, emoji string, react bool) error {
+	emoji = ":" + strings.Trim(emoji, ":") + ":"
+	if c.d != nil {
+		return c.d.setReaction(ctx, msgID, emoji, react)
+	}
+
+	req := map[string]interface{}{"messageId": msgID, "emoji": emoji, "shouldReact": react}
+	return c.c.postStatus(ctx, "/chat.react", req, nil)
+}
+
+// ReadMessages marks all messages in a room as read.
+func (c *Client) ReadMessages(roomID string) error {
+	return c.ReadMessagesContext(context.Background(), roomID)
+}
+
+func (c *Client) ReadMessagesContext(ctx context.Context, roomID string) error {
+	if c.d != nil {
+		return c.d.readMessages(ctx, roomID)
+	}
+
+	req := map[string]string{"rid": roomID}
+	return c.c.postJSON(ctx, "/subscriptions.read", req).Error()
+}
+
+// PinMessage pins a message to its room and returns the message_pinned
+// notice posted by the server.
+func (c *Client) PinMessage(msgID string) (*Message, error) {
+	return c.PinMessageContext(context.Background(), msgID)
+}
+
+func (c *Client) PinMessageContext(ctx context.Context, msgID string) (*Message, error) {
+	env := &msgEnv{}
+	req := map[string]string{"messageId": msgID}
+	if err := c.c.postStatus(ctx, "/chat.pinMessage", req, env); err != nil {
+		return nil, err
+	}
+
+	msg := env.Message
+	return &msg, nil
+}
+
+func (c *Client) UnpinMessage(msgID string) error {
+	return c.UnpinMessageContext(context.Background(), msgID)
+}
+
+func (c *Client) UnpinMessageContext(ctx context.Context, msgID string) error {
+	req := map[string]string{"messageId": msgID}
+	return c.c.postStatus(ctx, "/chat.unPinMessage", req, nil)
+}
+
+// StarMessage stars a message for the logged in user.
+func (c *Client) StarMessage(msgID string) error {
+	return c.StarMessageContext(context.Background(), msgID)
+}
+
+func (c *Client) StarMessageContext(ctx context.Context, msgID string) error {
+	req := map[string]string{"messageId": msgID}
+	return c.c.postStatus(ctx, "/chat.starMessage", req, nil)
+}
+
+func (c *Client) UnstarMessage(msgID string) error {
+	return c.UnstarMessageContext(context.Background(), msgID)
+}
+
+func (c *Client) UnstarMessageContext(ctx context.Context, msgID string) error {
+	req := map[string]string{"messageId": msgID}
+	return c.c.postStatus(ctx, "/chat.unStarMessage", req, nil)
+}
+
+// ReportMessage reports a message to the server administrators.
+func (c *Client) ReportMessage(msgID, description string) error {
+	return c.ReportMessageContext(context.Background(), msgID, description)
+}
+
+func (c *Client) ReportMessageContext(ctx context.Context, msgID, description string) error {
+	req := map[string]string{"messageId": msgID, "description": description}
+	return c.c.postStatus(ctx, "/chat.reportMessage", req, nil)
+}
+
+// SearchMessages returns the messages of a room containing text, newest
+// first. q may be nil.
+func (c *Client) SearchMessages(roomID, text string, q *Query) (*MessageList, error) {
+	return c.SearchMessagesContext(context.Background(), roomID, text, q)
+}
+
+func (c *Client) SearchMessagesContext(ctx context.Context, roomID, text string, q *Query) (*MessageList, error) {
+	return c.messageList(ctx, "/chat.search", roomID, q, query("searchText", text))
+}
+
+// GetMentionedMessages returns the messages of a room mentioning the logged
+// in user. q may be nil.
+func (c *Client) GetMentionedMessages(roomID string, q *Query) (*MessageList, error) {
+	return c.GetMentionedMessagesContext(context.Background(), roomID, q)
+}
+
+func (c *Client) GetMentionedMessagesContext(ctx context.Context, roomID string, q *Query) (*MessageList, error) {
+	return c.messageList(ctx, "/chat.getMentionedMessages", roomID, q, nil)
+}
+
+func (c *Client) GetPinnedMessages(roomID string, q *Query) (*MessageList, error) {
+	return c.GetPinnedMessagesContext(context.Background(), roomID, q)
+}
+
+func (c *Client) GetPinnedMessagesContext(ctx context.Context, roomID string, q *Query) (*MessageList, error) {
+	return c.messageList(ctx, "/chat.getPinnedMessages", roomID, q, nil)
+}
+
+// GetStarredMessages returns the messages of a room starred by the logged
+// in user. q may be nil.
+func (c *Client) GetStarredMessages(roomID string, q *Query) (*MessageList, error) {
+	return c.GetStarredMessagesContext(context.Background(), roomID, q)
+}
+
+func (c *Client) GetStarredMessagesContext(ctx context.Context, roomID string, q *Query) (*MessageList, error) {
+	return c.messageList(ctx, "/chat.getStarredMessages", roomID, q, nil)
+}
+
+// GetDeletedMessages returns the ids of the messages deleted from a room
+// since a time. q may be nil.
+func (c *Client) GetDeletedMessages(roomID string, since time.Time, q *Query) (*DeletedMessages, error) {
+	return c.GetDeletedMessagesContext(context.Background(), roomID, since, q)
+}
+
+func (c *Client) GetDeletedMessagesContext(ctx context.Context, roomID string, since time.Time, q *Query) (*DeletedMessages, error) {
+	if q == nil {
+		q = NewQuery()
+	}
+	vals := q.URLValues()
+	vals.Set("roomId", roomID)
+	vals.Set("since", since.UTC().Format(TimeFormat))
+
+	deleted := &DeletedMessages{}
+	if err := c.c.get(ctx, "/chat.getDeletedMessages", vals).JSON(deleted); err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+// SyncMessages returns the messages of a room updated and deleted since
+// lastUpdate.
+func (c *Client) SyncMessages(roomID string, lastUpdate time.Time) (*MessageSync, error) {
+	return c.SyncMessagesContext(context.Background(), roomID, lastUpdate)
+}
+
+func (c *Client) SyncMessagesContext(ctx context.Context, roomID string, lastUpdate time.Time) (*MessageSync, error) {
+	env := &struct {
+		Result  MessageSync `json:"result"`
+		Success bool        `json:"success"`
+	}{}
+	q := query("roomId", roomID).V("lastUpdate", lastUpdate.UTC().Format(TimeFormat))
+	if err := c.c.get(ctx, "/chat.syncMessages", q.Q()).JSON(env); err != nil {
+		return nil, err
+	}
+
+	sync := env.Result
+	return &sync, nil
+}
+
+// messageList gets a page of a chat.* message list endpoint.
+func (c *Client) messageList(ctx context.Context, path, roomID string, q *Query, extra *urlQ) (*MessageList, error) {
+	if q == nil {
+		q = NewQuery()
+	}
+	vals := q.URLValues()
+	vals.Set("roomId", roomID)
+	if extra != nil {
+		for k, v := range extra.Q() {
+			vals[k] = v
+		}
+	}
+
+	list := &MessageList{}
+	if err := c.c.get(ctx, path, vals).JSON(list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// ddpMessage is the message document of the sendMessage and updateMessage
+// methods and of chat.sendMessage.
+type ddpMessage struct {
+	ID          string       `json:"_id,omitempty"`
+	RoomID      string       `json:"rid,omitempty"`
+	ThreadID    string       `json:"tmid,omitempty"`
+	Msg         string       `json:"msg,omitempty"`
+	Alias       string       `json:"alias,omitempty"`
+	Emoji       string       `json:"emoji,omitempty"`
+	Avatar      string       `json:"avatar,omitempty"`
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+func newDDPMessage(msg Message) ddpMessage {
+	return ddpMessage{
+		ID:          msg.ID,
+		RoomID:      msg.RoomID,
+		ThreadID:    msg.ThreadID,
+		Msg:         msg.Text,
+		Alias:       msg.Alias,
+		Emoji:       msg.Emoji,
+		Avatar:      msg.Avatar,
+		Attachments: msg.Attachments,
+	}
+}
+
+func (d *ddpClient) sendMessage(ctx context.Context, msg Message) (*MessageResult, error) {
+	if msg.ID == "" {
+		msg.ID = newId()
+	}
+
+	res, err := d.callIdempotent(ctx, "sendMessage", newDDPMessage(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	msgs, err := decodeRoomMessages([]interface{}{res})
+	if err != nil {
+		return nil, err
+	}
+	if len(msgs) == 0 {
+		return nil, errors.New("rc: sendMessage returned no message")
+	}
+
+	return &MessageResult{Message: msgs[0], Success: true}, nil
+}
+
+func (d *ddpClient) updateMessage(ctx context.Context, roomID, msgID, text string) error {
+	_, err := d.callIdempotent(ctx, "updateMessage", ddpMessage{ID: msgID, RoomID: roomID, Msg: text})
+	return err
+}
+
+func (d *ddpClient) deleteMessage(ctx context.Context, msgID string) error {
+	_, err := d.callIdempotent(ctx, "deleteMessage", map[string]string{"_id": msgID})
+	return err
+}
+
+func (d *ddpClient) setReaction(ctx context.Context, msgID, emoji string, react bool) error {
+	_, err := d.callIdempotent(ctx, "setReaction", emoji, msgID, react)
+	return err
+}
+
+func (d *ddpClient) readMessages(ctx context.Context, roomID string) error {
+	_, err := d.callIdempotent(ctx, "readMessages", roomID)
+	return err
+}
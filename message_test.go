@@ -0,0 +1,236 @@
+package rc
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestMessageLifecycle(t *testing.T) {
+	for _, realtime := range []bool{false, true} {
+		srv := rctest.NewServer()
+		bot := srv.AddUser("bot", "secret")
+
+		opts := []ClientOption{ServerURL(srv.URL), AccessToken(bot.ID, bot.Token)}
+		if realtime {
+			opts = append(opts, StreamOptions())
+		}
+		client := New(opts...)
+		if err := client.Connect(); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := client.SendMessage(Message{RoomID: rctest.GeneralID, Text: "hello"})
+		if err != nil {
+			t.Fatalf("realtime=%v: %v", realtime, err)
+		}
+		id := res.Message.ID
+		if id == "" {
+			t.Errorf("realtime=%v: sent message has no id", realtime)
+		}
+
+		if err := client.UpdateMessage(rctest.GeneralID, id, "hello, world"); err != nil {
+			t.Fatalf("realtime=%v: %v", realtime, err)
+		}
+		if err := client.SetReaction(id, "thumbsup", true); err != nil {
+			t.Fatalf("realtime=%v: %v", realtime, err)
+		}
+		msgs := srv.Messages(rctest.GeneralID)
+		if len(msgs) != 1 || msgs[0].Text != "hello, world" || msgs[0].EditedBy != "bot" {
+			t.Errorf("realtime=%v: messages after update = %+v", realtime, msgs)
+		}
+		if users := msgs[0].Reactions[":thumbsup:"]; len(users) != 1 || users[0] != "bot" {
+			t.Errorf("realtime=%v: reactions = %v", realtime, msgs[0].Reactions)
+		}
+
+		if err := client.ReadMessages(rctest.GeneralID); err != nil {
+			t.Fatalf("realtime=%v: %v", realtime, err)
+		}
+		if srv.LastRead(rctest.GeneralID, "bot").IsZero() {
+			t.Errorf("realtime=%v: room not marked read", realtime)
+		}
+
+		if err := client.DeleteMessage(rctest.GeneralID, id); err != nil {
+			t.Fatalf("realtime=%v: %v", realtime, err)
+		}
+		if msgs := srv.Messages(rctest.GeneralID); len(msgs) != 0 {
+			t.Errorf("realtime=%v: messages after delete = %+v", realtime, msgs)
+		}
+
+		client.Close(context.Background())
+		srv.Close()
+	}
+}
+
+func TestSendMessageRetry(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+
+	var mu sync.Mutex
+	var ids []string
+	srv.HandleMethod("sendMessage", func(userID string, params []interface{}) (interface{}, error) {
+		p := params[0].(map[string]interface{})
+
+		mu.Lock()
+		ids = append(ids, p["_id"].(string))
+		first := len(ids) == 1
+		mu.Unlock()
+
+		if first {
+			// Lose the connection before the result is sent.
+			go srv.DropConnections()
+			time.Sleep(100 * time.Millisecond)
+		}
+		return map[string]interface{}{
+			"_id": p["_id"],
+			"rid": p["rid"],
+			"msg": p["msg"],
+			"ts":  map[string]interface{}{"$date": time.Now().UnixNano() / int64(time.Millisecond)},
+			"u":   map[string]interface{}{"_id": bot.ID, "username": bot.Username},
+		}, nil
+	})
+
+	client := New(
+		ServerURL(srv.URL),
+		AccessToken(bot.ID, bot.Token),
+		ReconnectBackoff(50*time.Millisecond, time.Second),
+		StreamOptions(),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := client.SendMessageContext(ctx, Message{RoomID: rctest.GeneralID, Text: "once"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(ids) != 2 || ids[0] != ids[1] || res.Message.ID != ids[0] {
+		t.Errorf("sent ids %v, result id %q", ids, res.Message.ID)
+	}
+}
+
+func TestChatAPI(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	srv.AddUser("alice", "secret")
+
+	client := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-time.Second)
+	posted, err := client.PostMessage(Message{Channel: "#general", Text: "deploy started"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if posted.Channel != "general" || posted.Message.Text != "deploy started" || posted.Ts == 0 {
+		t.Errorf("posted = %+v", posted)
+	}
+	id := posted.Message.ID
+
+	mention := srv.PostMessage(rctest.GeneralID, "alice", "@bot deploy done?")
+	doomed := srv.PostMessage(rctest.GeneralID, "alice", "oops")
+
+	got, err := client.GetMessage(mention.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != mention.Text || len(got.Mentions) != 1 || got.Mentions[0].Username != "bot" {
+		t.Errorf("GetMessage = %+v", got)
+	}
+
+	notice, err := client.PinMessage(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if notice.Type != "message_pinned" {
+		t.Errorf("pin notice = %+v", notice)
+	}
+	if _, err := client.PinMessage(id); !IsBadRequest(err) {
+		t.Errorf("pinning twice: err = %v", err)
+	}
+	if err := client.StarMessage(mention.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReportMessage(doomed.ID, "spam"); err != nil {
+		t.Fatal(err)
+	}
+	if r := srv.Reports(); len(r) != 1 || r[0].MessageID != doomed.ID || r[0].Description != "spam" {
+		t.Errorf("reports = %+v", r)
+	}
+	if err := client.DeleteMessage(rctest.GeneralID, doomed.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	lists := []struct {
+		name string
+		fn   func() (*MessageList, error)
+		want string
+	}{
+		{"search", func() (*MessageList, error) { return client.SearchMessages(rctest.GeneralID, "DEPLOY", nil) }, ""},
+		{"mentioned", func() (*MessageList, error) { return client.GetMentionedMessages(rctest.GeneralID, nil) }, mention.ID},
+		{"pinned", func() (*MessageList, error) { return client.GetPinnedMessages(rctest.GeneralID, nil) }, id},
+		{"starred", func() (*MessageList, error) { return client.GetStarredMessages(rctest.GeneralID, nil) }, mention.ID},
+	}
+	for _, l := range lists {
+		list, err := l.fn()
+		if err != nil {
+			t.Fatalf("%s: %v", l.name, err)
+		}
+		if l.want == "" {
+			if len(list.Messages) != 2 || list.Messages[0].ID != mention.ID {
+				t.Errorf("%s = %+v", l.name, list.Messages)
+			}
+			continue
+		}
+		if len(list.Messages) != 1 || list.Messages[0].ID != l.want {
+			t.Errorf("%s = %+v", l.name, list.Messages)
+		}
+	}
+
+	deleted, err := client.GetDeletedMessages(rctest.GeneralID, start, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted.Messages) != 1 || deleted.Messages[0].ID != doomed.ID {
+		t.Errorf("deleted = %+v", deleted)
+	}
+
+	sync, err := client.SyncMessages(rctest.GeneralID, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sync.Updated) != 3 || len(sync.Deleted) != 1 {
+		t.Errorf("sync = %+v", sync)
+	}
+	for _, m := range sync.Updated {
+		if m.ID == id && (!m.Pinned || m.PinnedBy.Username != "bot") {
+			t.Errorf("pinned message = %+v", m)
+		}
+	}
+
+	if err := client.UnpinMessage(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UnstarMessage(mention.ID); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := client.GetStarredMessages(rctest.GeneralID, nil); err != nil || len(list.Messages) != 0 {
+		t.Errorf("starred after unstar = %+v, %v", list, err)
+	}
+}
@@ -0,0 +1,375 @@
+package rc
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// User presence statuses.
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusBusy    = "busy"
+	StatusOffline = "offline"
+)
+
+// TypingRefresh is how often WhileTyping repeats the typing notification
+// so other clients do not time it out.
+var TypingRefresh = 5 * time.Second
+
+// SetTyping shows or hides the typing indicator of the user in a room.
+// It needs StreamOptions.
+func (c *Client) SetTyping(roomID string, typing bool) error {
+	return c.SetTypingContext(context.Background(), roomID, typing)
+}
+
+func (c *Client) SetTypingContext(ctx context.Context, roomID string, typing bool) error {
+	if c.d == nil {
+		return ErrNoRealtime
+	}
+
+	username, err := c.username(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.d.call(ctx, "stream-notify-room", roomID+"/typing", username, typing)
+	return err
+}
+
+// WhileTyping shows the typing indicator in a room until fn returns, for
+// bots running long commands. Failing to clear the indicator is logged
+// rather than returned.
+func (c *Client) WhileTyping(ctx context.Context, roomID string, fn func() error) error {
+	if err := c.SetTypingContext(ctx, roomID, true); err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(TypingRefresh)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := c.SetTypingContext(ctx, roomID, true); err != nil {
+					c.log.Debugw("refreshing typing indicator", "room", roomID, "error", err)
+				}
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err := fn()
+	close(stop)
+	wg.Wait()
+
+	// ctx may be done by now; the indicator still has to be cleared.
+	if serr := c.SetTypingContext(context.Background(), roomID, false); serr != nil {
+		c.log.Debugw("clearing typing indicator", "room", roomID, "error", serr)
+	}
+	return err
+}
+
+// SetStatus sets the default status of the user, one of StatusOnline,
+// StatusAway, StatusBusy or StatusOffline, and the status message.
+func (c *Client) SetStatus(status, message string) error {
+	return c.SetStatusContext(context.Background(), status, message)
+}
+
+func (c *Client) SetStatusContext(ctx context.Context, status, message string) error {
+	req := map[string]string{"status": status, "message": message}
+	return c.c.postJSON(ctx, "/users.setStatus", req).Error()
+}
+
+// SetAway marks the realtime connection of the user as away or back
+// online, as the web client does when the user is idle. It does not change
+// the default status set by SetStatus. It needs StreamOptions.
+func (c *Client) SetAway(away bool) error {
+	return c.SetAwayContext(context.Background(), away)
+}
+
+func (c *Client) SetAwayContext(ctx context.Context, away bool) error {
+	if c.d == nil {
+		return ErrNoRealtime
+	}
+
+	method := "UserPresence:online"
+	if away {
+		method = "UserPresence:away"
+	}
+	_, err := c.d.call(ctx, method)
+	return err
+}
+
+// username returns the username of the logged in user, asking the server
+// once.
+func (c *Client) username(ctx context.Context) (string, error) {
+	c.meMu.Lock()
+	defer c.meMu.Unlock()
+
+	if c.me != "" {
+		return c.me, nil
+	}
+	me, err := c.GetMeContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	c.me = me.Username
+	return c.me, nil
+}
+
+// DefaultPresenceResync is how often a PresenceTracker asks the server for
+// status changes it may have missed.
+var DefaultPresenceResync = 5 * time.Minute
+
+// PresenceChange is a change of status seen by a PresenceTracker.
+type PresenceChange struct {
+	UserID     string
+	Username   string
+	Status     string
+	Previous   string
+	StatusText string
+}
+
+// PresenceTracker keeps the status of every user up to date. It is seeded
+// from users.presence, follows user-status events when Client has
+// StreamOptions and resyncs periodically with the from parameter of
+// users.presence.
+type PresenceTracker struct {
+	c        *Client
+	interval time.Duration
+	buffer   int
+
+	mu       sync.RWMutex
+	users    map[string]User
+	lastSync time.Time
+
+	changes chan PresenceChange
+	watch   *streamSub
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// PresenceOption is a functional argument that sets optional values on
+// PresenceTracker
+type PresenceOption func(*PresenceTracker)
+
+// PresenceResync sets how often the tracker resyncs. Zero disables
+// resyncing.
+func PresenceResync(d time.Duration) PresenceOption {
+	return func(p *PresenceTracker) {
+		p.interval = d
+	}
+}
+
+// PresenceBuffer sets the capacity of the Changes channel. When it is full
+// the oldest change is dropped.
+func PresenceBuffer(n int) PresenceOption {
+	return func(p *PresenceTracker) {
+		p.buffer = n
+	}
+}
+
+// NewPresenceTracker seeds a tracker and starts following status changes.
+// Close it when done.
+func NewPresenceTracker(ctx context.Context, c *Client, opts ...PresenceOption) (*PresenceTracker, error) {
+	p := &PresenceTracker{
+		c:        c,
+		interval: DefaultPresenceResync,
+		buffer:   DefaultEventBuffer,
+		users:    make(map[string]User),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.changes = make(chan PresenceChange, p.buffer)
+
+	// Follow events before seeding so no change falls between the two.
+	if c.d != nil {
+		w, err := c.d.streams.watch(ctx, SubNotifyLogged, NotifyUserStatus, "", p.apply)
+		if err != nil {
+			return nil, err
+		}
+		p.watch = w
+	}
+
+	if err := p.sync(ctx, false); err != nil {
+		if p.watch != nil {
+			c.d.streams.unwatch(p.watch)
+		}
+		return nil, err
+	}
+
+	go p.run()
+
+	return p, nil
+}
+
+// StatusOf returns the status of a user, or StatusOffline for users the
+// tracker does not know.
+func (p *PresenceTracker) StatusOf(userID string) string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if u, ok := p.users[userID]; ok && u.Status != "" {
+		return u.Status
+	}
+	return StatusOffline
+}
+
+// Online returns the users whose status is StatusOnline.
+func (p *PresenceTracker) Online() []User {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	var users []User
+	for _, u := range p.users {
+		if u.Status == StatusOnline {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users
+}
+
+// Changes returns a channel that receives every status change. It is
+// closed by Close.
+func (p *PresenceTracker) Changes() <-chan PresenceChange {
+	return p.changes
+}
+
+// Close stops following status changes.
+func (p *PresenceTracker) Close() error {
+	var err error
+	p.once.Do(func() {
+		if p.watch != nil {
+			err = p.c.d.streams.unwatch(p.watch)
+		}
+		close(p.stop)
+		<-p.done
+		close(p.changes)
+	})
+	return err
+}
+
+func (p *PresenceTracker) run() {
+	defer close(p.done)
+	if p.interval <= 0 {
+		<-p.stop
+		return
+	}
+
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := p.sync(context.Background(), true); err != nil {
+				p.c.log.Debugw("presence resync", "error", err)
+			}
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// sync fetches the users changed since the last sync, or all users.
+func (p *PresenceTracker) sync(ctx context.Context, incremental bool) error {
+	p.mu.RLock()
+	last := p.lastSync
+	p.mu.RUnlock()
+
+	var from *time.Time
+	if incremental {
+		from = &last
+	}
+	users, date, err := p.c.usersPresence(ctx, from)
+	if err != nil {
+		return err
+	}
+
+	// The next sync starts from the clock of the server. The Date header
+	// has whole seconds and is written after the query, so go back a
+	// second; update ignores the statuses it already knows.
+	if !date.IsZero() {
+		p.mu.Lock()
+		p.lastSync = latest(p.lastSync, date.Add(-time.Second))
+		p.mu.Unlock()
+	}
+
+	for _, u := range users {
+		if incremental {
+			p.update(u, "")
+			continue
+		}
+		p.mu.Lock()
+		if _, ok := p.users[u.ID]; !ok {
+			p.users[u.ID] = u
+		}
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+// apply handles a user-status event.
+func (p *PresenceTracker) apply(e *StreamEvent) {
+	v, err := e.Decode()
+	if err != nil {
+		p.c.log.Debugw("decoding user-status", "error", err)
+		return
+	}
+	s := v.(*UserStatusEvent)
+	p.update(User{ID: s.UserID, Username: s.Username, Status: s.Status}, s.StatusText)
+}
+
+// update records the status of u and publishes a change if it differs.
+func (p *PresenceTracker) update(u User, text string) {
+	p.mu.Lock()
+	prev, known := p.users[u.ID]
+	if known {
+		if u.Name == "" {
+			u.Name = prev.Name
+		}
+		if u.Username == "" {
+			u.Username = prev.Username
+		}
+	}
+	p.users[u.ID] = u
+	p.mu.Unlock()
+
+	if known && prev.Status == u.Status {
+		return
+	}
+
+	change := PresenceChange{
+		UserID:     u.ID,
+		Username:   u.Username,
+		Status:     u.Status,
+		Previous:   prev.Status,
+		StatusText: text,
+	}
+	for {
+		select {
+		case p.changes <- change:
+			return
+		default:
+		}
+		select {
+		case <-p.changes:
+		default:
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package rc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestTypingAndStatus(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	alice := srv.AddUser("alice", "secret")
+
+	client := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token), StreamOptions())
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	watcher := New(
+		ServerURL(srv.URL),
+		AccessToken(alice.ID, alice.Token),
+		StreamOptions(
+			RoomEventSubscription(rctest.GeneralID, NotifyTyping),
+			EventSubscription(SubNotifyLogged, NotifyUserStatus),
+		),
+	)
+	if err := watcher.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer watcher.Close(context.Background())
+
+	next := func() interface{} {
+		t.Helper()
+		select {
+		case evt := <-watcher.EventStream():
+			v, err := evt.Decode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for event")
+		}
+		return nil
+	}
+
+	err := client.WhileTyping(context.Background(), rctest.GeneralID, func() error {
+		if e, ok := next().(*TypingEvent); !ok || e.Username != "bot" || !e.Typing {
+			t.Errorf("got %+v, want bot typing", e)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := next().(*TypingEvent); !ok || e.Username != "bot" || e.Typing {
+		t.Errorf("got %+v, want bot stopped typing", e)
+	}
+
+	if err := client.SetStatus(StatusBusy, "in a meeting"); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := next().(*UserStatusEvent); !ok || e.Username != "bot" || e.Status != StatusBusy || e.StatusText != "in a meeting" {
+		t.Errorf("got %+v", e)
+	}
+
+	if err := client.SetAway(true); err != nil {
+		t.Fatal(err)
+	}
+	if e, ok := next().(*UserStatusEvent); !ok || e.Status != StatusAway {
+		t.Errorf("got %+v", e)
+	}
+
+	rest := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	if err := rest.SetTyping(rctest.GeneralID, true); err != ErrNoRealtime {
+		t.Errorf("SetTyping without realtime: err = %v", err)
+	}
+}
+
+func TestPresenceTracker(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	alice := srv.AddUser("alice", "secret")
+
+	realtime := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token), StreamOptions())
+	if err := realtime.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer realtime.Close(context.Background())
+
+	rest := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	if err := rest.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	live, err := NewPresenceTracker(ctx, realtime, PresenceResync(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	polled, err := NewPresenceTracker(ctx, rest, PresenceResync(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := live.StatusOf(alice.ID); s != StatusOnline {
+		t.Errorf("seeded status = %q", s)
+	}
+
+	srv.SetStatus("alice", StatusAway)
+
+	for _, p := range []*PresenceTracker{live, polled} {
+		select {
+		case c := <-p.Changes():
+			if c.UserID != alice.ID || c.Status != StatusAway || c.Previous != StatusOnline {
+				t.Errorf("got change %+v", c)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for change")
+		}
+		if s := p.StatusOf(alice.ID); s != StatusAway {
+			t.Errorf("StatusOf = %q", s)
+		}
+		if online := p.Online(); len(online) != 1 || online[0].ID != bot.ID {
+			t.Errorf("Online = %+v", online)
+		}
+	}
+
+	if s := live.StatusOf("nobody"); s != StatusOffline {
+		t.Errorf("unknown user status = %q", s)
+	}
+
+	for _, p := range []*PresenceTracker{live, polled} {
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := <-p.Changes(); ok {
+			t.Error("Changes not closed")
+		}
+	}
+}
+
+func TestPresenceTrackerPendingWatch(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	release := srv.HoldSubscriptions("user-status")
+	defer release()
+
+	sent := make(chan struct{}, 1)
+	client := New(
+		ServerURL(srv.URL),
+		AccessToken(bot.ID, bot.Token),
+		RecordFrames(frameFunc(func(outgoing bool, frame []byte) {
+			if outgoing && strings.Contains(string(frame), `"user-status"`) {
+				select {
+				case sent <- struct{}{}:
+				default:
+				}
+			}
+		})),
+		StreamOptions(),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	type result struct {
+		p   *PresenceTracker
+		err error
+	}
+	tracked := make(chan result, 1)
+	go func() {
+		p, err := NewPresenceTracker(context.Background(), client, PresenceResync(0))
+		tracked <- result{p, err}
+	}()
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the subscription")
+	}
+
+	// Other subscriptions go on while the tracker waits for the server.
+	subscribed := make(chan error, 1)
+	go func() { subscribed <- client.SubscribeRoom(rctest.GeneralID) }()
+	select {
+	case err := <-subscribed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("SubscribeRoom blocked by the pending watch")
+	}
+
+	release()
+	select {
+	case r := <-tracked:
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		r.p.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("NewPresenceTracker did not return")
+	}
+}
+
+func TestPresenceTrackerServerClock(t *testing.T) {
+	// The server clock is far behind the client.
+	var mu sync.Mutex
+	var from []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		from = append(from, r.URL.Query().Get("from"))
+		mu.Unlock()
+
+		w.Header().Set("Date", "Mon, 01 Jan 2001 00:00:10 GMT")
+		io.WriteString(w, `{"users":[{"_id":"a","username":"alice","status":"online"}],"full":true,"success":true}`)
+	}))
+	defer srv.Close()
+
+	p, err := NewPresenceTracker(context.Background(), New(ServerURL(srv.URL)), PresenceResync(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.sync(context.Background(), true); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if got := strings.Join(from, " "); got != " 2001-01-01T00:00:09Z" {
+		t.Errorf("from = %q", got)
+	}
+}
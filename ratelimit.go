@@ -0,0 +1,162 @@
+package rc
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	headerRateLimit     = "X-RateLimit-Limit"
+	headerRateRemaining = "X-RateLimit-Remaining"
+	headerRateReset     = "X-RateLimit-Reset"
+)
+
+// RateLimit is the rate limit state last reported by the server.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// Exhausted reports whether no requests remain before Reset.
+func (rl RateLimit) Exhausted() bool {
+	return rl.Limit > 0 && rl.Remaining <= 0 && time.Now().Before(rl.Reset)
+}
+
+// RetryPolicy controls how the REST client retries failed requests.
+// Idempotent GET requests are retried on rate limiting, transport errors and
+// 502/503/504 responses. Writes are only retried when QueueWrites is set, and
+// then only after a 429 since the server did not act on the request.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// MinBackoff is the wait before the first retry.
+	MinBackoff time.Duration
+	// MaxBackoff caps the exponential backoff and the wait for a reset.
+	MaxBackoff time.Duration
+	// Jitter adds up to this fraction of the backoff at random.
+	Jitter float64
+	// QueueWrites serializes POST requests and holds them until the rate
+	// limit resets instead of sending them into a 429.
+	QueueWrites bool
+}
+
+// DefaultRetryPolicy returns a RetryPolicy suitable for bulk jobs.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries:  5,
+		MinBackoff:  500 * time.Millisecond,
+		MaxBackoff:  time.Minute,
+		Jitter:      0.2,
+		QueueWrites: true,
+	}
+}
+
+// Retry sets the retry policy used by the REST client.
+// Without it, requests are attempted once.
+func Retry(p RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.retry = &p
+	}
+}
+
+// RateLimit returns the rate limit state from the most recent REST response.
+// Callers can use it to throttle ahead of the server.
+func (c *Client) RateLimit() RateLimit {
+	return c.c.limits.get()
+}
+
+type rateLimiter struct {
+	mu sync.Mutex
+	rl RateLimit
+}
+
+func (l *rateLimiter) get() RateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rl
+}
+
+func (l *rateLimiter) update(h http.Header) {
+	if h == nil || h.Get(headerRateLimit) == "" {
+		return
+	}
+
+	rl := RateLimit{}
+	rl.Limit, _ = strconv.Atoi(h.Get(headerRateLimit))
+	rl.Remaining, _ = strconv.Atoi(h.Get(headerRateRemaining))
+	rl.Reset = parseReset(h.Get(headerRateReset))
+
+	l.mu.Lock()
+	l.rl = rl
+	l.mu.Unlock()
+}
+
+// untilReset returns how long to wait for the limit to reset, or zero if
+// requests remain.
+func (l *rateLimiter) untilReset() time.Duration {
+	rl := l.get()
+	if !rl.Exhausted() {
+		return 0
+	}
+	return time.Until(rl.Reset)
+}
+
+// parseReset reads X-RateLimit-Reset, which Rocket.Chat sends as epoch
+// milliseconds.
+func parseReset(v string) time.Time {
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n <= 0 {
+		return time.Time{}
+	}
+	if n < 1e12 {
+		return time.Unix(n, 0)
+	}
+	return time.Unix(0, n*int64(time.Millisecond))
+}
+
+func (p *RetryPolicy) backoff(attempt int, reset time.Duration) time.Duration {
+	d := reset
+	if d <= 0 {
+		d = p.MinBackoff << uint(attempt)
+	}
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d <= 0) {
+		d = p.MaxBackoff
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+func (p *RetryPolicy) shouldRetry(method string, rr *restReturn) bool {
+	if method != http.MethodGet {
+		return p.QueueWrites && rr.code == http.StatusTooManyRequests
+	}
+	if rr.err != nil {
+		return true
+	}
+	switch rr.code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
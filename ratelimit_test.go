@@ -0,0 +1,108 @@
+package rc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func rateLimitedServer(limited int32) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		reset := time.Now().Add(20*time.Millisecond).UnixNano() / int64(time.Millisecond)
+		w.Header().Set(headerRateLimit, "10")
+		w.Header().Set(headerRateReset, strconv.FormatInt(reset, 10))
+		if n <= limited {
+			w.Header().Set(headerRateRemaining, "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"success":false,"error":"Error, too many requests.","errorType":"error-too-many-requests"}`))
+			return
+		}
+		w.Header().Set(headerRateRemaining, "9")
+		w.Write([]byte(`{"success":true,"channels":[],"message":{}}`))
+	}))
+	return srv, &calls
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{
+		MaxRetries: 3,
+		MinBackoff: time.Millisecond,
+		MaxBackoff: 100 * time.Millisecond,
+		Jitter:     0.1,
+	}
+
+	tests := []struct {
+		name      string
+		policy    *RetryPolicy
+		queue     bool
+		write     bool
+		wantCalls int32
+		wantErr   bool
+	}{
+		{name: "no_policy", write: false, wantCalls: 1, wantErr: true},
+		{name: "get_retried", policy: &policy, write: false, wantCalls: 3},
+		{name: "write_not_retried", policy: &policy, write: true, wantCalls: 1, wantErr: true},
+		{name: "write_queued", policy: &policy, queue: true, write: true, wantCalls: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := rateLimitedServer(2)
+			defer srv.Close()
+
+			opts := []ClientOption{ServerURL(srv.URL)}
+			if tt.policy != nil {
+				p := *tt.policy
+				p.QueueWrites = tt.queue
+				opts = append(opts, Retry(p))
+			}
+			client := New(opts...)
+
+			var err error
+			if tt.write {
+				_, err = client.SendMessage(Message{RoomID: "GENERAL", Text: "hello"})
+			} else {
+				_, err = client.GetChannelList()
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !IsRateLimited(err) {
+				t.Errorf("error = %v, want rate limited", err)
+			}
+			if got := atomic.LoadInt32(calls); got != tt.wantCalls {
+				t.Errorf("server calls = %d, want %d", got, tt.wantCalls)
+			}
+
+			rl := client.RateLimit()
+			if rl.Limit != 10 || rl.Reset.IsZero() {
+				t.Errorf("RateLimit() = %+v, want limit 10 and reset", rl)
+			}
+		})
+	}
+}
+
+func TestUnsentRequest(t *testing.T) {
+	srv, calls := rateLimitedServer(0)
+	defer srv.Close()
+
+	client := New(ServerURL(srv.URL), Debug(true), Retry(RetryPolicy{MaxRetries: 3}))
+
+	// A body that cannot be encoded fails before the request is sent.
+	res := client.c.postJSON(context.Background(), "/chat.postMessage", func() {})
+	if res.Error() == nil {
+		t.Fatal("error = nil, want encoding error")
+	}
+	if res.StatusCode() != 0 || len(res.Body()) != 0 {
+		t.Errorf("result = %d %q, want empty", res.StatusCode(), res.Body())
+	}
+	if got := atomic.LoadInt32(calls); got != 0 {
+		t.Errorf("server calls = %d, want 0", got)
+	}
+}
@@ -1,9 +1,12 @@
 package rc
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -23,9 +26,23 @@ type Client struct {
 	d        *ddpClient
 
 	strOpts []StreamOption
+	retry   *RetryPolicy
+	tr      transport
+	frames  FrameRecorder
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	logoutOnClose bool
+
+	meMu sync.Mutex
+	me   string
 
 	cred *Credential
 	log  *zap.SugaredLogger
+
+	// err is an option error reported by Connect.
+	err error
 }
 
 // ClientOption is a functional argument that sets optional values on Client
@@ -89,6 +106,14 @@ func CredFromJson(path string) ClientOption {
 	}
 }
 
+// LogoutOnClose makes Close invalidate the auth token. Leave it off when
+// using a personal access token that other clients share.
+func LogoutOnClose(b bool) ClientOption {
+	return func(c *Client) {
+		c.logoutOnClose = b
+	}
+}
+
 func Anonymous(b bool) ClientOption {
 	return func(c *Client) {
 		c.anon = true
@@ -110,18 +135,44 @@ func New(options ...ClientOption) *Client {
 	logger := buildLogger(c.debug)
 	c.log = logger.Sugar()
 
-	c.c = newRESTClient(c.url, c.debug, c.log.Named("rest"))
+	hc, err := c.tr.httpClient()
+	if err != nil {
+		c.log.Errorw("ignoring transport options", "error", err)
+		c.err = err
+	}
+	c.c = newRESTClient(c.url, hc, c.debug, c.log.Named("rest"), c.retry)
+	if len(c.tr.headers) > 0 {
+		c.c.SetHeaders(c.tr.headers)
+	}
 
 	return c
 }
 
+// Connect establishes the realtime connection, if configured, and
+// authenticates Client. It fails with ErrTransportOptions if the transport
+// options conflict.
 func (c *Client) Connect() error {
+	return c.ConnectContext(context.Background())
+}
+
+// ConnectContext is like Connect but aborts dialing and authentication
+// when ctx is done.
+func (c *Client) ConnectContext(ctx context.Context) error {
+	if c.err != nil {
+		return c.err
+	}
 	if c.connected {
 		return nil
 	}
 
 	if c.realtime {
-		ddp, err := newDDPClient(c.url, c.debug, c.log.Named("ddp"), c.strOpts...)
+		cfg := ddpConfig{
+			dialer:     c.tr.dialer(),
+			frames:     c.frames,
+			minBackoff: c.minBackoff,
+			maxBackoff: c.maxBackoff,
+		}
+		ddp, err := newDDPClient(ctx, c.url, cfg, c.debug, c.log.Named("ddp"), c.strOpts...)
 		if err != nil {
 			return err
 		}
@@ -136,7 +187,7 @@ func (c *Client) Connect() error {
 	if c.cred.tokenReady() {
 		c.c.setAuthHeader(c.cred.ID, c.cred.Token)
 		if c.realtime {
-			if err := c.Resume(); err != nil {
+			if err := c.ResumeContext(ctx); err != nil {
 				return err
 			}
 		}
@@ -146,14 +197,66 @@ func (c *Client) Connect() error {
 	}
 
 	if c.cred.hasUP() {
-		if err := c.Login(); err != nil {
+		if err := c.LoginContext(ctx); err != nil {
 			return err
 		}
+		c.connected = true
 	}
 
 	return nil
 }
 
+// Close shuts Client down. It unsubscribes from all streams, stops their
+// goroutines and closes the MessageStream, EventStream, StreamErrors and
+// ConnectionStates channels, logs out if LogoutOnClose is set and closes
+// the realtime connection. If ctx is done first Close stops waiting and
+// returns ctx.Err(); the shutdown then finishes in the background.
+func (c *Client) Close(ctx context.Context) error {
+	var err error
+	setErr := func(e error) {
+		if e != nil && err == nil {
+			err = e
+		}
+	}
+
+	if c.d != nil {
+		setErr(waitContext(ctx, c.d.streams.close))
+	}
+
+	if c.logoutOnClose && c.connected && !c.anon {
+		setErr(c.LogoutContext(ctx))
+	}
+
+	if c.d != nil {
+		setErr(waitContext(ctx, c.d.Close))
+	}
+	c.connected = false
+
+	c.c.GetClient().CloseIdleConnections()
+
+	if err == nil {
+		err = ctx.Err()
+	}
+	return err
+}
+
+// waitContext runs fn and waits until it returns or ctx is done, leaving
+// fn to finish on its own in that case.
+func waitContext(ctx context.Context, fn func()) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func getURL() string {
 	u := os.Getenv(rcURL)
 	if u == "" {
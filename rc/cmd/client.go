@@ -14,7 +14,7 @@ func clientOpts() []rc.ClientOption {
 		rc.ServerURL(viper.GetString("server-url")),
 		rc.CredFromJson(viper.GetString("cred-file")),
 		rc.Debug(true),
-		rc.Realtime(true),
+		rc.StreamOptions(),
 	}
 }
 
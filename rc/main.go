@@ -8,6 +8,6 @@ import (
 
 func main() {
 	if err := cmd.Execute(); err != nil {
-		log.Fatalf("Error: ", err)
+		log.Fatalf("Error: %v", err)
 	}
 }
@@ -1,33 +1,59 @@
 package rc
 
 import (
+	"context"
+	"path/filepath"
 	"testing"
 
+	"github.com/blushft/rc/recorder"
 	"github.com/davecgh/go-spew/spew"
 )
 
-func clientOpts() []ClientOption {
-	return []ClientOption{
+// testRecorder replays fixtures/cassettes/<test>.json. Set $RC_RECORD to
+// record it again against the server in clientOpts using ./token.json.
+func testRecorder(t *testing.T) *recorder.Recorder {
+	rec, err := recorder.New(filepath.Join("fixtures", "cassettes", t.Name()+".json"), recorder.ModeFromEnv())
+	if err != nil {
+		t.Fatalf("unable to load cassette: %v", err)
+	}
+	return rec
+}
+
+func clientOpts(rec *recorder.Recorder) []ClientOption {
+	opts := []ClientOption{
 		ServerURL("http://localhost:3000"),
-		CredFromJson("./token.json"),
+		Transport(rec),
+		RecordFrames(rec),
 		//Debug(true),
 		StreamOptions(
 			EventSubscription(SubNotifyAll, NotifyRolesChange),
 		),
 	}
+
+	if rec.Mode() == recorder.ModeRecord {
+		return append(opts, CredFromJson("./token.json"))
+	}
+	return append(opts, AccessToken("huNm2s3vGBWesFLfN", "testtoken"))
 }
 
-func createTestClient() *Client {
-	opts := clientOpts()
+func createTestClient(rec *recorder.Recorder) *Client {
+	opts := clientOpts(rec)
 	return New(opts...)
 }
 
 func TestNew(t *testing.T) {
+	rec := testRecorder(t)
+	defer func() {
+		if err := rec.Stop(); err != nil {
+			t.Error(err)
+		}
+	}()
 
-	client := createTestClient()
+	client := createTestClient(rec)
 	if err := client.Connect(); err != nil {
-		t.Error(err)
+		t.Fatal(err)
 	}
+	defer client.Close(context.Background())
 
 	tests := []struct {
 		name string
@@ -39,7 +65,7 @@ func TestNew(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			result := client.c.getInfo()
+			result := client.c.getInfo(context.Background())
 			if result.Error() != nil {
 				t.Errorf("info request failed: %v", result.Error())
 			}
@@ -0,0 +1,205 @@
+package rctest
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+func (s *Server) chatPinMessage(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	m := s.findMessage(c.param("messageId"))
+	if m == nil || m.Pinned {
+		s.mu.Unlock()
+		return http.StatusBadRequest, failure("The required \"messageId\" param is missing or the message is already pinned.", "error-invalid-message")
+	}
+	m.Pinned = true
+	m.PinnedBy = c.user.Username
+	m.UpdatedAt = time.Now().UTC()
+
+	notice := s.addMessage(m.RoomID, c.user.ID, c.user.Username, "")
+	notice.Type = "message_pinned"
+	pinned, msg := *m, *notice
+	s.mu.Unlock()
+
+	s.broadcastMessage(pinned)
+	s.broadcastMessage(msg)
+	return http.StatusOK, success(map[string]interface{}{"message": messageJSON(&msg, restTime)})
+}
+
+func (s *Server) chatUnpinMessage(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	m := s.findMessage(c.param("messageId"))
+	if m == nil || !m.Pinned {
+		s.mu.Unlock()
+		return http.StatusBadRequest, failure("The message is not pinned.", "error-invalid-message")
+	}
+	m.Pinned = false
+	m.PinnedBy = ""
+	m.UpdatedAt = time.Now().UTC()
+	msg := *m
+	s.mu.Unlock()
+
+	s.broadcastMessage(msg)
+	return http.StatusOK, success(nil)
+}
+
+// chatStar stars or unstars a message for the caller.
+func chatStar(star bool) restHandler {
+	return func(s *Server, c *restCall) (int, interface{}) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		m := s.findMessage(c.param("messageId"))
+		if m == nil {
+			return http.StatusBadRequest, failure("The required \"messageId\" param is missing.", "error-invalid-message")
+		}
+		m.StarredBy = without(m.StarredBy, c.user.ID)
+		if star {
+			m.StarredBy = append(m.StarredBy, c.user.ID)
+		}
+		m.UpdatedAt = time.Now().UTC()
+		return http.StatusOK, success(nil)
+	}
+}
+
+func (s *Server) chatReportMessage(c *restCall) (int, interface{}) {
+	desc := c.param("description")
+	if desc == "" {
+		return http.StatusBadRequest, failure("The required \"description\" param is missing.", "")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	m := s.findMessage(c.param("messageId"))
+	if m == nil {
+		return http.StatusBadRequest, failure("The required \"messageId\" param is missing.", "error-invalid-message")
+	}
+	s.reports = append(s.reports, Report{MessageID: m.ID, UserID: c.user.ID, Description: desc})
+	return http.StatusOK, success(nil)
+}
+
+func (s *Server) chatSearch(c *restCall) (int, interface{}) {
+	text := strings.ToLower(c.param("searchText"))
+	return s.messageList(c, false, func(m *Message) bool {
+		return text != "" && strings.Contains(strings.ToLower(m.Text), text)
+	})
+}
+
+func (s *Server) chatMentioned(c *restCall) (int, interface{}) {
+	return s.messageList(c, true, func(m *Message) bool {
+		for _, u := range m.mentions {
+			if u.ID == c.user.ID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (s *Server) chatPinned(c *restCall) (int, interface{}) {
+	return s.messageList(c, true, func(m *Message) bool { return m.Pinned })
+}
+
+func (s *Server) chatStarred(c *restCall) (int, interface{}) {
+	return s.messageList(c, true, func(m *Message) bool {
+		for _, id := range m.StarredBy {
+			if id == c.user.ID {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// messageList serves a page of the messages of a room matching keep, newest
+// first. chat.search replies without pagination fields.
+func (s *Server) messageList(c *restCall, paged bool, keep func(*Message) bool) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), "")
+	if r == nil || !s.canSee(r, c.user) {
+		return roomNotFound("room")
+	}
+
+	msgs := s.messages[r.ID]
+	var matched []*Message
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if keep(msgs[i]) {
+			matched = append(matched, msgs[i])
+		}
+	}
+
+	offset, end := c.page(len(matched))
+	list := make([]interface{}, 0, end-offset)
+	for _, m := range matched[offset:end] {
+		list = append(list, messageJSON(m, restTime))
+	}
+
+	out := map[string]interface{}{"messages": list}
+	if paged {
+		out["offset"] = offset
+		out["count"] = len(list)
+		out["total"] = len(matched)
+	}
+	return http.StatusOK, success(out)
+}
+
+func (s *Server) chatDeleted(c *restCall) (int, interface{}) {
+	since, err := time.Parse(timeFormat, c.param("since"))
+	if err != nil {
+		return http.StatusBadRequest, failure("The \"since\" query parameter must be a valid date.", "error-invalid-date")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rid := c.param("roomId")
+	var deleted []deletedMessage
+	for _, d := range s.deletedMsgs {
+		if d.roomID == rid && d.at.After(since) {
+			deleted = append(deleted, d)
+		}
+	}
+
+	offset, end := c.page(len(deleted))
+	list := make([]interface{}, 0, end-offset)
+	for _, d := range deleted[offset:end] {
+		list = append(list, map[string]interface{}{"_id": d.id})
+	}
+	return http.StatusOK, success(map[string]interface{}{
+		"messages": list,
+		"offset":   offset,
+		"count":    len(list),
+		"total":    len(deleted),
+	})
+}
+
+func (s *Server) chatSyncMessages(c *restCall) (int, interface{}) {
+	since, err := time.Parse(timeFormat, c.param("lastUpdate"))
+	if err != nil {
+		return http.StatusBadRequest, failure("The \"lastUpdate\" query parameter must be a valid date.", "error-lastUpdate-param-invalid")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rid := c.param("roomId")
+	updated := make([]interface{}, 0)
+	for _, m := range s.messages[rid] {
+		if m.UpdatedAt.After(since) {
+			updated = append(updated, messageJSON(m, restTime))
+		}
+	}
+	deleted := make([]interface{}, 0)
+	for _, d := range s.deletedMsgs {
+		if d.roomID == rid && d.at.After(since) {
+			deleted = append(deleted, map[string]interface{}{"_id": d.id, "_deletedAt": restTime(d.at)})
+		}
+	}
+	return http.StatusOK, success(map[string]interface{}{
+		"result": map[string]interface{}{"updated": updated, "deleted": deleted},
+	})
+}
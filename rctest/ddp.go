@@ -0,0 +1,616 @@
+package rctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// MethodError is a Meteor error returned by a MethodFunc.
+type MethodError struct {
+	Code      interface{}
+	Reason    string
+	ErrorType string
+}
+
+func (e *MethodError) Error() string {
+	return fmt.Sprintf("%s [%v]", e.Reason, e.Code)
+}
+
+func (e *MethodError) json() map[string]interface{} {
+	errorType := e.ErrorType
+	if errorType == "" {
+		errorType = "Meteor.Error"
+	}
+	return map[string]interface{}{
+		"isClientSafe": true,
+		"error":        e.Code,
+		"reason":       e.Reason,
+		"message":      e.Error(),
+		"errorType":    errorType,
+	}
+}
+
+// streamSub is a subscription to one event of a stream.
+type streamSub struct {
+	name  string
+	event string
+}
+
+// session is a connected DDP client.
+type session struct {
+	srv *Server
+	ws  *websocket.Conn
+
+	sendMu sync.Mutex
+
+	mu     sync.Mutex
+	userID string
+	subs   map[string]streamSub
+
+	done chan struct{}
+}
+
+func (s *Server) serveDDP(ws *websocket.Conn) {
+	ss := &session{
+		srv:  s,
+		ws:   ws,
+		subs: make(map[string]streamSub),
+		done: make(chan struct{}),
+	}
+	defer close(ss.done)
+	defer ws.Close()
+
+	s.mu.Lock()
+	s.sessions[ss] = struct{}{}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.sessions, ss)
+		s.mu.Unlock()
+	}()
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+
+		msg := map[string]interface{}{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			ss.send(map[string]interface{}{"msg": "error", "reason": "Bad request", "offendingMessage": string(data)})
+			continue
+		}
+		ss.handle(msg)
+	}
+}
+
+// close disconnects the client and waits for the session to end.
+func (ss *session) close() {
+	ss.ws.Close()
+	<-ss.done
+}
+
+func (ss *session) send(v interface{}) error {
+	ss.sendMu.Lock()
+	defer ss.sendMu.Unlock()
+	return websocket.JSON.Send(ss.ws, v)
+}
+
+func (ss *session) handle(msg map[string]interface{}) {
+	id, _ := msg["id"].(string)
+
+	switch msg["msg"] {
+	case "connect":
+		ss.send(map[string]interface{}{"msg": "connected", "session": newID()})
+	case "ping":
+		pong := map[string]interface{}{"msg": "pong"}
+		if id != "" {
+			pong["id"] = id
+		}
+		ss.send(pong)
+	case "method":
+		method, _ := msg["method"].(string)
+		params, _ := msg["params"].([]interface{})
+		ss.call(id, method, params)
+	case "sub":
+		name, _ := msg["name"].(string)
+		params, _ := msg["params"].([]interface{})
+		ss.sub(id, name, params)
+	case "unsub":
+		ss.mu.Lock()
+		delete(ss.subs, id)
+		ss.mu.Unlock()
+		ss.send(map[string]interface{}{"msg": "nosub", "id": id})
+	}
+}
+
+func (ss *session) call(id, method string, params []interface{}) {
+	ss.mu.Lock()
+	uid := ss.userID
+	ss.mu.Unlock()
+
+	ss.srv.mu.Lock()
+	fn, ok := ss.srv.methods[method]
+	ss.srv.mu.Unlock()
+
+	if ok {
+		res, err := fn(uid, params)
+		ss.result(id, res, err)
+		return
+	}
+
+	if method == "login" {
+		res, err := ss.login(params)
+		ss.result(id, res, err)
+		return
+	}
+
+	builtin, ok := builtinMethods[method]
+	if !ok {
+		ss.result(id, nil, &MethodError{
+			Code:   404,
+			Reason: fmt.Sprintf("Method '%s' not found", method),
+		})
+		return
+	}
+
+	res, err := builtin(ss.srv, uid, params)
+	ss.result(id, res, err)
+}
+
+func (ss *session) result(id string, res interface{}, err error) {
+	out := map[string]interface{}{"msg": "result", "id": id}
+	if err != nil {
+		me, ok := err.(*MethodError)
+		if !ok {
+			me = &MethodError{Code: 500, Reason: err.Error()}
+		}
+		out["error"] = me.json()
+	} else if res != nil {
+		out["result"] = res
+	}
+	ss.send(out)
+	ss.send(map[string]interface{}{"msg": "updated", "methods": []string{id}})
+}
+
+func (ss *session) login(params []interface{}) (interface{}, error) {
+	var token string
+	if len(params) > 0 {
+		if p, ok := params[0].(map[string]interface{}); ok {
+			token, _ = p["resume"].(string)
+		}
+	}
+
+	ss.srv.mu.Lock()
+	u := ss.srv.resumeUser(token)
+	ss.srv.mu.Unlock()
+
+	if u == nil {
+		return nil, &MethodError{
+			Code:   403,
+			Reason: "You've been logged out by the server. Please log in again.",
+		}
+	}
+
+	ss.mu.Lock()
+	ss.userID = u.ID
+	ss.mu.Unlock()
+
+	return map[string]interface{}{
+		"id":           u.ID,
+		"token":        u.Token,
+		"tokenExpires": ddpTime(time.Now().Add(90 * 24 * time.Hour)),
+		"type":         "resume",
+	}, nil
+}
+
+func (ss *session) sub(id, name string, params []interface{}) {
+	if name != "stream-room-messages" && !strings.HasPrefix(name, "stream-notify-") {
+		ss.send(map[string]interface{}{
+			"msg": "nosub",
+			"id":  id,
+			"error": (&MethodError{
+				Code:   404,
+				Reason: fmt.Sprintf("Subscription '%s' not found", name),
+			}).json(),
+		})
+		return
+	}
+
+	var event string
+	if len(params) > 0 {
+		event, _ = params[0].(string)
+	}
+
+	ss.srv.mu.Lock()
+	held := ss.srv.held[event]
+	ss.srv.mu.Unlock()
+
+	ready := func() {
+		ss.mu.Lock()
+		ss.subs[id] = streamSub{name: name, event: event}
+		ss.mu.Unlock()
+
+		ss.send(map[string]interface{}{"msg": "ready", "subs": []string{id}})
+	}
+	if held == nil {
+		ready()
+		return
+	}
+
+	go func() {
+		select {
+		case <-held:
+			ready()
+		case <-ss.done:
+		}
+	}()
+}
+
+// subscribed reports whether the session listens to event on stream.
+func (ss *session) subscribed(stream, event string) bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, sub := range ss.subs {
+		if sub.name == stream && sub.event == event {
+			return true
+		}
+	}
+	return false
+}
+
+// broadcast sends a stream event to every session subscribed to it.
+func (s *Server) broadcast(stream, event string, args []interface{}) {
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for ss := range s.sessions {
+		sessions = append(sessions, ss)
+	}
+	s.mu.Unlock()
+
+	msg := map[string]interface{}{
+		"msg":        "changed",
+		"collection": stream,
+		"id":         "id",
+		"fields": map[string]interface{}{
+			"eventName": event,
+			"args":      args,
+		},
+	}
+
+	for _, ss := range sessions {
+		if ss.subscribed(stream, event) {
+			ss.send(msg)
+		}
+	}
+}
+
+func (s *Server) broadcastMessage(m Message) {
+	s.broadcast("stream-room-messages", m.RoomID, []interface{}{messageJSON(&m, ddpTime)})
+	s.notifyRoom(m.RoomID)
+}
+
+// notifyRoom sends rooms-changed and subscriptions-changed to the members
+// of a room.
+func (s *Server) notifyRoom(roomID string) {
+	s.mu.Lock()
+	r, ok := s.rooms[roomID]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	type change struct {
+		userID    string
+		room, sub map[string]interface{}
+	}
+	var changes []change
+	for _, id := range r.Members {
+		if u, ok := s.users[id]; ok {
+			changes = append(changes, change{id, s.roomJSON(r, ddpTime), s.subscriptionJSON(r, u, ddpTime)})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, c := range changes {
+		s.broadcast("stream-notify-user", c.userID+"/rooms-changed", []interface{}{"updated", c.room})
+		s.broadcast("stream-notify-user", c.userID+"/subscriptions-changed", []interface{}{"updated", c.sub})
+	}
+}
+
+// notifySubscription sends subscriptions-changed to userID.
+func (s *Server) notifySubscription(roomID, userID string) {
+	s.mu.Lock()
+	r, ok := s.rooms[roomID]
+	u := s.users[userID]
+	if !ok || u == nil {
+		s.mu.Unlock()
+		return
+	}
+	sub := s.subscriptionJSON(r, u, ddpTime)
+	s.mu.Unlock()
+
+	s.broadcast("stream-notify-user", userID+"/subscriptions-changed", []interface{}{"updated", sub})
+}
+
+func (s *Server) broadcastDelete(m *Message) {
+	s.broadcast("stream-notify-room", m.RoomID+"/deleteMessage", []interface{}{map[string]interface{}{"_id": m.ID}})
+}
+
+// builtinMethods are the DDP methods the server implements itself besides
+// login, which is handled by the session.
+var builtinMethods = map[string]func(s *Server, userID string, params []interface{}) (interface{}, error){
+	"sendMessage":         (*Server).sendMessageMethod,
+	"rooms/get":           (*Server).roomsGetMethod,
+	"loadMissedMessages":  (*Server).loadMissedMessagesMethod,
+	"updateMessage":       (*Server).updateMessageMethod,
+	"deleteMessage":       (*Server).deleteMessageMethod,
+	"setReaction":         (*Server).setReactionMethod,
+	"readMessages":        (*Server).readMessagesMethod,
+	"stream-notify-room":  (*Server).notifyRoomMethod,
+	"UserPresence:away":   (*Server).presenceAwayMethod,
+	"UserPresence:online": (*Server).presenceOnlineMethod,
+}
+
+// docParam returns params[0] as a document.
+func docParam(params []interface{}) map[string]interface{} {
+	var p map[string]interface{}
+	if len(params) > 0 {
+		p, _ = params[0].(map[string]interface{})
+	}
+	return p
+}
+
+var errNotLoggedIn = &MethodError{Code: "error-not-allowed", Reason: "Not allowed", ErrorType: "Meteor.Error"}
+
+func (s *Server) sendMessageMethod(userID string, params []interface{}) (interface{}, error) {
+	if userID == "" {
+		return nil, errNotLoggedIn
+	}
+
+	p := docParam(params)
+	rid, _ := p["rid"].(string)
+	text, _ := p["msg"].(string)
+	id, _ := p["_id"].(string)
+
+	s.mu.Lock()
+	u := s.users[userID]
+	if _, ok := s.rooms[rid]; !ok || u == nil {
+		s.mu.Unlock()
+		return nil, &MethodError{Code: "error-invalid-room", Reason: "Invalid room"}
+	}
+	// A client retrying a send reuses the id; answer with the stored
+	// message instead of posting it twice.
+	if m := s.findMessage(id); id != "" && m != nil {
+		msg := *m
+		s.mu.Unlock()
+		return messageJSON(&msg, ddpTime), nil
+	}
+	var parent *Message
+	if tmid, _ := p["tmid"].(string); tmid != "" {
+		if parent = s.threadParent(rid, tmid); parent == nil {
+			s.mu.Unlock()
+			return nil, &MethodError{Code: "error-invalid-message", Reason: "Invalid thread"}
+		}
+	}
+	m := s.addMessage(rid, u.ID, u.Username, text)
+	if id != "" {
+		m.ID = id
+	}
+	if alias, ok := p["alias"].(string); ok {
+		m.Alias = alias
+	}
+	var pm Message
+	if parent != nil {
+		pm = *s.reply(m, parent)
+	}
+	msg := *m
+	s.mu.Unlock()
+
+	s.broadcastMessage(msg)
+	if parent != nil {
+		s.broadcastMessage(pm)
+	}
+	return messageJSON(&msg, ddpTime), nil
+}
+
+func (s *Server) roomsGetMethod(userID string, params []interface{}) (interface{}, error) {
+	if userID == "" {
+		return nil, errNotLoggedIn
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update := make([]interface{}, 0)
+	for _, r := range s.sortedRooms("") {
+		if r.Type != Channel && !isMember(r, userID) {
+			continue
+		}
+		update = append(update, map[string]interface{}{
+			"_id":        r.ID,
+			"name":       r.Name,
+			"t":          r.Type,
+			"_updatedAt": ddpTime(r.UpdatedAt),
+		})
+	}
+	return map[string]interface{}{
+		"update": update,
+		"remove": []interface{}{},
+	}, nil
+}
+
+func (s *Server) loadMissedMessagesMethod(userID string, params []interface{}) (interface{}, error) {
+	if userID == "" {
+		return nil, errNotLoggedIn
+	}
+
+	var rid string
+	var since float64
+	if len(params) > 1 {
+		rid, _ = params[0].(string)
+		if ts, ok := params[1].(map[string]interface{}); ok {
+			since, _ = ts["$date"].(float64)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := make([]interface{}, 0)
+	msgList := s.messages[rid]
+	for i := len(msgList) - 1; i >= 0; i-- {
+		m := msgList[i]
+		if float64(m.Timestamp.UnixNano()/int64(time.Millisecond)) <= since {
+			continue
+		}
+		msgs = append(msgs, messageJSON(m, ddpTime))
+	}
+	return msgs, nil
+}
+
+func ddpTime(t time.Time) interface{} {
+	return map[string]interface{}{"$date": t.UnixNano() / int64(time.Millisecond)}
+}
+
+func (s *Server) updateMessageMethod(userID string, params []interface{}) (interface{}, error) {
+	if userID == "" {
+		return nil, errNotLoggedIn
+	}
+
+	p := docParam(params)
+	id, _ := p["_id"].(string)
+	text, _ := p["msg"].(string)
+
+	s.mu.Lock()
+	var m *Message
+	if u := s.users[userID]; u != nil {
+		m = s.editMessage(id, u.Username, text)
+	}
+	if m == nil {
+		s.mu.Unlock()
+		return nil, &MethodError{Code: "error-action-not-allowed", Reason: "Message editing not allowed"}
+	}
+	msg := *m
+	s.mu.Unlock()
+
+	s.broadcastMessage(msg)
+	return nil, nil
+}
+
+func (s *Server) deleteMessageMethod(userID string, params []interface{}) (interface{}, error) {
+	if userID == "" {
+		return nil, errNotLoggedIn
+	}
+
+	id, _ := docParam(params)["_id"].(string)
+
+	s.mu.Lock()
+	m := s.removeMessage(id)
+	s.mu.Unlock()
+	if m == nil {
+		return nil, &MethodError{Code: "error-action-not-allowed", Reason: "Not allowed"}
+	}
+
+	s.broadcastDelete(m)
+	return nil, nil
+}
+
+func (s *Server) setReactionMethod(userID string, params []interface{}) (interface{}, error) {
+	if userID == "" {
+		return nil, errNotLoggedIn
+	}
+
+	var emoji, id string
+	react := true
+	if len(params) > 1 {
+		emoji, _ = params[0].(string)
+		id, _ = params[1].(string)
+	}
+	if len(params) > 2 {
+		if v, ok := params[2].(bool); ok {
+			react = v
+		}
+	}
+
+	s.mu.Lock()
+	var m *Message
+	if u := s.users[userID]; u != nil {
+		m = s.react(id, u.Username, emoji, react)
+	}
+	if m == nil {
+		s.mu.Unlock()
+		return nil, &MethodError{Code: "error-not-allowed", Reason: "Not allowed"}
+	}
+	msg := *m
+	s.mu.Unlock()
+
+	s.broadcastMessage(msg)
+	return nil, nil
+}
+
+func (s *Server) readMessagesMethod(userID string, params []interface{}) (interface{}, error) {
+	if userID == "" {
+		return nil, errNotLoggedIn
+	}
+
+	var rid string
+	if len(params) > 0 {
+		rid, _ = params[0].(string)
+	}
+
+	s.mu.Lock()
+	s.markRead(rid, userID)
+	s.mu.Unlock()
+
+	s.notifySubscription(rid, userID)
+	return nil, nil
+}
+
+// notifyRoomMethod relays a client event, such as typing, to the clients
+// subscribed to it.
+func (s *Server) notifyRoomMethod(userID string, params []interface{}) (interface{}, error) {
+	if userID == "" {
+		return nil, errNotLoggedIn
+	}
+
+	var event string
+	if len(params) > 0 {
+		event, _ = params[0].(string)
+	}
+	if !strings.HasSuffix(event, "/typing") || len(params) < 2 {
+		return nil, &MethodError{Code: "error-not-allowed", Reason: "Not allowed"}
+	}
+
+	s.broadcast("stream-notify-room", event, params[1:])
+	return nil, nil
+}
+
+func (s *Server) presenceAwayMethod(userID string, params []interface{}) (interface{}, error) {
+	return s.setPresence(userID, "away")
+}
+
+func (s *Server) presenceOnlineMethod(userID string, params []interface{}) (interface{}, error) {
+	return s.setPresence(userID, "online")
+}
+
+func (s *Server) setPresence(userID, status string) (interface{}, error) {
+	if userID == "" {
+		return nil, errNotLoggedIn
+	}
+
+	s.mu.Lock()
+	u := s.users[userID]
+	if u == nil {
+		s.mu.Unlock()
+		return nil, errNotLoggedIn
+	}
+	s.setStatus(u, status, u.StatusText)
+	return nil, nil
+}
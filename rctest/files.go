@@ -0,0 +1,225 @@
+package rctest
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// File is a file uploaded to a room.
+type File struct {
+	ID          string
+	RoomID      string
+	UserID      string
+	Username    string
+	Name        string
+	Type        string
+	Description string
+	Data        []byte
+	Uploaded    time.Time
+}
+
+// AddFile stores a file in a room as if username had uploaded it.
+func (s *Server) AddFile(roomID, username, name, mimeType string, data []byte) File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f := &File{
+		ID:       newID(),
+		RoomID:   roomID,
+		Name:     name,
+		Type:     mimeType,
+		Data:     append([]byte(nil), data...),
+		Username: username,
+		Uploaded: time.Now().UTC(),
+	}
+	if u := s.userByName(username); u != nil {
+		f.UserID = u.ID
+	}
+	s.files[f.ID] = f
+
+	return *f
+}
+
+// Files returns the files uploaded to a room, oldest first.
+func (s *Server) Files(roomID string) []File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var files []File
+	for _, f := range s.files {
+		if f.RoomID == roomID {
+			files = append(files, *f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Uploaded.Before(files[j].Uploaded) })
+	return files
+}
+
+// roomsUpload serves rooms.upload/:rid. The multipart body is read as it
+// arrives and must hold a "file" part.
+func (s *Server) roomsUpload(c *restCall) (int, interface{}) {
+	mr, err := c.r.MultipartReader()
+	if err != nil {
+		return http.StatusBadRequest, failure(err.Error(), "error-invalid-body")
+	}
+
+	fields := map[string]string{}
+	var f *File
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return http.StatusBadRequest, failure(err.Error(), "error-invalid-body")
+		}
+
+		data, err := ioutil.ReadAll(p)
+		if err != nil {
+			return http.StatusBadRequest, failure(err.Error(), "error-invalid-body")
+		}
+		if p.FormName() != "file" {
+			fields[p.FormName()] = string(data)
+			continue
+		}
+
+		typ := p.Header.Get("Content-Type")
+		if typ == "" || typ == "application/octet-stream" {
+			typ = http.DetectContentType(data)
+		}
+		f = &File{
+			ID:   newID(),
+			Name: p.FileName(),
+			Type: strings.Split(typ, ";")[0],
+			Data: data,
+		}
+	}
+	if f == nil {
+		return http.StatusBadRequest, failure("[No file uploaded]", "error-invalid-file")
+	}
+
+	s.mu.Lock()
+	r := s.findRoom(c.id, "")
+	if r == nil || !isMember(r, c.user.ID) {
+		s.mu.Unlock()
+		return roomNotFound("room")
+	}
+	var parent *Message
+	if tmid := fields["tmid"]; tmid != "" {
+		if parent = s.threadParent(r.ID, tmid); parent == nil {
+			s.mu.Unlock()
+			return http.StatusBadRequest, failure("Invalid thread", "error-invalid-message")
+		}
+	}
+
+	f.RoomID = r.ID
+	f.UserID = c.user.ID
+	f.Username = c.user.Username
+	f.Description = fields["description"]
+	f.Uploaded = time.Now().UTC()
+	s.files[f.ID] = f
+
+	mp := s.addMessage(r.ID, c.user.ID, c.user.Username, fields["msg"])
+	mp.File = f
+	var p Message
+	if parent != nil {
+		p = *s.reply(mp, parent)
+	}
+	m := *mp
+	s.mu.Unlock()
+
+	s.broadcastMessage(m)
+	if parent != nil {
+		s.broadcastMessage(p)
+	}
+	return http.StatusOK, success(map[string]interface{}{"message": messageJSON(&m, restTime)})
+}
+
+// serveFile serves /file-upload/<id>/<name> to members of the room of the
+// file.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/file-upload/"), "/", 2)
+
+	s.mu.Lock()
+	u := s.userByToken(r.Header.Get("X-User-Id"), r.Header.Get("X-Auth-Token"))
+	f, ok := s.files[parts[0]]
+	if ok {
+		room, found := s.rooms[f.RoomID]
+		ok = found && u != nil && s.canSee(room, u)
+	}
+	s.mu.Unlock()
+
+	switch {
+	case u == nil:
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	case !ok:
+		http.NotFound(w, r)
+	default:
+		w.Header().Set("Content-Type", f.Type)
+		w.Write(f.Data)
+	}
+}
+
+// roomFiles serves channels.files, groups.files and im.files, newest first.
+func (s *Server) roomFiles(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), c.param("roomName"))
+	if r == nil {
+		return roomNotFound("room")
+	}
+
+	var files []*File
+	for _, f := range s.files {
+		if f.RoomID == r.ID {
+			files = append(files, f)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Uploaded.Equal(files[j].Uploaded) {
+			return files[i].ID > files[j].ID
+		}
+		return files[i].Uploaded.After(files[j].Uploaded)
+	})
+
+	offset, end := c.page(len(files))
+	list := make([]interface{}, 0, end-offset)
+	for _, f := range files[offset:end] {
+		list = append(list, fileJSON(f))
+	}
+
+	return http.StatusOK, success(map[string]interface{}{
+		"files":  list,
+		"offset": offset,
+		"count":  len(list),
+		"total":  len(files),
+	})
+}
+
+func fileJSON(f *File) map[string]interface{} {
+	return map[string]interface{}{
+		"_id":         f.ID,
+		"name":        f.Name,
+		"type":        f.Type,
+		"size":        len(f.Data),
+		"rid":         f.RoomID,
+		"userId":      f.UserID,
+		"user":        map[string]interface{}{"_id": f.UserID, "username": f.Username},
+		"description": f.Description,
+		"url":         fileURL(f),
+		"uploadedAt":  restTime(f.Uploaded),
+		"complete":    true,
+		"uploading":   false,
+		"store":       "GridFS:Uploads",
+	}
+}
+
+func fileURL(f *File) string {
+	return "/file-upload/" + f.ID + "/" + url.PathEscape(f.Name)
+}
@@ -0,0 +1,131 @@
+package rctest
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+func imAction(fn roomAction) restHandler {
+	return func(s *Server, c *restCall) (int, interface{}) {
+		return s.roomWrite(c, Direct, fn)
+	}
+}
+
+func (s *Server) imCreate(c *restCall) (int, interface{}) {
+	names := strings.Split(c.param("usernames", "username"), ",")
+
+	s.mu.Lock()
+	members := []*User{c.user}
+	for _, n := range names {
+		u := s.userByName(strings.TrimSpace(n))
+		if u == nil {
+			s.mu.Unlock()
+			return http.StatusBadRequest, failure("Invalid user", "error-invalid-user")
+		}
+		if u != c.user {
+			members = append(members, u)
+		}
+	}
+	r := s.directRoom(members)
+	body := success(map[string]interface{}{"room": s.directJSON(r)})
+	s.mu.Unlock()
+
+	s.notifyRoom(r.ID)
+	return http.StatusOK, body
+}
+
+// directRoom returns the direct message room between exactly members,
+// creating it if needed. s.mu must be held.
+func (s *Server) directRoom(members []*User) *Room {
+	ids := make([]string, 0, len(members))
+	names := make([]string, 0, len(members))
+	for _, u := range members {
+		ids = append(ids, u.ID)
+		names = append(names, u.Username)
+	}
+	sort.Strings(ids)
+
+	for _, r := range s.sortedRooms(Direct) {
+		have := append([]string(nil), r.Members...)
+		sort.Strings(have)
+		if strings.Join(have, ",") == strings.Join(ids, ",") {
+			return r
+		}
+	}
+
+	r := s.newRoom("", Direct, names)
+	if len(ids) == 2 {
+		// Two party rooms are keyed by their sorted member ids.
+		delete(s.rooms, r.ID)
+		r.ID = strings.Join(ids, "")
+		s.rooms[r.ID] = r
+	}
+	r.Roles = make(map[string][]string)
+	return r
+}
+
+// directJSON renders a direct message room as returned by im.create and
+// im.list. s.mu must be held.
+func (s *Server) directJSON(r *Room) map[string]interface{} {
+	out := s.roomJSON(r, restTime)
+	delete(out, "name")
+	delete(out, "fname")
+	delete(out, "u")
+	out["rid"] = r.ID
+	out["uids"] = r.Members
+	return out
+}
+
+func (s *Server) imList(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rooms []*Room
+	for _, r := range s.sortedRooms(Direct) {
+		if isMember(r, c.user.ID) {
+			rooms = append(rooms, r)
+		}
+	}
+
+	offset, end := c.page(len(rooms))
+	list := make([]interface{}, 0, end-offset)
+	for _, r := range rooms[offset:end] {
+		list = append(list, s.directJSON(r))
+	}
+
+	return http.StatusOK, success(map[string]interface{}{
+		"ims":    list,
+		"offset": offset,
+		"count":  len(list),
+		"total":  len(rooms),
+	})
+}
+
+func (s *Server) imMessages(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := s.messages[c.param("roomId")]
+	newest := make([]*Message, 0, len(msgs))
+	for i := len(msgs) - 1; i >= 0; i-- {
+		newest = append(newest, msgs[i])
+	}
+
+	offset, end := c.page(len(newest))
+	list := make([]interface{}, 0, end-offset)
+	for _, m := range newest[offset:end] {
+		list = append(list, messageJSON(m, restTime))
+	}
+
+	return http.StatusOK, success(map[string]interface{}{
+		"messages": list,
+		"offset":   offset,
+		"count":    len(list),
+		"total":    len(newest),
+	})
+}
+
+func (s *Server) imMembers(c *restCall) (int, interface{}) {
+	return s.members(c, Direct)
+}
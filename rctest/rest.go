@@ -0,0 +1,1065 @@
+package rctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// timeFormat matches the timestamps returned by the Rocket.Chat REST api.
+const timeFormat = "2006-01-02T15:04:05.999Z"
+
+// defaultCount is the page size used when a request has no count.
+const defaultCount = 50
+
+// restCall is a REST request with its decoded body and authenticated user.
+// id is the last path segment of routes registered with a trailing "/:id".
+type restCall struct {
+	r    *http.Request
+	user *User
+	body map[string]interface{}
+	id   string
+}
+
+// param returns the first non-empty query or body value for names.
+func (c *restCall) param(names ...string) string {
+	for _, n := range names {
+		if v := c.r.URL.Query().Get(n); v != "" {
+			return v
+		}
+		if v, ok := c.body[n].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func (c *restCall) page(total int) (int, int) {
+	offset, _ := strconv.Atoi(c.param("offset"))
+	count := defaultCount
+	if v := c.param("count"); v != "" {
+		count, _ = strconv.Atoi(v)
+	}
+
+	if offset > total {
+		offset = total
+	}
+	end := total
+	if count > 0 && offset+count < total {
+		end = offset + count
+	}
+	return offset, end
+}
+
+type restHandler func(s *Server, c *restCall) (int, interface{})
+
+// public endpoints do not require an auth token.
+var public = map[string]bool{
+	"/api/info":     true,
+	"/api/v1/info":  true,
+	"/api/v1/login": true,
+}
+
+var restHandlers = map[string]restHandler{
+	"GET /api/info":      (*Server).info,
+	"GET /api/v1/info":   (*Server).info,
+	"POST /api/v1/login": (*Server).login, "POST /api/v1/logout": (*Server).logout,
+	"GET /api/v1/me":                        (*Server).me,
+	"GET /api/v1/channels.list":             (*Server).channelsList,
+	"GET /api/v1/channels.info":             (*Server).channelsInfo,
+	"GET /api/v1/channels.members":          (*Server).channelsMembers,
+	"GET /api/v1/channels.history":          (*Server).channelsHistory,
+	"GET /api/v1/channels.counters":         (*Server).channelsCounters,
+	"GET /api/v1/channels.online":           (*Server).channelsOnline,
+	"GET /api/v1/channels.roles":            (*Server).channelsRoles,
+	"POST /api/v1/channels.create":          (*Server).channelsCreate,
+	"POST /api/v1/channels.delete":          (*Server).channelsDelete,
+	"POST /api/v1/channels.archive":         channelAction(archiveRoom(true)),
+	"POST /api/v1/channels.unarchive":       channelAction(archiveRoom(false)),
+	"POST /api/v1/channels.rename":          channelAction(renameRoom),
+	"POST /api/v1/channels.setTopic":        channelAction(setRoomText("topic", func(r *Room) *string { return &r.Topic })),
+	"POST /api/v1/channels.setPurpose":      channelAction(setRoomText("purpose", func(r *Room) *string { return &r.Description })),
+	"POST /api/v1/channels.setDescription":  channelAction(setRoomText("description", func(r *Room) *string { return &r.Description })),
+	"POST /api/v1/channels.setAnnouncement": channelAction(setRoomText("announcement", func(r *Room) *string { return &r.Announcement })),
+	"POST /api/v1/channels.setReadOnly":     channelAction(setRoomReadOnly),
+	"POST /api/v1/channels.setType":         channelAction(setRoomType),
+	"POST /api/v1/channels.setJoinCode":     channelAction(setRoomJoinCode),
+	"POST /api/v1/channels.invite":          channelAction(inviteToRoom),
+	"POST /api/v1/channels.kick":            channelAction(kickFromRoom),
+	"POST /api/v1/channels.join":            channelAction(joinRoom),
+	"POST /api/v1/channels.leave":           channelAction(leaveRoom),
+	"POST /api/v1/channels.addOwner":        channelAction(setRoomRole("owner", true)),
+	"POST /api/v1/channels.removeOwner":     channelAction(setRoomRole("owner", false)),
+	"POST /api/v1/channels.addModerator":    channelAction(setRoomRole("moderator", true)),
+	"POST /api/v1/channels.removeModerator": channelAction(setRoomRole("moderator", false)),
+	"POST /api/v1/channels.addLeader":       channelAction(setRoomRole("leader", true)),
+	"GET /api/v1/groups.listAll":            (*Server).groupsList,
+	"GET /api/v1/groups.members":            (*Server).groupsMembers,
+	"GET /api/v1/groups.list":               (*Server).groupsListJoined,
+	"GET /api/v1/groups.info":               (*Server).groupsInfo,
+	"GET /api/v1/groups.history":            memberRead(Group, (*Server).channelsHistory),
+	"GET /api/v1/groups.counters":           memberRead(Group, (*Server).channelsCounters),
+	"GET /api/v1/groups.roles":              memberRead(Group, (*Server).channelsRoles),
+	"POST /api/v1/groups.create":            (*Server).groupsCreate,
+	"POST /api/v1/groups.delete":            (*Server).groupsDelete,
+	"POST /api/v1/groups.archive":           groupAction(archiveRoom(true)),
+	"POST /api/v1/groups.unarchive":         groupAction(archiveRoom(false)),
+	"POST /api/v1/groups.rename":            groupAction(renameRoom),
+	"POST /api/v1/groups.setType":           groupAction(setRoomType),
+	"POST /api/v1/groups.invite":            groupAction(inviteToRoom),
+	"POST /api/v1/groups.kick":              groupAction(kickFromRoom),
+	"POST /api/v1/groups.leave":             groupAction(leaveRoom),
+	"POST /api/v1/groups.open":              groupAction(openRoom(true)),
+	"POST /api/v1/groups.close":             groupAction(openRoom(false)),
+	"POST /api/v1/groups.addOwner":          groupAction(setRoomRole("owner", true)),
+	"POST /api/v1/groups.removeOwner":       groupAction(setRoomRole("owner", false)),
+	"POST /api/v1/groups.addModerator":      groupAction(setRoomRole("moderator", true)),
+	"POST /api/v1/groups.removeModerator":   groupAction(setRoomRole("moderator", false)),
+	"POST /api/v1/groups.addLeader":         groupAction(setRoomRole("leader", true)),
+	"POST /api/v1/im.create":                (*Server).imCreate,
+	"GET /api/v1/im.list":                   (*Server).imList,
+	"GET /api/v1/im.history":                memberRead(Direct, (*Server).channelsHistory),
+	"GET /api/v1/im.messages":               memberRead(Direct, (*Server).imMessages),
+	"GET /api/v1/im.members":                memberRead(Direct, (*Server).imMembers),
+	"GET /api/v1/im.counters":               memberRead(Direct, (*Server).channelsCounters),
+	"GET /api/v1/im.files":                  memberRead(Direct, (*Server).roomFiles), "GET /api/v1/channels.files": memberRead(Channel, (*Server).roomFiles), "GET /api/v1/groups.files": memberRead(Group, (*Server).roomFiles), "POST /api/v1/rooms.upload/:id": (*Server).roomsUpload,
+	"POST /api/v1/im.open":                  imAction(openRoom(true)),
+	"POST /api/v1/im.close":                 imAction(openRoom(false)),
+	"GET /api/v1/rooms.get":                 (*Server).roomsGet,
+	"GET /api/v1/rooms.info":                (*Server).roomsInfo,
+	"GET /api/v1/subscriptions.get":         (*Server).subscriptionsGet,
+	"GET /api/v1/users.list":                (*Server).usersList,
+	"GET /api/v1/users.info":                (*Server).usersInfo,
+	"GET /api/v1/users.presence":            (*Server).usersPresence,
+	"POST /api/v1/chat.sendMessage":         (*Server).chatSendMessage,
+	"POST /api/v1/chat.postMessage":         (*Server).chatSendMessage,
+	"GET /api/v1/chat.getMessage":           (*Server).chatGetMessage,
+	"POST /api/v1/chat.update":              (*Server).chatUpdate,
+	"POST /api/v1/chat.delete":              (*Server).chatDelete,
+	"POST /api/v1/chat.react":               (*Server).chatReact,
+	"POST /api/v1/chat.pinMessage":          (*Server).chatPinMessage,
+	"POST /api/v1/chat.unPinMessage":        (*Server).chatUnpinMessage,
+	"POST /api/v1/chat.starMessage":         chatStar(true),
+	"POST /api/v1/chat.unStarMessage":       chatStar(false),
+	"POST /api/v1/chat.reportMessage":       (*Server).chatReportMessage,
+	"GET /api/v1/chat.search":               (*Server).chatSearch,
+	"GET /api/v1/chat.getMentionedMessages": (*Server).chatMentioned,
+	"GET /api/v1/chat.getPinnedMessages":    (*Server).chatPinned,
+	"GET /api/v1/chat.getStarredMessages":   (*Server).chatStarred,
+	"GET /api/v1/chat.getDeletedMessages":   (*Server).chatDeleted,
+	"GET /api/v1/chat.syncMessages":         (*Server).chatSyncMessages,
+	"GET /api/v1/chat.getThreadsList":       (*Server).chatThreadsList,
+	"GET /api/v1/chat.getThreadMessages":    (*Server).chatThreadMessages,
+	"GET /api/v1/chat.syncThreadMessages":   (*Server).chatSyncThreadMessages,
+	"POST /api/v1/chat.followMessage":       chatFollow(true),
+	"POST /api/v1/chat.unfollowMessage":     chatFollow(false),
+	"POST /api/v1/rooms.createDiscussion":   (*Server).roomsCreateDiscussion,
+	"POST /api/v1/subscriptions.read":       (*Server).subscriptionsRead,
+	"POST /api/v1/users.setStatus":          (*Server).usersSetStatus,
+	"POST /api/v1/integrations.create":      (*Server).integrationsCreate,
+	"GET /api/v1/integrations.list":         (*Server).integrationsList,
+}
+
+func (s *Server) serveREST(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimRight(r.URL.Path, "/")
+	var id string
+	h, ok := restHandlers[r.Method+" "+path]
+	if i := strings.LastIndex(path, "/"); !ok && i > 0 {
+		id = path[i+1:]
+		h, ok = restHandlers[r.Method+" "+path[:i]+"/:id"]
+	}
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]interface{}{
+			"status":  "error",
+			"message": "API endpoint \"" + path + "\" does not exist",
+		})
+		return
+	}
+
+	c := &restCall{r: r, body: map[string]interface{}{}, id: id}
+	if r.Method == http.MethodPost {
+		if err := decodeBody(r, &c.body); err != nil {
+			writeJSON(w, http.StatusBadRequest, failure(err.Error(), "error-invalid-body"))
+			return
+		}
+	}
+
+	if !public[path] {
+		s.mu.Lock()
+		c.user = s.userByToken(r.Header.Get("X-User-Id"), r.Header.Get("X-Auth-Token"))
+		s.mu.Unlock()
+		if c.user == nil {
+			writeJSON(w, http.StatusUnauthorized, map[string]interface{}{
+				"status":  "error",
+				"message": "You must be logged in to do this.",
+			})
+			return
+		}
+	}
+
+	code, body := h(s, c)
+	writeJSON(w, code, body)
+}
+
+func (s *Server) serveHook(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/hooks/"), "/"), "/")
+
+	s.mu.Lock()
+	var hook *Integration
+	if len(parts) == 2 {
+		if i, ok := s.integrations[parts[0]]; ok && i.Token == parts[1] && i.Type == "webhook-incoming" {
+			hook = i
+		}
+	}
+	s.mu.Unlock()
+
+	if hook == nil {
+		writeJSON(w, http.StatusNotFound, failure("Invalid integration id or token provided.", "error-invalid-integration"))
+		return
+	}
+
+	body := struct {
+		Text    string `json:"text"`
+		Alias   string `json:"alias"`
+		Channel string `json:"channel"`
+		RoomID  string `json:"roomId"`
+	}{}
+	if err := decodeBody(r, &body); err != nil {
+		writeJSON(w, http.StatusBadRequest, failure(err.Error(), "error-invalid-body"))
+		return
+	}
+
+	channel := hook.Channel
+	if body.Channel != "" {
+		channel = body.Channel
+	}
+
+	s.mu.Lock()
+	room := s.findRoom(body.RoomID, strings.TrimPrefix(channel, "#"))
+	if room == nil {
+		s.mu.Unlock()
+		writeJSON(w, http.StatusBadRequest, failure("invalid-channel", "invalid-channel"))
+		return
+	}
+	var uid string
+	if u := s.userByName(hook.Username); u != nil {
+		uid = u.ID
+	}
+	m := s.addMessage(room.ID, uid, hook.Username, body.Text)
+	m.Alias = body.Alias
+	msg := *m
+	s.mu.Unlock()
+
+	s.broadcastMessage(msg)
+	writeJSON(w, http.StatusOK, success(nil))
+}
+
+func (s *Server) info(c *restCall) (int, interface{}) {
+	return http.StatusOK, success(map[string]interface{}{"version": "3.0.0"})
+}
+
+func (s *Server) login(c *restCall) (int, interface{}) {
+	name := c.param("user", "username")
+	pass := c.param("password")
+
+	s.mu.Lock()
+	u := s.userByName(name)
+	s.mu.Unlock()
+
+	if u == nil || u.Password == "" || u.Password != pass {
+		return http.StatusUnauthorized, map[string]interface{}{
+			"status":  "error",
+			"error":   "Unauthorized",
+			"message": "Unauthorized",
+		}
+	}
+
+	return http.StatusOK, map[string]interface{}{
+		"status": "success",
+		"data": map[string]interface{}{
+			"authToken": u.Token,
+			"userId":    u.ID,
+			"me":        userJSON(u),
+		},
+	}
+}
+
+func (s *Server) logout(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	c.user.Token = newID() + newID()
+	s.mu.Unlock()
+
+	return http.StatusOK, map[string]interface{}{
+		"status": "success",
+		"data":   map[string]interface{}{"message": "You've been logged out!"},
+	}
+}
+
+func (s *Server) me(c *restCall) (int, interface{}) {
+	return http.StatusOK, success(userJSON(c.user))
+}
+
+func (s *Server) channelsList(c *restCall) (int, interface{}) {
+	return s.roomList(c, Channel, "channels")
+}
+
+func (s *Server) groupsList(c *restCall) (int, interface{}) {
+	return s.roomList(c, Group, "groups")
+}
+
+func (s *Server) roomList(c *restCall, typ, key string) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rooms := s.sortedRooms(typ)
+	offset, end := c.page(len(rooms))
+	list := make([]interface{}, 0, end-offset)
+	for _, r := range rooms[offset:end] {
+		list = append(list, s.roomJSON(r, restTime))
+	}
+
+	return http.StatusOK, success(map[string]interface{}{
+		key:      list,
+		"offset": offset,
+		"count":  len(list),
+		"total":  len(rooms),
+	})
+}
+
+func (s *Server) channelsInfo(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), c.param("roomName"))
+	if r == nil || r.Type != Channel {
+		return roomNotFound("channel")
+	}
+	return http.StatusOK, success(map[string]interface{}{"channel": s.roomJSON(r, restTime)})
+}
+
+func (s *Server) roomsInfo(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), c.param("roomName"))
+	if r == nil {
+		return roomNotFound("room")
+	}
+	return http.StatusOK, success(map[string]interface{}{"room": s.roomJSON(r, restTime)})
+}
+
+func (s *Server) channelsMembers(c *restCall) (int, interface{}) {
+	return s.members(c, Channel)
+}
+
+func (s *Server) groupsMembers(c *restCall) (int, interface{}) {
+	return s.members(c, Group)
+}
+
+func (s *Server) members(c *restCall, typ string) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), c.param("roomName"))
+	if r == nil || r.Type != typ {
+		return roomNotFound("room")
+	}
+
+	offset, end := c.page(len(r.Members))
+	list := make([]interface{}, 0, end-offset)
+	for _, id := range r.Members[offset:end] {
+		if u, ok := s.users[id]; ok {
+			list = append(list, map[string]interface{}{
+				"_id":      u.ID,
+				"username": u.Username,
+				"name":     u.Name,
+				"status":   u.Status,
+			})
+		}
+	}
+
+	return http.StatusOK, success(map[string]interface{}{
+		"members": list,
+		"offset":  offset,
+		"count":   len(list),
+		"total":   len(r.Members),
+	})
+}
+
+func (s *Server) channelsHistory(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), "")
+	if r == nil {
+		return roomNotFound("room")
+	}
+
+	msgs := s.messages[r.ID]
+	newest := make([]*Message, 0, len(msgs))
+	for i := len(msgs) - 1; i >= 0; i-- {
+		newest = append(newest, msgs[i])
+	}
+
+	offset, end := c.page(len(newest))
+	list := make([]interface{}, 0, end-offset)
+	for _, m := range newest[offset:end] {
+		list = append(list, messageJSON(m, restTime))
+	}
+
+	return http.StatusOK, success(map[string]interface{}{"messages": list})
+}
+
+func (s *Server) channelsCounters(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), c.param("roomName"))
+	if r == nil {
+		return roomNotFound("room")
+	}
+
+	return http.StatusOK, success(map[string]interface{}{
+		"joined":  isMember(r, c.user.ID),
+		"members": len(r.Members),
+		"unreads": 0,
+		"msgs":    len(s.messages[r.ID]),
+	})
+}
+
+func (s *Server) channelsOnline(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), "")
+	if r == nil {
+		return roomNotFound("room")
+	}
+
+	online := make([]interface{}, 0)
+	for _, id := range r.Members {
+		if u, ok := s.users[id]; ok && u.Status != "offline" {
+			online = append(online, map[string]interface{}{"_id": u.ID, "username": u.Username})
+		}
+	}
+	return http.StatusOK, success(map[string]interface{}{"online": online})
+}
+
+func (s *Server) channelsRoles(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), c.param("roomName"))
+	if r == nil {
+		return roomNotFound("room")
+	}
+
+	roles := make([]interface{}, 0)
+	for _, id := range r.Members {
+		u, ok := s.users[id]
+		if !ok || len(r.Roles[id]) == 0 {
+			continue
+		}
+		roles = append(roles, map[string]interface{}{
+			"_id":   r.ID + u.ID,
+			"rid":   r.ID,
+			"u":     map[string]interface{}{"_id": u.ID, "username": u.Username, "name": u.Name},
+			"roles": r.Roles[id],
+		})
+	}
+	return http.StatusOK, success(map[string]interface{}{"roles": roles})
+}
+
+// updatedSince parses the updatedSince parameter of rooms.get and
+// subscriptions.get.
+func (c *restCall) updatedSince() (time.Time, bool) {
+	v := c.param("updatedSince")
+	if v == "" {
+		return time.Time{}, true
+	}
+	t, err := time.Parse(timeFormat, v)
+	return t, err == nil
+}
+
+func (s *Server) roomsGet(c *restCall) (int, interface{}) {
+	since, ok := c.updatedSince()
+	if !ok {
+		return http.StatusBadRequest, failure("The \"updatedSince\" query parameter must be a valid date.", "error-updatedSince-param-invalid")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update := make([]interface{}, 0)
+	for _, r := range s.sortedRooms("") {
+		if (r.Type == Channel || isMember(r, c.user.ID)) && r.UpdatedAt.After(since) {
+			update = append(update, s.roomJSON(r, restTime))
+		}
+	}
+	remove := make([]interface{}, 0)
+	if !since.IsZero() {
+		for _, d := range s.deleted {
+			if d.at.After(since) && (d.room.Type == Channel || isMember(&d.room, c.user.ID)) {
+				remove = append(remove, map[string]interface{}{"_id": d.room.ID, "_deletedAt": restTime(d.at)})
+			}
+		}
+	}
+	return http.StatusOK, success(map[string]interface{}{
+		"update": update,
+		"remove": remove,
+	})
+}
+
+func (s *Server) subscriptionsGet(c *restCall) (int, interface{}) {
+	since, ok := c.updatedSince()
+	if !ok {
+		return http.StatusBadRequest, failure("The \"updatedSince\" query parameter must be a valid date.", "error-updatedSince-param-invalid")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	update := make([]interface{}, 0)
+	for _, r := range s.sortedRooms("") {
+		if isMember(r, c.user.ID) && s.subscriptionUpdated(r, c.user.ID).After(since) {
+			update = append(update, s.subscriptionJSON(r, c.user, restTime))
+		}
+	}
+	remove := make([]interface{}, 0)
+	if !since.IsZero() {
+		for _, d := range s.deleted {
+			if d.at.After(since) && isMember(&d.room, c.user.ID) {
+				remove = append(remove, map[string]interface{}{
+					"_id":        d.room.ID + c.user.ID,
+					"rid":        d.room.ID,
+					"_deletedAt": restTime(d.at),
+				})
+			}
+		}
+	}
+	return http.StatusOK, success(map[string]interface{}{
+		"update": update,
+		"remove": remove,
+	})
+}
+
+func (s *Server) usersList(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := s.sortedUsers()
+	offset, end := c.page(len(users))
+	list := make([]interface{}, 0, end-offset)
+	for _, u := range users[offset:end] {
+		list = append(list, userJSON(u))
+	}
+
+	return http.StatusOK, success(map[string]interface{}{
+		"users":  list,
+		"offset": offset,
+		"count":  len(list),
+		"total":  len(users),
+	})
+}
+
+func (s *Server) usersInfo(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u, ok := s.users[c.param("userId")]
+	if !ok {
+		u = s.userByName(c.param("username"))
+	}
+	if u == nil {
+		return http.StatusBadRequest, failure("User not found.", "error-invalid-user")
+	}
+	return http.StatusOK, success(map[string]interface{}{"user": userJSON(u)})
+}
+
+func (s *Server) usersPresence(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var from time.Time
+	if v := c.param("from"); v != "" {
+		t, err := time.Parse(timeFormat, v)
+		if err != nil {
+			return http.StatusBadRequest, failure("Invalid from date", "error-invalid-date")
+		}
+		from = t
+	}
+
+	list := make([]interface{}, 0, len(s.users))
+	for _, u := range s.sortedUsers() {
+		if !from.IsZero() && u.statusAt.Before(from) {
+			continue
+		}
+		list = append(list, userJSON(u))
+	}
+	return http.StatusOK, success(map[string]interface{}{"users": list, "full": from.IsZero()})
+}
+
+func (s *Server) usersSetStatus(c *restCall) (int, interface{}) {
+	status := c.param("status")
+	switch status {
+	case "online", "away", "busy", "offline":
+	default:
+		return http.StatusBadRequest, failure("Invalid status", "error-invalid-status")
+	}
+
+	s.mu.Lock()
+	u := s.users[c.user.ID]
+	if u == nil {
+		s.mu.Unlock()
+		return http.StatusBadRequest, failure("Invalid user", "error-invalid-user")
+	}
+	s.setStatus(u, status, c.param("message"))
+	return http.StatusOK, success(nil)
+}
+
+func (s *Server) chatSendMessage(c *restCall) (int, interface{}) {
+	var rid, text, tmid string
+	if m, ok := c.body["message"].(map[string]interface{}); ok {
+		rid, _ = m["rid"].(string)
+		text, _ = m["msg"].(string)
+		tmid, _ = m["tmid"].(string)
+	} else {
+		rid = c.param("roomId", "room_id")
+		text = c.param("text", "msg")
+		tmid = c.param("tmid")
+	}
+	channel := strings.TrimPrefix(c.param("channel"), "#")
+
+	s.mu.Lock()
+	r := s.findRoom(rid, channel)
+	if r == nil {
+		s.mu.Unlock()
+		return roomNotFound("room")
+	}
+	var parent *Message
+	if tmid != "" {
+		if parent = s.threadParent(r.ID, tmid); parent == nil {
+			s.mu.Unlock()
+			return http.StatusBadRequest, failure("Invalid thread", "error-invalid-message")
+		}
+	}
+	mp := s.addMessage(r.ID, c.user.ID, c.user.Username, text)
+	var p Message
+	if parent != nil {
+		p = *s.reply(mp, parent)
+	}
+	m := *mp
+	s.mu.Unlock()
+
+	s.broadcastMessage(m)
+	if parent != nil {
+		s.broadcastMessage(p)
+	}
+	return http.StatusOK, success(map[string]interface{}{
+		"message": messageJSON(&m, restTime),
+		"channel": r.Name,
+		"ts":      m.Timestamp.UnixNano() / int64(time.Millisecond),
+	})
+}
+
+func (s *Server) chatGetMessage(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := c.param("msgId")
+	for _, msgs := range s.messages {
+		for _, m := range msgs {
+			if m.ID == id {
+				return http.StatusOK, success(map[string]interface{}{"message": messageJSON(m, restTime)})
+			}
+		}
+	}
+	return http.StatusBadRequest, failure("Message not found", "error-message-not-found")
+}
+
+func (s *Server) chatUpdate(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	m := s.editMessage(c.param("msgId"), c.user.Username, c.param("text"))
+	if m == nil {
+		s.mu.Unlock()
+		return http.StatusBadRequest, failure("The room id provided does not match where the message is from.", "")
+	}
+	msg := *m
+	s.mu.Unlock()
+
+	s.broadcastMessage(msg)
+	return http.StatusOK, success(map[string]interface{}{"message": messageJSON(&msg, restTime)})
+}
+
+func (s *Server) chatDelete(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	m := s.removeMessage(c.param("msgId"))
+	s.mu.Unlock()
+	if m == nil {
+		return http.StatusBadRequest, failure("No message found with the id of \""+c.param("msgId")+"\".", "")
+	}
+
+	s.broadcastDelete(m)
+	return http.StatusOK, success(map[string]interface{}{
+		"_id": m.ID,
+		"ts":  time.Now().UnixNano() / int64(time.Millisecond),
+	})
+}
+
+func (s *Server) chatReact(c *restCall) (int, interface{}) {
+	react := true
+	if v, ok := c.body["shouldReact"].(bool); ok {
+		react = v
+	}
+
+	s.mu.Lock()
+	m := s.react(c.param("messageId"), c.user.Username, c.param("emoji"), react)
+	if m == nil {
+		s.mu.Unlock()
+		return http.StatusBadRequest, failure("[error-not-allowed]", "error-not-allowed")
+	}
+	msg := *m
+	s.mu.Unlock()
+
+	s.broadcastMessage(msg)
+	return http.StatusOK, success(nil)
+}
+
+func (s *Server) subscriptionsRead(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	s.markRead(c.param("rid"), c.user.ID)
+	s.mu.Unlock()
+
+	s.notifySubscription(c.param("rid"), c.user.ID)
+	return http.StatusOK, success(nil)
+}
+
+func (s *Server) integrationsCreate(c *restCall) (int, interface{}) {
+	i := &Integration{
+		ID:       newID(),
+		Type:     c.param("type"),
+		Name:     c.param("name"),
+		Event:    c.param("event"),
+		Username: c.param("username"),
+		Channel:  c.param("channel"),
+		Token:    c.param("token"),
+		UserID:   c.user.ID,
+		Created:  time.Now().UTC(),
+	}
+	i.Enabled, _ = c.body["enabled"].(bool)
+	if urls, ok := c.body["urls"].([]interface{}); ok {
+		for _, u := range urls {
+			if v, ok := u.(string); ok {
+				i.URLs = append(i.URLs, v)
+			}
+		}
+	}
+
+	switch i.Type {
+	case "webhook-incoming":
+		if i.Token == "" {
+			i.Token = newID() + newID()
+		}
+	case "webhook-outgoing":
+	default:
+		return http.StatusBadRequest, failure("Invalid integration type.", "error-invalid-type")
+	}
+
+	s.mu.Lock()
+	s.integrations[i.ID] = i
+	s.mu.Unlock()
+
+	return http.StatusOK, success(map[string]interface{}{"integration": integrationJSON(i)})
+}
+
+func (s *Server) integrationsList(c *restCall) (int, interface{}) {
+	list := s.Integrations()
+
+	offset, end := c.page(len(list))
+	out := make([]interface{}, 0, end-offset)
+	for i := range list[offset:end] {
+		out = append(out, integrationJSON(&list[offset+i]))
+	}
+
+	return http.StatusOK, success(map[string]interface{}{
+		"integrations": out,
+		"offset":       offset,
+		"items":        len(out),
+		"total":        len(list),
+	})
+}
+
+// findRoom looks a room up by id, then by name. s.mu must be held.
+func (s *Server) findRoom(id, name string) *Room {
+	if r, ok := s.rooms[id]; ok {
+		return r
+	}
+	if name != "" {
+		return s.roomByName(name)
+	}
+	return nil
+}
+
+// roomJSON renders r as returned by the REST api. s.mu must be held.
+// subscriptionUpdated returns when the subscription of userID to r last
+// changed. s.mu must be held.
+func (s *Server) subscriptionUpdated(r *Room, userID string) time.Time {
+	t := r.UpdatedAt
+	if read := s.reads[userID][r.ID]; read.After(t) {
+		t = read
+	}
+	return t
+}
+
+// subscriptionJSON renders the subscription of u to r. Messages from other
+// users posted after u last read the room are unread. s.mu must be held.
+func (s *Server) subscriptionJSON(r *Room, u *User, ts func(time.Time) interface{}) map[string]interface{} {
+	read := s.reads[u.ID][r.ID]
+	unread := 0
+	for _, m := range s.messages[r.ID] {
+		if m.UserID != u.ID && m.Timestamp.After(read) {
+			unread++
+		}
+	}
+
+	return map[string]interface{}{
+		"_id":        r.ID + u.ID,
+		"rid":        r.ID,
+		"t":          r.Type,
+		"name":       r.Name,
+		"ts":         ts(r.Created),
+		"_updatedAt": ts(s.subscriptionUpdated(r, u.ID)),
+		"open":       !s.closed[u.ID][r.ID],
+		"alert":      unread > 0,
+		"unread":     unread,
+		"u":          map[string]interface{}{"_id": u.ID, "username": u.Username},
+	}
+}
+
+func (s *Server) roomJSON(r *Room, ts func(time.Time) interface{}) map[string]interface{} {
+	usernames := make([]string, 0, len(r.Members))
+	for _, id := range r.Members {
+		if u, ok := s.users[id]; ok {
+			usernames = append(usernames, u.Username)
+		}
+	}
+
+	out := map[string]interface{}{
+		"_id":        r.ID,
+		"name":       r.Name,
+		"fname":      r.Name,
+		"t":          r.Type,
+		"usernames":  usernames,
+		"msgs":       len(s.messages[r.ID]),
+		"usersCount": len(r.Members),
+		"ts":         ts(r.Created),
+		"ro":         r.ReadOnly,
+		"sysMes":     true,
+		"default":    r.ID == GeneralID,
+		"_updatedAt": ts(r.UpdatedAt),
+	}
+	if r.Fname != "" {
+		out["fname"] = r.Fname
+	}
+	if r.ParentID != "" {
+		out["prid"] = r.ParentID
+	}
+	if r.Topic != "" {
+		out["topic"] = r.Topic
+	}
+	if r.Description != "" {
+		out["description"] = r.Description
+	}
+	if r.Announcement != "" {
+		out["announcement"] = r.Announcement
+	}
+	if r.Archived {
+		out["archived"] = true
+	}
+	if r.JoinCode != "" {
+		out["joinCodeRequired"] = true
+	}
+	if u, ok := s.users[r.Owner]; ok {
+		out["u"] = map[string]interface{}{"_id": u.ID, "username": u.Username}
+	}
+	if msgs := s.messages[r.ID]; len(msgs) > 0 {
+		out["lm"] = ts(msgs[len(msgs)-1].Timestamp)
+	}
+	return out
+}
+
+func userJSON(u *User) map[string]interface{} {
+	return map[string]interface{}{
+		"_id":        u.ID,
+		"username":   u.Username,
+		"name":       u.Name,
+		"status":     u.Status,
+		"statusText": u.StatusText,
+		"active":     true,
+		"type":       "user",
+		"roles":      u.Roles,
+		"utcOffset":  0,
+	}
+}
+
+func integrationJSON(i *Integration) map[string]interface{} {
+	urls := i.URLs
+	if urls == nil {
+		urls = []string{}
+	}
+	return map[string]interface{}{
+		"_id":           i.ID,
+		"type":          i.Type,
+		"name":          i.Name,
+		"enabled":       i.Enabled,
+		"username":      i.Username,
+		"event":         i.Event,
+		"urls":          urls,
+		"scriptEnabled": false,
+		"userId":        i.UserID,
+		"channel":       []string{i.Channel},
+		"token":         i.Token,
+		"_createdAt":    restTime(i.Created),
+		"_createdBy":    map[string]interface{}{"_id": i.UserID},
+		"_updatedAt":    restTime(i.Created),
+	}
+}
+
+// messageJSON renders m with timestamps formatted by ts, which differs
+// between the REST and realtime apis.
+func messageJSON(m *Message, ts func(time.Time) interface{}) map[string]interface{} {
+	out := map[string]interface{}{
+		"_id":        m.ID,
+		"rid":        m.RoomID,
+		"msg":        m.Text,
+		"ts":         ts(m.Timestamp),
+		"u":          map[string]interface{}{"_id": m.UserID, "username": m.Username, "name": m.Username},
+		"_updatedAt": ts(m.UpdatedAt),
+		"mentions":   []interface{}{},
+		"channels":   []interface{}{},
+	}
+	if len(m.mentions) > 0 {
+		mentions := make([]interface{}, 0, len(m.mentions))
+		for _, u := range m.mentions {
+			mentions = append(mentions, map[string]interface{}{"_id": u.ID, "username": u.Username})
+		}
+		out["mentions"] = mentions
+	}
+	if m.Type != "" {
+		out["t"] = m.Type
+	}
+	if m.ThreadID != "" {
+		out["tmid"] = m.ThreadID
+	}
+	if m.ThreadCount > 0 {
+		out["tcount"] = m.ThreadCount
+		out["tlm"] = ts(m.ThreadLast)
+		out["replies"] = m.Replies
+	}
+	if m.DiscussionID != "" {
+		out["drid"] = m.DiscussionID
+	}
+	if f := m.File; f != nil {
+		out["file"] = map[string]interface{}{"_id": f.ID, "name": f.Name, "type": f.Type}
+		out["attachments"] = []interface{}{map[string]interface{}{
+			"type":                "file",
+			"title":               f.Name,
+			"title_link":          fileURL(f),
+			"title_link_download": true,
+			"description":         f.Description,
+		}}
+	}
+	if m.Pinned {
+		out["pinned"] = true
+		out["pinnedBy"] = map[string]interface{}{"username": m.PinnedBy}
+	}
+	if len(m.StarredBy) > 0 {
+		starred := make([]interface{}, 0, len(m.StarredBy))
+		for _, id := range m.StarredBy {
+			starred = append(starred, map[string]interface{}{"_id": id})
+		}
+		out["starred"] = starred
+	}
+	if m.Alias != "" {
+		out["alias"] = m.Alias
+	}
+	if m.EditedBy != "" {
+		out["editedAt"] = ts(m.UpdatedAt)
+		out["editedBy"] = map[string]interface{}{"username": m.EditedBy}
+	}
+	if len(m.Reactions) > 0 {
+		reactions := map[string]interface{}{}
+		for emoji, users := range m.Reactions {
+			reactions[emoji] = map[string]interface{}{"usernames": users}
+		}
+		out["reactions"] = reactions
+	}
+	return out
+}
+
+func restTime(t time.Time) interface{} {
+	return t.UTC().Format(timeFormat)
+}
+
+func success(v map[string]interface{}) map[string]interface{} {
+	if v == nil {
+		v = map[string]interface{}{}
+	}
+	v["success"] = true
+	return v
+}
+
+func failure(msg, errorType string) map[string]interface{} {
+	return map[string]interface{}{
+		"success":   false,
+		"error":     msg,
+		"errorType": errorType,
+	}
+}
+
+func roomNotFound(kind string) (int, interface{}) {
+	return http.StatusBadRequest, failure(
+		fmt.Sprintf("The required \"roomId\" or \"roomName\" param provided does not match any %s [error-room-not-found]", kind),
+		"error-room-not-found",
+	)
+}
+
+func decodeBody(r *http.Request, v interface{}) error {
+	if r.Body == nil {
+		return nil
+	}
+	// Multipart bodies are left for the handler to stream.
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		return nil
+	}
+	defer r.Body.Close()
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+		m, ok := v.(*map[string]interface{})
+		if !ok {
+			return nil
+		}
+		for k := range r.PostForm {
+			(*m)[k] = r.PostForm.Get(k)
+		}
+		return nil
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,367 @@
+package rctest
+
+import (
+	"net/http"
+	"time"
+)
+
+// roomAction implements a write endpoint on an existing room. It runs with
+// s.mu held.
+type roomAction func(s *Server, c *restCall, r *Room) (int, interface{})
+
+// roomWrite looks up the room of a channels.* or groups.* write request and
+// applies fn to it. Members are notified of successful changes.
+func (s *Server) roomWrite(c *restCall, typ string, fn roomAction) (int, interface{}) {
+	s.mu.Lock()
+	r := s.findRoom(c.param("roomId"), c.param("roomName"))
+	if r == nil || r.Type != typ || !s.canSee(r, c.user) {
+		s.mu.Unlock()
+		return roomNotFound(roomKind(typ))
+	}
+
+	code, body := fn(s, c, r)
+	if code == http.StatusOK {
+		r.UpdatedAt = time.Now().UTC()
+	}
+	id := r.ID
+	s.mu.Unlock()
+
+	if code == http.StatusOK {
+		s.notifyRoom(id)
+	}
+	return code, body
+}
+
+func channelAction(fn roomAction) restHandler {
+	return func(s *Server, c *restCall) (int, interface{}) {
+		return s.roomWrite(c, Channel, fn)
+	}
+}
+
+func groupAction(fn roomAction) restHandler {
+	return func(s *Server, c *restCall) (int, interface{}) {
+		return s.roomWrite(c, Group, fn)
+	}
+}
+
+// memberRead wraps a read endpoint so it only serves rooms of type typ the
+// caller can see.
+func memberRead(typ string, h restHandler) restHandler {
+	return func(s *Server, c *restCall) (int, interface{}) {
+		s.mu.Lock()
+		r := s.findRoom(c.param("roomId"), c.param("roomName"))
+		ok := r != nil && r.Type == typ && s.canSee(r, c.user)
+		s.mu.Unlock()
+		if !ok {
+			return roomNotFound(roomKind(typ))
+		}
+		return h(s, c)
+	}
+}
+
+// canSee reports whether u can find r. Private groups and direct messages
+// are hidden from non-members. s.mu must be held.
+func (s *Server) canSee(r *Room, u *User) bool {
+	return r.Type == Channel || isMember(r, u.ID)
+}
+
+func (s *Server) groupsListJoined(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rooms []*Room
+	for _, r := range s.sortedRooms(Group) {
+		if isMember(r, c.user.ID) {
+			rooms = append(rooms, r)
+		}
+	}
+
+	offset, end := c.page(len(rooms))
+	list := make([]interface{}, 0, end-offset)
+	for _, r := range rooms[offset:end] {
+		list = append(list, s.roomJSON(r, restTime))
+	}
+
+	return http.StatusOK, success(map[string]interface{}{
+		"groups": list,
+		"offset": offset,
+		"count":  len(list),
+		"total":  len(rooms),
+	})
+}
+
+func (s *Server) groupsInfo(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("roomId"), c.param("roomName"))
+	if r == nil || r.Type != Group || !s.canSee(r, c.user) {
+		return roomNotFound("group")
+	}
+	return http.StatusOK, s.roomReply(r)
+}
+
+func (s *Server) groupsCreate(c *restCall) (int, interface{}) {
+	return s.createRoom(c, Group)
+}
+
+func (s *Server) groupsDelete(c *restCall) (int, interface{}) {
+	return s.deleteRoom(c, Group)
+}
+
+func (s *Server) channelsCreate(c *restCall) (int, interface{}) {
+	return s.createRoom(c, Channel)
+}
+
+func (s *Server) channelsDelete(c *restCall) (int, interface{}) {
+	return s.deleteRoom(c, Channel)
+}
+
+func (s *Server) createRoom(c *restCall, typ string) (int, interface{}) {
+	name := c.param("name")
+	if name == "" {
+		return http.StatusBadRequest, failure("Body param \"name\" is required", "error-invalid-room-name")
+	}
+
+	members := []string{c.user.Username}
+	if list, ok := c.body["members"].([]interface{}); ok {
+		for _, m := range list {
+			if v, ok := m.(string); ok {
+				members = append(members, v)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	if s.roomByName(name) != nil {
+		s.mu.Unlock()
+		return http.StatusBadRequest, failure("A channel with name '"+name+"' exists", "error-duplicate-channel-name")
+	}
+	r := s.newRoom(name, typ, members)
+	r.ReadOnly, _ = c.body["readOnly"].(bool)
+	body := s.roomReply(r)
+	s.mu.Unlock()
+
+	s.notifyRoom(r.ID)
+	return http.StatusOK, body
+}
+
+func (s *Server) deleteRoom(c *restCall, typ string) (int, interface{}) {
+	s.mu.Lock()
+	r := s.findRoom(c.param("roomId"), c.param("roomName"))
+	if r == nil || r.Type != typ || !s.canSee(r, c.user) {
+		s.mu.Unlock()
+		return roomNotFound(roomKind(typ))
+	}
+	id := r.ID
+	s.mu.Unlock()
+
+	s.DeleteRoom(id)
+	return http.StatusOK, success(nil)
+}
+
+// roomReply renders r under the key the api uses for its type. s.mu must
+// be held.
+func (s *Server) roomReply(r *Room) map[string]interface{} {
+	key := "room"
+	switch r.Type {
+	case Channel:
+		key = "channel"
+	case Group:
+		key = "group"
+	}
+	return success(map[string]interface{}{key: s.roomJSON(r, restTime)})
+}
+
+func archiveRoom(archived bool) roomAction {
+	return func(s *Server, c *restCall, r *Room) (int, interface{}) {
+		r.Archived = archived
+		return http.StatusOK, success(nil)
+	}
+}
+
+// openRoom shows or hides the room in the caller's room list.
+func openRoom(open bool) roomAction {
+	return func(s *Server, c *restCall, r *Room) (int, interface{}) {
+		closed := s.closed[c.user.ID]
+		if open == !closed[r.ID] {
+			state := "closed to"
+			if open {
+				state = "open for"
+			}
+			return http.StatusBadRequest, failure("The "+roomKind(r.Type)+" is already "+state+" the sender", "")
+		}
+
+		if open {
+			delete(closed, r.ID)
+		} else {
+			if closed == nil {
+				closed = make(map[string]bool)
+				s.closed[c.user.ID] = closed
+			}
+			closed[r.ID] = true
+		}
+		return http.StatusOK, success(nil)
+	}
+}
+
+func renameRoom(s *Server, c *restCall, r *Room) (int, interface{}) {
+	name := c.param("name")
+	if name == "" {
+		return http.StatusBadRequest, failure("The bodyParam \"name\" is required", "error-invalid-room-name")
+	}
+	if other := s.roomByName(name); other != nil && other != r {
+		return http.StatusBadRequest, failure("A channel with name '"+name+"' exists", "error-duplicate-channel-name")
+	}
+	r.Name = name
+	return http.StatusOK, s.roomReply(r)
+}
+
+// setRoomText sets a text field from the body param of the same name.
+func setRoomText(param string, field func(*Room) *string) roomAction {
+	return func(s *Server, c *restCall, r *Room) (int, interface{}) {
+		v, ok := c.body[param].(string)
+		if !ok {
+			return http.StatusBadRequest, failure("The bodyParam \""+param+"\" is required", "")
+		}
+		*field(r) = v
+		return http.StatusOK, success(map[string]interface{}{param: v})
+	}
+}
+
+func setRoomReadOnly(s *Server, c *restCall, r *Room) (int, interface{}) {
+	ro, ok := c.body["readOnly"].(bool)
+	if !ok {
+		return http.StatusBadRequest, failure("The bodyParam \"readOnly\" is required", "")
+	}
+	r.ReadOnly = ro
+	return http.StatusOK, s.roomReply(r)
+}
+
+func setRoomType(s *Server, c *restCall, r *Room) (int, interface{}) {
+	typ := c.param("type")
+	if typ != Channel && typ != Group {
+		return http.StatusBadRequest, failure("The bodyParam \"type\" is required", "")
+	}
+	r.Type = typ
+	return http.StatusOK, s.roomReply(r)
+}
+
+func setRoomJoinCode(s *Server, c *restCall, r *Room) (int, interface{}) {
+	r.JoinCode = c.param("joinCode")
+	return http.StatusOK, s.roomReply(r)
+}
+
+func inviteToRoom(s *Server, c *restCall, r *Room) (int, interface{}) {
+	u, ok := s.users[c.param("userId")]
+	if !ok {
+		return http.StatusBadRequest, failure("The required \"userId\" param provided does not match any users", "error-invalid-user")
+	}
+	if !isMember(r, u.ID) {
+		r.Members = append(r.Members, u.ID)
+	}
+	return http.StatusOK, s.roomReply(r)
+}
+
+func kickFromRoom(s *Server, c *restCall, r *Room) (int, interface{}) {
+	id := c.param("userId")
+	if !isMember(r, id) {
+		return http.StatusBadRequest, failure("User is not in this room", "error-user-not-in-room")
+	}
+	removeMember(r, id)
+	return http.StatusOK, s.roomReply(r)
+}
+
+func joinRoom(s *Server, c *restCall, r *Room) (int, interface{}) {
+	if r.JoinCode != "" && c.param("joinCode") != r.JoinCode {
+		return http.StatusBadRequest, failure("Invalid Code", "error-code-invalid")
+	}
+	if !isMember(r, c.user.ID) {
+		r.Members = append(r.Members, c.user.ID)
+	}
+	return http.StatusOK, s.roomReply(r)
+}
+
+func leaveRoom(s *Server, c *restCall, r *Room) (int, interface{}) {
+	if !isMember(r, c.user.ID) {
+		return http.StatusBadRequest, failure("You are not in this room", "error-user-not-in-room")
+	}
+	if hasRole(r, c.user.ID, "owner") && len(usersWithRole(r, "owner")) == 1 {
+		return http.StatusBadRequest, failure("You are the last owner. Please set new owner before leaving the room.", "error-you-are-last-owner")
+	}
+	removeMember(r, c.user.ID)
+	return http.StatusOK, s.roomReply(r)
+}
+
+// setRoomRole adds or removes a room role of the userId member.
+func setRoomRole(role string, add bool) roomAction {
+	return func(s *Server, c *restCall, r *Room) (int, interface{}) {
+		id := c.param("userId")
+		if !isMember(r, id) {
+			return http.StatusBadRequest, failure("User is not in this room", "error-user-not-in-room")
+		}
+
+		has := hasRole(r, id, role)
+		switch {
+		case add && has:
+			return http.StatusBadRequest, failure("User is already "+role, "error-user-already-"+role)
+		case !add && !has:
+			return http.StatusBadRequest, failure("User is not "+role, "error-user-not-"+role)
+		case !add && role == "owner" && len(usersWithRole(r, role)) == 1:
+			return http.StatusBadRequest, failure("This is the last owner. Please set a new owner before removing this one.", "error-remove-last-owner")
+		}
+
+		if add {
+			r.Roles[id] = append(r.Roles[id], role)
+		} else {
+			r.Roles[id] = without(r.Roles[id], role)
+		}
+		return http.StatusOK, success(nil)
+	}
+}
+
+func removeMember(r *Room, userID string) {
+	r.Members = without(r.Members, userID)
+	delete(r.Roles, userID)
+}
+
+func hasRole(r *Room, userID, role string) bool {
+	for _, v := range r.Roles[userID] {
+		if v == role {
+			return true
+		}
+	}
+	return false
+}
+
+func usersWithRole(r *Room, role string) []string {
+	var ids []string
+	for _, id := range r.Members {
+		if hasRole(r, id, role) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func without(list []string, v string) []string {
+	out := list[:0]
+	for _, s := range list {
+		if s != v {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func roomKind(typ string) string {
+	switch typ {
+	case Channel:
+		return "channel"
+	case Group:
+		return "group"
+	case Direct:
+		return "direct message room"
+	}
+	return "room"
+}
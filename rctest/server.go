@@ -0,0 +1,708 @@
+// Package rctest provides an in-process fake Rocket.Chat server for tests.
+//
+// The server implements the REST endpoints used by package rc and a DDP
+// websocket at /websocket on top of an in-memory model of users, rooms and
+// messages. Tests seed the model, point a client at Server.URL and drive
+// the server from the test:
+//
+//	srv := rctest.NewServer()
+//	defer srv.Close()
+//	bot := srv.AddUser("bot", "secret")
+//	client := rc.New(rc.ServerURL(srv.URL), rc.AccessToken(bot.ID, bot.Token),
+//		rc.StreamOptions(rc.RoomSubscription(rctest.GeneralID)))
+//	srv.PostMessage(rctest.GeneralID, "bot", "hello")
+//
+// The package does not import rc so it can be used from rc's own tests.
+package rctest
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/websocket"
+)
+
+// GeneralID is the id of the "general" channel every server starts with.
+const GeneralID = "GENERAL"
+
+// Room types, as in the "t" field of a room.
+const (
+	Channel = "c"
+	Group   = "p"
+	Direct  = "d"
+)
+
+// User is a user account on the server. Token is accepted both as a REST
+// auth token and as a DDP resume token.
+type User struct {
+	ID       string
+	Username string
+	Name     string
+	Password string
+	Token    string
+	Status   string
+	// StatusText is the status message set with users.setStatus.
+	StatusText string
+	Roles      []string
+
+	statusAt time.Time
+}
+
+// Room is a channel, private group or direct message room.
+type Room struct {
+	ID        string
+	Name      string
+	Type      string
+	Owner     string
+	Members   []string
+	ReadOnly  bool
+	Created   time.Time
+	UpdatedAt time.Time
+	// Fname is the display name of discussions, whose Name is generated.
+	Fname string
+	// ParentID is the id of the parent room of a discussion.
+	ParentID string
+
+	Topic        string
+	Description  string
+	Announcement string
+	Archived     bool
+	JoinCode     string
+	// Roles maps member ids to their room roles, such as "owner",
+	// "moderator" and "leader".
+	Roles map[string][]string
+}
+
+// Message is a message posted to a room.
+type Message struct {
+	ID        string
+	RoomID    string
+	Text      string
+	UserID    string
+	Username  string
+	Alias     string
+	Timestamp time.Time
+	UpdatedAt time.Time
+	// EditedBy is the username of the last editor.
+	EditedBy string
+	// Reactions maps emoji, such as ":+1:", to the usernames that reacted.
+	Reactions map[string][]string
+	// Type is the system message type, such as "message_pinned", or empty
+	// for user messages.
+	Type     string
+	Pinned   bool
+	PinnedBy string
+	// StarredBy holds the ids of the users that starred the message.
+	StarredBy []string
+	// ThreadID is the id of the thread parent of a reply.
+	ThreadID    string
+	ThreadCount int
+	ThreadLast  time.Time
+	// Replies holds the ids of the users following the thread started by
+	// the message.
+	Replies []string
+	// DiscussionID is the id of the discussion started from the message.
+	DiscussionID string
+	// File is the file uploaded with the message.
+	File *File
+
+	mentions []User
+}
+
+// Report is a message reported with chat.reportMessage.
+type Report struct {
+	MessageID   string
+	UserID      string
+	Description string
+}
+
+// deletedMessage is reported by chat.getDeletedMessages and
+// chat.syncMessages.
+type deletedMessage struct {
+	id, roomID string
+	at         time.Time
+}
+
+// Integration is a webhook integration created through integrations.create
+// or AddWebHook.
+type Integration struct {
+	ID       string
+	Type     string
+	Name     string
+	Event    string
+	Enabled  bool
+	Username string
+	Channel  string
+	URLs     []string
+	Token    string
+	UserID   string
+	Created  time.Time
+}
+
+// deletedRoom is reported in the remove list of rooms.get and
+// subscriptions.get.
+type deletedRoom struct {
+	room Room
+	at   time.Time
+}
+
+// MethodFunc implements a DDP method. userID is empty before login.
+type MethodFunc func(userID string, params []interface{}) (interface{}, error)
+
+// Server is a fake Rocket.Chat server.
+type Server struct {
+	// URL is the base url of the server, suitable for rc.ServerURL.
+	URL string
+
+	srv *httptest.Server
+
+	mu           sync.Mutex
+	users        map[string]*User
+	rooms        map[string]*Room
+	messages     map[string][]*Message
+	reads        map[string]map[string]time.Time
+	closed       map[string]map[string]bool
+	files        map[string]*File
+	reports      []Report
+	deletedMsgs  []deletedMessage
+	deleted      []deletedRoom
+	integrations map[string]*Integration
+	methods      map[string]MethodFunc
+	held         map[string]chan struct{}
+	sessions     map[*session]struct{}
+}
+
+// NewServer starts a server with a single public "general" channel.
+func NewServer() *Server {
+	s := &Server{
+		users:        make(map[string]*User),
+		rooms:        make(map[string]*Room),
+		messages:     make(map[string][]*Message),
+		reads:        make(map[string]map[string]time.Time),
+		closed:       make(map[string]map[string]bool),
+		files:        make(map[string]*File),
+		integrations: make(map[string]*Integration),
+		methods:      make(map[string]MethodFunc),
+		held:         make(map[string]chan struct{}),
+		sessions:     make(map[*session]struct{}),
+	}
+
+	now := time.Now().UTC()
+	s.rooms[GeneralID] = &Room{
+		ID:        GeneralID,
+		Name:      "general",
+		Type:      Channel,
+		Created:   now,
+		UpdatedAt: now,
+		Roles:     make(map[string][]string),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/websocket", websocket.Server{Handler: s.serveDDP})
+	mux.HandleFunc("/api/", s.serveREST)
+	mux.HandleFunc("/hooks/", s.serveHook)
+	mux.HandleFunc("/file-upload/", s.serveFile)
+
+	s.srv = httptest.NewServer(mux)
+	s.URL = s.srv.URL
+
+	return s
+}
+
+// Close disconnects all websocket clients and shuts down the server.
+func (s *Server) Close() {
+	s.DropConnections()
+	s.srv.Close()
+}
+
+// DropConnections closes every websocket connection, as a server restart
+// or network failure would. Clients may connect again.
+func (s *Server) DropConnections() {
+	s.mu.Lock()
+	sessions := make([]*session, 0, len(s.sessions))
+	for ss := range s.sessions {
+		sessions = append(sessions, ss)
+	}
+	s.mu.Unlock()
+
+	for _, ss := range sessions {
+		ss.close()
+	}
+}
+
+// Connections returns the number of connected websocket clients.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+// AddUser creates a user that can log in with password or with the
+// returned token. New users join the general channel.
+func (s *Server) AddUser(username, password string) User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := &User{
+		ID:       newID(),
+		Username: username,
+		Name:     username,
+		Password: password,
+		Token:    newID() + newID(),
+		Status:   "online",
+		Roles:    []string{"user"},
+		statusAt: time.Now().UTC(),
+	}
+	s.users[u.ID] = u
+
+	general := s.rooms[GeneralID]
+	general.Members = append(general.Members, u.ID)
+
+	return *u
+}
+
+// AddChannel creates a public channel with the given member usernames.
+func (s *Server) AddChannel(name string, members ...string) Room {
+	return s.addRoom(name, Channel, members)
+}
+
+// AddGroup creates a private group with the given member usernames.
+func (s *Server) AddGroup(name string, members ...string) Room {
+	return s.addRoom(name, Group, members)
+}
+
+func (s *Server) addRoom(name, typ string, members []string) Room {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return *s.newRoom(name, typ, members)
+}
+
+// newRoom creates a room owned by the first member. s.mu must be held.
+func (s *Server) newRoom(name, typ string, members []string) *Room {
+	now := time.Now().UTC()
+	r := &Room{
+		ID:        newID(),
+		Name:      name,
+		Type:      typ,
+		Created:   now,
+		UpdatedAt: now,
+		Roles:     make(map[string][]string),
+	}
+	for _, m := range members {
+		if u := s.userByName(m); u != nil && !isMember(r, u.ID) {
+			r.Members = append(r.Members, u.ID)
+			if r.Owner == "" {
+				r.Owner = u.ID
+				r.Roles[u.ID] = []string{"owner"}
+			}
+		}
+	}
+	s.rooms[r.ID] = r
+
+	return r
+}
+
+// Room returns a copy of a room.
+func (s *Server) Room(roomID string) (Room, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.rooms[roomID]
+	if !ok {
+		return Room{}, false
+	}
+	cp := *r
+	cp.Members = append([]string(nil), r.Members...)
+	cp.Roles = make(map[string][]string, len(r.Roles))
+	for id, roles := range r.Roles {
+		cp.Roles[id] = append([]string(nil), roles...)
+	}
+	return cp, true
+}
+
+// DeleteRoom deletes a room and its messages and notifies its members on
+// rooms-changed and subscriptions-changed.
+func (s *Server) DeleteRoom(roomID string) {
+	s.mu.Lock()
+	r, ok := s.rooms[roomID]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.rooms, roomID)
+	delete(s.messages, roomID)
+	s.deleted = append(s.deleted, deletedRoom{room: *r, at: time.Now().UTC()})
+	members := append([]string(nil), r.Members...)
+	s.mu.Unlock()
+
+	for _, id := range members {
+		s.broadcast("stream-notify-user", id+"/rooms-changed", []interface{}{"removed", map[string]interface{}{"_id": roomID}})
+		s.broadcast("stream-notify-user", id+"/subscriptions-changed", []interface{}{"removed", map[string]interface{}{"_id": roomID + id, "rid": roomID}})
+	}
+}
+
+// SetStatus changes the presence status of a user and notifies clients
+// subscribed to user-status on stream-notify-logged.
+func (s *Server) SetStatus(username, status string) {
+	s.mu.Lock()
+	u := s.userByName(username)
+	if u == nil {
+		s.mu.Unlock()
+		return
+	}
+	s.setStatus(u, status, u.StatusText)
+}
+
+// setStatus updates u and notifies clients. s.mu must be held; it is
+// released.
+func (s *Server) setStatus(u *User, status, text string) {
+	u.Status = status
+	u.StatusText = text
+	u.statusAt = time.Now().UTC()
+	args := []interface{}{u.ID, u.Username, statusCode(status), text}
+	s.mu.Unlock()
+
+	s.Emit("stream-notify-logged", "user-status", args)
+}
+
+// PostMessage posts text to a room as username and delivers it to clients
+// subscribed to the room on stream-room-messages.
+func (s *Server) PostMessage(roomID, username, text string) Message {
+	s.mu.Lock()
+	var uid string
+	if u := s.userByName(username); u != nil {
+		uid = u.ID
+	}
+	m := *s.addMessage(roomID, uid, username, text)
+	s.mu.Unlock()
+
+	s.broadcastMessage(m)
+	return m
+}
+
+// Messages returns the messages of a room, oldest first.
+func (s *Server) Messages(roomID string) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	msgs := make([]Message, len(s.messages[roomID]))
+	for i, m := range s.messages[roomID] {
+		msgs[i] = *m
+		if m.Reactions != nil {
+			msgs[i].Reactions = make(map[string][]string, len(m.Reactions))
+			for e, users := range m.Reactions {
+				msgs[i].Reactions[e] = append([]string(nil), users...)
+			}
+		}
+	}
+	return msgs
+}
+
+// LastRead returns when username last marked the messages in a room as
+// read, or the zero time.
+func (s *Server) LastRead(roomID, username string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := s.userByName(username)
+	if u == nil {
+		return time.Time{}
+	}
+	return s.reads[u.ID][roomID]
+}
+
+// Integrations returns the integrations on the server.
+func (s *Server) Integrations() []Integration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make([]Integration, 0, len(s.integrations))
+	for _, i := range s.integrations {
+		list = append(list, *i)
+	}
+	sort.Slice(list, func(a, b int) bool { return list[a].Created.Before(list[b].Created) })
+	return list
+}
+
+// AddWebHook creates an incoming webhook posting to channel as username
+// and returns its url.
+func (s *Server) AddWebHook(channel, username string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := &Integration{
+		ID:       newID(),
+		Type:     "webhook-incoming",
+		Name:     username + " hook",
+		Enabled:  true,
+		Username: username,
+		Channel:  channel,
+		Token:    newID() + newID(),
+		Created:  time.Now().UTC(),
+	}
+	s.integrations[i.ID] = i
+
+	return s.URL + "/hooks/" + i.ID + "/" + i.Token
+}
+
+// HandleMethod registers fn for the DDP method name, replacing any
+// built-in implementation.
+func (s *Server) HandleMethod(name string, fn MethodFunc) {
+	s.mu.Lock()
+	s.methods[name] = fn
+	s.mu.Unlock()
+}
+
+// HoldSubscriptions keeps new subscriptions to event pending, as a slow
+// server would, until release is called. Subscriptions of a connection
+// that is dropped meanwhile never become ready.
+func (s *Server) HoldSubscriptions(event string) (release func()) {
+	ch := make(chan struct{})
+	s.mu.Lock()
+	s.held[event] = ch
+	s.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.held, event)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Emit sends a stream-notify-* event to the clients subscribed to event on
+// stream.
+func (s *Server) Emit(stream, event string, args ...interface{}) {
+	if args == nil {
+		args = []interface{}{}
+	}
+	s.broadcast(stream, event, args)
+}
+
+// addMessage stores a message. s.mu must be held.
+func (s *Server) addMessage(roomID, userID, username, text string) *Message {
+	now := time.Now().UTC()
+	m := &Message{
+		ID:        newID(),
+		RoomID:    roomID,
+		Text:      text,
+		UserID:    userID,
+		Username:  username,
+		Timestamp: now,
+		UpdatedAt: now,
+		mentions:  s.findMentions(text),
+	}
+	s.messages[roomID] = append(s.messages[roomID], m)
+	if r, ok := s.rooms[roomID]; ok {
+		r.UpdatedAt = now
+	}
+	return m
+}
+
+// findMentions returns the users mentioned as @username in text. s.mu
+// must be held.
+func (s *Server) findMentions(text string) []User {
+	var users []User
+	for _, word := range strings.Fields(text) {
+		name := strings.TrimRight(strings.TrimPrefix(word, "@"), ".,:;!?")
+		if !strings.HasPrefix(word, "@") {
+			continue
+		}
+		if u := s.userByName(name); u != nil {
+			users = append(users, User{ID: u.ID, Username: u.Username})
+		}
+	}
+	return users
+}
+
+// Reports returns the messages reported so far.
+func (s *Server) Reports() []Report {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Report(nil), s.reports...)
+}
+
+// findMessage returns the message with id. s.mu must be held.
+func (s *Server) findMessage(id string) *Message {
+	for _, msgs := range s.messages {
+		for _, m := range msgs {
+			if m.ID == id {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// editMessage replaces the text of a message. s.mu must be held.
+func (s *Server) editMessage(id, username, text string) *Message {
+	m := s.findMessage(id)
+	if m == nil {
+		return nil
+	}
+	m.Text = text
+	m.EditedBy = username
+	m.UpdatedAt = time.Now().UTC()
+	return m
+}
+
+// removeMessage deletes a message. s.mu must be held.
+func (s *Server) removeMessage(id string) *Message {
+	for rid, msgs := range s.messages {
+		for i, m := range msgs {
+			if m.ID == id {
+				s.messages[rid] = append(msgs[:i:i], msgs[i+1:]...)
+				s.deletedMsgs = append(s.deletedMsgs, deletedMessage{id: m.ID, roomID: rid, at: time.Now().UTC()})
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// react adds or removes the reaction of username. s.mu must be held.
+func (s *Server) react(id, username, emoji string, add bool) *Message {
+	m := s.findMessage(id)
+	if m == nil {
+		return nil
+	}
+
+	users := m.Reactions[emoji]
+	kept := users[:0:0]
+	for _, u := range users {
+		if u != username {
+			kept = append(kept, u)
+		}
+	}
+	if add {
+		kept = append(kept, username)
+	}
+
+	if m.Reactions == nil {
+		m.Reactions = make(map[string][]string)
+	}
+	if len(kept) == 0 {
+		delete(m.Reactions, emoji)
+	} else {
+		m.Reactions[emoji] = kept
+	}
+	m.UpdatedAt = time.Now().UTC()
+	return m
+}
+
+// markRead records that userID read a room. s.mu must be held.
+func (s *Server) markRead(roomID, userID string) {
+	if s.reads[userID] == nil {
+		s.reads[userID] = make(map[string]time.Time)
+	}
+	s.reads[userID][roomID] = time.Now().UTC()
+}
+
+// The lookups below expect s.mu to be held.
+
+func (s *Server) userByName(username string) *User {
+	for _, u := range s.users {
+		if u.Username == username {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *Server) userByToken(id, token string) *User {
+	u, ok := s.users[id]
+	if !ok || token == "" || u.Token != token {
+		return nil
+	}
+	return u
+}
+
+func (s *Server) resumeUser(token string) *User {
+	for _, u := range s.users {
+		if token != "" && u.Token == token {
+			return u
+		}
+	}
+	return nil
+}
+
+func (s *Server) roomByName(name string) *Room {
+	for _, r := range s.rooms {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// sortedRooms returns the rooms of type typ, or all rooms when typ is
+// empty, in creation order.
+func (s *Server) sortedRooms(typ string) []*Room {
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, r := range s.rooms {
+		if typ == "" || r.Type == typ {
+			rooms = append(rooms, r)
+		}
+	}
+	sort.Slice(rooms, func(a, b int) bool {
+		if rooms[a].Created.Equal(rooms[b].Created) {
+			return rooms[a].ID < rooms[b].ID
+		}
+		return rooms[a].Created.Before(rooms[b].Created)
+	})
+	return rooms
+}
+
+func (s *Server) sortedUsers() []*User {
+	users := make([]*User, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(a, b int) bool { return users[a].Username < users[b].Username })
+	return users
+}
+
+func isMember(r *Room, userID string) bool {
+	for _, m := range r.Members {
+		if m == userID {
+			return true
+		}
+	}
+	return false
+}
+
+func statusCode(status string) int {
+	switch status {
+	case "online":
+		return 1
+	case "away":
+		return 2
+	case "busy":
+		return 3
+	default:
+		return 0
+	}
+}
+
+const idChars = "23456789ABCDEFGHJKLMNPQRSTWXYZabcdefghijkmnopqrstuvwxyz"
+
+// newID returns a random 17 character id like the ones Meteor generates.
+func newID() string {
+	b := make([]byte, 17)
+	if _, err := rand.Read(b); err != nil {
+		panic("rctest: unable to generate id: " + err.Error())
+	}
+	for i := range b {
+		b[i] = idChars[int(b[i])%len(idChars)]
+	}
+	return string(b)
+}
@@ -0,0 +1,77 @@
+package rctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServerREST(t *testing.T) {
+	srv := NewServer()
+	defer srv.Close()
+
+	u := srv.AddUser("bot", "secret")
+	srv.AddChannel("dev", "bot")
+	srv.AddChannel("ops", "bot")
+
+	get := func(path, id, token string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		req.Header.Set("X-User-Id", id)
+		req.Header.Set("X-Auth-Token", token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	if code, _ := get("/api/v1/channels.list", u.ID, "wrong"); code != http.StatusUnauthorized {
+		t.Errorf("bad token: got status %d, want 401", code)
+	}
+
+	code, body := get("/api/v1/channels.list?offset=1&count=1", u.ID, u.Token)
+	if code != http.StatusOK {
+		t.Fatalf("channels.list: got status %d", code)
+	}
+	channels, _ := body["channels"].([]interface{})
+	if len(channels) != 1 || body["total"] != float64(3) || body["offset"] != float64(1) {
+		t.Errorf("channels.list page = %v", body)
+	}
+
+	code, body = get("/api/v1/channels.info?roomName=missing", u.ID, u.Token)
+	if code != http.StatusBadRequest || body["errorType"] != "error-room-not-found" {
+		t.Errorf("channels.info missing room: %d %v", code, body)
+	}
+
+	resp, err := http.Post(srv.URL+"/api/v1/login", "application/json", strings.NewReader(`{"user":"bot","password":"secret"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("login: got status %d", resp.StatusCode)
+	}
+
+	hook := srv.AddWebHook("#dev", "bot")
+	resp, err = http.Post(hook, "application/json", strings.NewReader(`{"text":"deployed","alias":"ci"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	code, body = get("/api/v1/channels.history?roomId="+channelID(srv, "dev"), u.ID, u.Token)
+	msgs, _ := body["messages"].([]interface{})
+	if code != http.StatusOK || len(msgs) != 1 || msgs[0].(map[string]interface{})["alias"] != "ci" {
+		t.Errorf("channels.history after hook: %d %v", code, body)
+	}
+}
+
+func channelID(s *Server, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.roomByName(name).ID
+}
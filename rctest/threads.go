@@ -0,0 +1,227 @@
+package rctest
+
+import (
+	"net/http"
+	"time"
+)
+
+// PostReply posts text as username in the thread started by tmid.
+func (s *Server) PostReply(tmid, username, text string) Message {
+	s.mu.Lock()
+	parent := s.findMessage(tmid)
+	if parent == nil {
+		s.mu.Unlock()
+		return Message{}
+	}
+	var uid string
+	if u := s.userByName(username); u != nil {
+		uid = u.ID
+	}
+	m := s.addMessage(parent.RoomID, uid, username, text)
+	p := *s.reply(m, parent)
+	msg := *m
+	s.mu.Unlock()
+
+	s.broadcastMessage(msg)
+	s.broadcastMessage(p)
+	return msg
+}
+
+// threadParent returns the message starting the thread tmid in a room.
+// Replies to a reply join the thread of their parent. s.mu must be held.
+func (s *Server) threadParent(roomID, tmid string) *Message {
+	m := s.findMessage(tmid)
+	if m != nil && m.ThreadID != "" {
+		m = s.findMessage(m.ThreadID)
+	}
+	if m == nil || m.RoomID != roomID {
+		return nil
+	}
+	return m
+}
+
+// reply makes m a reply in the thread of parent and returns the updated
+// parent. s.mu must be held.
+func (s *Server) reply(m, parent *Message) *Message {
+	m.ThreadID = parent.ID
+	parent.ThreadCount++
+	parent.ThreadLast = m.Timestamp
+	parent.UpdatedAt = m.Timestamp
+	for _, id := range []string{parent.UserID, m.UserID} {
+		if id != "" && !contains(parent.Replies, id) {
+			parent.Replies = append(parent.Replies, id)
+		}
+	}
+	return parent
+}
+
+func (s *Server) chatThreadsList(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.findRoom(c.param("rid"), "")
+	if r == nil || !s.canSee(r, c.user) {
+		return roomNotFound("room")
+	}
+
+	var threads []*Message
+	msgs := s.messages[r.ID]
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].ThreadCount > 0 {
+			threads = append(threads, msgs[i])
+		}
+	}
+	return http.StatusOK, success(s.page(c, "threads", threads))
+}
+
+func (s *Server) chatThreadMessages(c *restCall) (int, interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parent := s.findMessage(c.param("tmid"))
+	if parent == nil {
+		return http.StatusBadRequest, failure("No thread found", "error-invalid-message")
+	}
+	return http.StatusOK, success(s.page(c, "messages", s.threadReplies(parent)))
+}
+
+func (s *Server) chatSyncThreadMessages(c *restCall) (int, interface{}) {
+	since, err := time.Parse(timeFormat, c.param("updatedSince"))
+	if err != nil {
+		return http.StatusBadRequest, failure("The \"updatedSince\" query parameter must be a valid date.", "error-updatedSince-param-invalid")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	parent := s.findMessage(c.param("tmid"))
+	if parent == nil {
+		return http.StatusBadRequest, failure("No thread found", "error-invalid-message")
+	}
+
+	update := make([]interface{}, 0)
+	for _, m := range s.threadReplies(parent) {
+		if m.UpdatedAt.After(since) {
+			update = append(update, messageJSON(m, restTime))
+		}
+	}
+	return http.StatusOK, success(map[string]interface{}{
+		"messages": map[string]interface{}{"update": update, "remove": []interface{}{}},
+	})
+}
+
+// threadReplies returns the replies to parent, newest first. s.mu must be
+// held.
+func (s *Server) threadReplies(parent *Message) []*Message {
+	var replies []*Message
+	msgs := s.messages[parent.RoomID]
+	for i := len(msgs) - 1; i >= 0; i-- {
+		if msgs[i].ThreadID == parent.ID {
+			replies = append(replies, msgs[i])
+		}
+	}
+	return replies
+}
+
+// page renders a page of msgs under key with pagination fields. s.mu must
+// be held.
+func (s *Server) page(c *restCall, key string, msgs []*Message) map[string]interface{} {
+	offset, end := c.page(len(msgs))
+	list := make([]interface{}, 0, end-offset)
+	for _, m := range msgs[offset:end] {
+		list = append(list, messageJSON(m, restTime))
+	}
+	return map[string]interface{}{
+		key:      list,
+		"offset": offset,
+		"count":  len(list),
+		"total":  len(msgs),
+	}
+}
+
+// chatFollow adds or removes the caller from the followers of a thread.
+func chatFollow(follow bool) restHandler {
+	return func(s *Server, c *restCall) (int, interface{}) {
+		s.mu.Lock()
+		m := s.findMessage(c.param("mid"))
+		if m == nil {
+			s.mu.Unlock()
+			return http.StatusBadRequest, failure("Invalid message", "error-invalid-message")
+		}
+		m.Replies = without(m.Replies, c.user.ID)
+		if follow {
+			m.Replies = append(m.Replies, c.user.ID)
+		}
+		m.UpdatedAt = time.Now().UTC()
+		msg := *m
+		s.mu.Unlock()
+
+		s.broadcastMessage(msg)
+		return http.StatusOK, success(nil)
+	}
+}
+
+func (s *Server) roomsCreateDiscussion(c *restCall) (int, interface{}) {
+	name := c.param("t_name")
+	if name == "" {
+		return http.StatusBadRequest, failure("Body parameter \"t_name\" is required.", "error-invalid-params")
+	}
+
+	members := []string{c.user.Username}
+	if list, ok := c.body["users"].([]interface{}); ok {
+		for _, u := range list {
+			if v, ok := u.(string); ok {
+				members = append(members, v)
+			}
+		}
+	}
+
+	s.mu.Lock()
+	parent := s.findRoom(c.param("prid"), "")
+	if parent == nil || !s.canSee(parent, c.user) {
+		s.mu.Unlock()
+		return roomNotFound("room")
+	}
+	var pm *Message
+	if pmid := c.param("pmid"); pmid != "" {
+		if pm = s.findMessage(pmid); pm == nil || pm.RoomID != parent.ID {
+			s.mu.Unlock()
+			return http.StatusBadRequest, failure("Invalid message", "error-invalid-message")
+		}
+	}
+
+	typ := parent.Type
+	if typ == Direct {
+		typ = Group
+	}
+	r := s.newRoom(newID(), typ, members)
+	r.Fname = name
+	r.ParentID = parent.ID
+
+	var changed []Message
+	if pm != nil {
+		pm.DiscussionID = r.ID
+		pm.UpdatedAt = time.Now().UTC()
+		changed = append(changed, *pm)
+	}
+	if text := c.param("reply"); text != "" {
+		changed = append(changed, *s.addMessage(r.ID, c.user.ID, c.user.Username, text))
+	}
+	body := success(map[string]interface{}{"discussion": s.roomJSON(r, restTime)})
+	s.mu.Unlock()
+
+	for _, m := range changed {
+		s.broadcastMessage(m)
+	}
+	s.notifyRoom(r.ID)
+	return http.StatusOK, body
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,188 @@
+package recorder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Cassette is the fixture file format: the REST exchanges and the DDP
+// frames of one recorded session.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+	Frames       []Frame       `json:"frames,omitempty"`
+}
+
+// Interaction is a recorded REST request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request identifies a recorded request. Headers are not recorded so
+// credentials never end up in fixtures.
+type Request struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Query  string          `json:"query,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+	Text   string          `json:"text,omitempty"`
+}
+
+// Response is a recorded response.
+type Response struct {
+	Status  int               `json:"status"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    json.RawMessage   `json:"body,omitempty"`
+	Text    string            `json:"text,omitempty"`
+}
+
+// Frame is a recorded DDP frame. Out is true for frames sent by the client.
+type Frame struct {
+	Out   bool            `json:"out"`
+	Frame json.RawMessage `json:"frame"`
+}
+
+// recordedHeaders are the response headers kept in fixtures.
+var recordedHeaders = []string{
+	"Content-Type",
+	"X-RateLimit-Limit",
+	"X-RateLimit-Remaining",
+	"X-RateLimit-Reset",
+}
+
+func loadCassette(path string) (*Cassette, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cassette{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Cassette) save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0644)
+}
+
+// key identifies requests for matching during replay.
+func (r Request) key() string {
+	return r.Method + " " + r.Path + "?" + r.Query
+}
+
+func newRequest(method string, u *url.URL, body []byte) Request {
+	req := Request{
+		Method: method,
+		Path:   u.Path,
+		Query:  canonicalQuery(u.Query()),
+	}
+	req.Body, req.Text = splitBody(body)
+	return req
+}
+
+func newResponse(status int, h http.Header, body []byte) Response {
+	resp := Response{
+		Status:  status,
+		Headers: map[string]string{},
+	}
+	for _, k := range recordedHeaders {
+		if v := h.Get(k); v != "" {
+			resp.Headers[k] = v
+		}
+	}
+	resp.Body, resp.Text = splitBody(body)
+	return resp
+}
+
+func (r Response) body() []byte {
+	if len(r.Body) > 0 {
+		return r.Body
+	}
+	return []byte(r.Text)
+}
+
+// splitBody keeps json bodies as json so fixtures stay readable.
+func splitBody(b []byte) (json.RawMessage, string) {
+	if len(b) == 0 {
+		return nil, ""
+	}
+	if json.Valid(b) {
+		return redact(b), ""
+	}
+	return nil, string(b)
+}
+
+// redactedKeys are json fields whose values are replaced before a fixture
+// is written.
+var redactedKeys = map[string]bool{
+	"authToken": true,
+	"password":  true,
+	"resume":    true,
+	"token":     true,
+}
+
+// redact replaces credential values in a json document.
+func redact(b []byte) json.RawMessage {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return json.RawMessage(b)
+	}
+
+	out, err := json.Marshal(redactValue(v))
+	if err != nil {
+		return json.RawMessage(b)
+	}
+	return json.RawMessage(out)
+}
+
+func redactValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, val := range t {
+			if _, ok := val.(string); ok && redactedKeys[k] {
+				t[k] = "REDACTED"
+				continue
+			}
+			t[k] = redactValue(val)
+		}
+	case []interface{}:
+		for i, val := range t {
+			t[i] = redactValue(val)
+		}
+	}
+	return v
+}
+
+func canonicalQuery(v url.Values) string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vals := append([]string(nil), v[k]...)
+		sort.Strings(vals)
+		for _, val := range vals {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(val))
+		}
+	}
+	return strings.Join(parts, "&")
+}
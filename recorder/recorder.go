@@ -0,0 +1,229 @@
+// Package recorder captures REST exchanges and DDP frames with a Rocket.Chat
+// server into fixture files and serves them back so tests can run offline.
+//
+// A Recorder is both an http.RoundTripper and an rc.FrameRecorder:
+//
+//	rec, err := recorder.New("fixtures/cassettes/TestBot.json", recorder.ModeFromEnv())
+//	client := rc.New(rc.Transport(rec), rc.RecordFrames(rec), ...)
+//	defer rec.Stop()
+//
+// In ModeRecord requests go to the real server and are saved by Stop. In
+// ModeReplay responses come from the cassette and the websocket is served by
+// an in-process replay server. Tokens and passwords are redacted from
+// recorded bodies and frames.
+package recorder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Recorder records or replays.
+type Mode int
+
+const (
+	ModeReplay Mode = iota
+	ModeRecord
+)
+
+// RecordEnv is the environment variable that switches ModeFromEnv to
+// recording.
+const RecordEnv = "RC_RECORD"
+
+// ModeFromEnv returns ModeRecord when $RC_RECORD is set and ModeReplay
+// otherwise.
+func ModeFromEnv() Mode {
+	if os.Getenv(RecordEnv) != "" {
+		return ModeRecord
+	}
+	return ModeReplay
+}
+
+// Recorder records or replays a cassette.
+type Recorder struct {
+	// Transport is used to reach the server while recording. It defaults to
+	// http.DefaultTransport.
+	Transport http.RoundTripper
+
+	mode Mode
+	path string
+
+	mu       sync.Mutex
+	cassette *Cassette
+	used     []bool
+	ws       *httptest.Server
+}
+
+// New creates a Recorder for the cassette at path. In ModeReplay the
+// cassette must exist.
+func New(path string, mode Mode) (*Recorder, error) {
+	r := &Recorder{
+		mode:     mode,
+		path:     path,
+		cassette: &Cassette{},
+	}
+
+	if mode == ModeReplay {
+		c, err := loadCassette(path)
+		if err != nil {
+			return nil, err
+		}
+		r.cassette = c
+		r.used = make([]bool, len(c.Interactions))
+	}
+
+	return r, nil
+}
+
+// Mode returns the mode of r.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// Stop saves the cassette when recording and shuts down the replay
+// websocket server when replaying.
+func (r *Recorder) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ws != nil {
+		r.ws.Close()
+		r.ws = nil
+	}
+
+	if r.mode == ModeRecord {
+		return r.cassette.save(r.path)
+	}
+	return nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		b, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		body = b
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+	}
+
+	rreq := newRequest(req.Method, req.URL, body)
+
+	if r.mode == ModeReplay {
+		return r.replay(req, rreq)
+	}
+
+	tr := r.Transport
+	if tr == nil {
+		tr = http.DefaultTransport
+	}
+
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	r.mu.Lock()
+	r.cassette.Interactions = append(r.cassette.Interactions, Interaction{
+		Request:  rreq,
+		Response: newResponse(resp.StatusCode, resp.Header, b),
+	})
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// replay returns the first unused interaction matching req.
+func (r *Recorder) replay(req *http.Request, rreq Request) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := rreq.key()
+	for i, in := range r.cassette.Interactions {
+		if r.used[i] || in.Request.key() != key {
+			continue
+		}
+		r.used[i] = true
+
+		h := http.Header{}
+		for k, v := range in.Response.Headers {
+			h.Set(k, v)
+		}
+		if h.Get("Content-Type") == "" && len(in.Response.Body) > 0 {
+			h.Set("Content-Type", "application/json")
+		}
+
+		body := in.Response.body()
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        h,
+			Body:          ioutil.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("recorder: no recorded response for %s in %s", key, r.path)
+}
+
+// RecordFrame implements rc.FrameRecorder. Heartbeats are not recorded.
+func (r *Recorder) RecordFrame(outgoing bool, frame []byte) {
+	if r.mode != ModeRecord || isHeartbeat(frame) {
+		return
+	}
+
+	r.mu.Lock()
+	r.cassette.Frames = append(r.cassette.Frames, Frame{Out: outgoing, Frame: redact(frame)})
+	r.mu.Unlock()
+}
+
+// DialContext opens the websocket connection. When replaying it connects to
+// an in-process server that plays back the recorded frames, whatever addr is.
+func (r *Recorder) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d := &net.Dialer{}
+	if r.mode == ModeRecord {
+		return d.DialContext(ctx, network, addr)
+	}
+
+	r.mu.Lock()
+	if r.ws == nil {
+		r.ws = httptest.NewServer(newReplayHandler(r.cassette.Frames))
+	}
+	target := strings.TrimPrefix(r.ws.URL, "http://")
+	r.mu.Unlock()
+
+	return d.DialContext(ctx, network, target)
+}
+
+func isHeartbeat(frame []byte) bool {
+	msg := struct {
+		Msg string `json:"msg"`
+	}{}
+	if err := json.Unmarshal(frame, &msg); err != nil {
+		return false
+	}
+	return msg.Msg == "ping" || msg.Msg == "pong"
+}
@@ -0,0 +1,83 @@
+package recorder
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-RateLimit-Limit", "10")
+		w.Write([]byte(`{"data":{"authToken":"secret","userId":"abc"},"status":"success"}`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+
+	rec, err := New(path, ModeRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hc := &http.Client{Transport: rec}
+	if _, err := hc.Post(srv.URL+"/api/v1/login", "application/json", strings.NewReader(`{"user":"bot","password":"hunter2"}`)); err != nil {
+		t.Fatal(err)
+	}
+	rec.RecordFrame(true, []byte(`{"msg":"method","id":"1","method":"login","params":[{"resume":"secret"}]}`))
+	rec.RecordFrame(false, []byte(`{"msg":"ping"}`))
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"secret", "hunter2"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("cassette contains %q:\n%s", secret, b)
+		}
+	}
+
+	replay, err := New(path, ModeReplay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(replay.cassette.Frames); n != 1 {
+		t.Errorf("recorded %d frames, want 1 without heartbeats", n)
+	}
+
+	hc = &http.Client{Transport: replay}
+	resp, err := hc.Post("http://rocket.invalid/api/v1/login", "application/json", strings.NewReader(`{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("X-RateLimit-Limit") != "10" {
+		t.Errorf("replayed status %d headers %v", resp.StatusCode, resp.Header)
+	}
+	var got struct {
+		Data struct {
+			UserID string `json:"userId"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &got); err != nil || got.Data.UserID != "abc" {
+		t.Errorf("replayed body = %s", body)
+	}
+
+	if _, err := hc.Post("http://rocket.invalid/api/v1/login", "application/json", strings.NewReader(`{}`)); err == nil {
+		t.Errorf("second replay succeeded, want no recorded response")
+	}
+}
@@ -0,0 +1,148 @@
+package recorder
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"golang.org/x/net/websocket"
+)
+
+// replayHandler serves recorded DDP frames over a websocket. Server frames
+// are played back in order whenever the client sends the frame that
+// preceded them in the recording. Method and subscription ids are mapped
+// from the recording to the live client.
+type replayHandler struct {
+	frames []Frame
+}
+
+func newReplayHandler(frames []Frame) http.Handler {
+	return websocket.Handler((&replayHandler{frames: frames}).serve)
+}
+
+type replaySession struct {
+	ws     *websocket.Conn
+	frames []Frame
+	pos    int
+	ids    map[string]string
+}
+
+func (h *replayHandler) serve(ws *websocket.Conn) {
+	s := &replaySession{
+		ws:     ws,
+		frames: h.frames,
+		ids:    make(map[string]string),
+	}
+	defer ws.Close()
+
+	if err := s.flush(); err != nil {
+		return
+	}
+
+	for {
+		var data []byte
+		if err := websocket.Message.Receive(ws, &data); err != nil {
+			return
+		}
+
+		msg := map[string]interface{}{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		switch msg["msg"] {
+		case "ping":
+			pong := map[string]interface{}{"msg": "pong"}
+			if id, ok := msg["id"]; ok {
+				pong["id"] = id
+			}
+			if err := websocket.JSON.Send(ws, pong); err != nil {
+				return
+			}
+			continue
+		case "pong":
+			continue
+		}
+
+		if !s.advance(msg) {
+			continue
+		}
+		if err := s.flush(); err != nil {
+			return
+		}
+	}
+}
+
+// advance moves past the next recorded client frame matching msg.
+func (s *replaySession) advance(msg map[string]interface{}) bool {
+	for i := s.pos; i < len(s.frames); i++ {
+		f := s.frames[i]
+		if !f.Out {
+			continue
+		}
+
+		rec := map[string]interface{}{}
+		if err := json.Unmarshal(f.Frame, &rec); err != nil || !sameFrame(rec, msg) {
+			continue
+		}
+
+		if rid, ok := rec["id"].(string); ok {
+			if id, ok := msg["id"].(string); ok {
+				s.ids[rid] = id
+			}
+		}
+		s.pos = i + 1
+		return true
+	}
+	return false
+}
+
+// flush sends recorded server frames up to the next client frame.
+func (s *replaySession) flush() error {
+	for s.pos < len(s.frames) && !s.frames[s.pos].Out {
+		msg := map[string]interface{}{}
+		if err := json.Unmarshal(s.frames[s.pos].Frame, &msg); err == nil {
+			s.mapIDs(msg)
+			if err := websocket.JSON.Send(s.ws, msg); err != nil {
+				return err
+			}
+		}
+		s.pos++
+	}
+	return nil
+}
+
+func (s *replaySession) mapIDs(msg map[string]interface{}) {
+	if id, ok := msg["id"].(string); ok {
+		if live, ok := s.ids[id]; ok {
+			msg["id"] = live
+		}
+	}
+
+	for _, key := range []string{"subs", "methods"} {
+		ids, ok := msg[key].([]interface{})
+		if !ok {
+			continue
+		}
+		for i, v := range ids {
+			if id, ok := v.(string); ok {
+				if live, ok := s.ids[id]; ok {
+					ids[i] = live
+				}
+			}
+		}
+	}
+}
+
+func sameFrame(rec, msg map[string]interface{}) bool {
+	if rec["msg"] != msg["msg"] {
+		return false
+	}
+	switch msg["msg"] {
+	case "method":
+		return rec["method"] == msg["method"]
+	case "sub":
+		return rec["name"] == msg["name"] && reflect.DeepEqual(rec["params"], msg["params"])
+	}
+	return true
+}
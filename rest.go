@@ -1,9 +1,16 @@
 package rc
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 
 	"go.uber.org/zap"
 
@@ -24,18 +31,23 @@ type restClient struct {
 	rest   string
 	info   string
 
+	retry   *RetryPolicy
+	limits  rateLimiter
+	writeMu sync.Mutex
+
 	debug bool
 	log   *zap.SugaredLogger
 }
 
-func newRESTClient(server string, debug bool, logger *zap.SugaredLogger) *restClient {
+func newRESTClient(server string, hc *http.Client, debug bool, logger *zap.SugaredLogger, retry *RetryPolicy) *restClient {
 	server = stripTrailingSlash(server)
 
 	return &restClient{
-		Client: resty.New(),
+		Client: resty.NewWithClient(hc),
 		server: server,
 		rest:   server + RESTAPIPath + RESTV1Path,
 		info:   server + RESTAPIPath + RESTInfoPath,
+		retry:  retry,
 		debug:  debug,
 		log:    logger,
 	}
@@ -51,25 +63,36 @@ type Result interface {
 	JSON(v interface{}) error
 	String() string
 	StatusCode() int
+	Header() http.Header
 }
 
 type restReturn struct {
-	code int
-	body []byte
-	err  error
+	endpoint string
+	code     int
+	header   http.Header
+	body     []byte
+	err      error
 }
 
 func (rr *restReturn) Body() []byte {
 	return rr.body
 }
 
+// Error returns the transport error, if any, or an *APIError when the server
+// responded with a non-success status code.
 func (rr *restReturn) Error() error {
-	return rr.err
+	if rr.err != nil {
+		return rr.err
+	}
+	if rr.code < 200 || rr.code > 299 {
+		return newAPIError(rr.endpoint, rr.code, rr.body)
+	}
+	return nil
 }
 
 func (rr *restReturn) JSON(v interface{}) error {
-	if rr.err != nil {
-		return rr.err
+	if err := rr.Error(); err != nil {
+		return err
 	}
 	return json.Unmarshal(rr.body, v)
 }
@@ -82,6 +105,13 @@ func (rr *restReturn) StatusCode() int {
 	return rr.code
 }
 
+func (rr *restReturn) Header() http.Header {
+	return rr.header
+}
+
+// authHeaders are the headers that carry the login.
+var authHeaders = []string{"X-Auth-Token", "X-User-Id"}
+
 func (r *restClient) setAuthHeader(id, token string) {
 	r.SetHeaders(map[string]string{
 		"X-Auth-Token": token,
@@ -89,43 +119,195 @@ func (r *restClient) setAuthHeader(id, token string) {
 	})
 }
 
-func (r *restClient) postForm(path string, vals url.Values) Result {
-	call, err := r.R().
-		SetMultiValueFormData(vals).
-		Post(r.rest + path)
+func (r *restClient) postForm(ctx context.Context, path string, vals url.Values) Result {
+	return r.do(ctx, http.MethodPost, path, func(req *resty.Request) *resty.Request {
+		return req.SetMultiValueFormData(vals)
+	})
+}
 
-	return &restReturn{
-		code: call.StatusCode(),
-		body: call.Body(),
-		err:  err,
+func (r *restClient) postJSON(ctx context.Context, path string, v interface{}) Result {
+	return r.do(ctx, http.MethodPost, path, func(req *resty.Request) *resty.Request {
+		return req.SetBody(v)
+	})
+}
+
+// postStatus posts v as json to an endpoint that replies with the Status
+// envelope and decodes the reply into out, if not nil. A reply with success
+// false is returned as an *APIError even when the status code is 200.
+func (r *restClient) postStatus(ctx context.Context, path string, v, out interface{}) error {
+	res := r.postJSON(ctx, path, v)
+	// Only success is decoded: replies such as chat.update carry a message
+	// object where Status has its string message.
+	st := &struct {
+		Success bool `json:"success"`
+	}{}
+	if err := res.JSON(st); err != nil {
+		return err
+	}
+	if !st.Success {
+		return newAPIError(path, res.StatusCode(), res.Body())
+	}
+	if out == nil {
+		return nil
 	}
+	return json.Unmarshal(res.Body(), out)
 }
 
-func (r *restClient) postJSON(path string, v interface{}) Result {
-	call, err := r.R().
-		SetBody(v).
-		Post(r.rest + path)
+func (r *restClient) get(ctx context.Context, path string, vals url.Values) Result {
+	return r.do(ctx, http.MethodGet, path, func(req *resty.Request) *resty.Request {
+		return req.SetMultiValueQueryParams(vals)
+	})
+}
 
-	return &restReturn{
-		code: call.StatusCode(),
-		body: call.Body(),
-		err:  err,
+// do executes a request against the v1 api, tracking rate limit headers and
+// retrying according to the retry policy.
+func (r *restClient) do(ctx context.Context, method, path string, build func(*resty.Request) *resty.Request) Result {
+	return r.send(ctx, method, path, build, true)
+}
+
+// send executes a request like do. Requests with a body that can only be
+// read once must not be retried.
+func (r *restClient) send(ctx context.Context, method, path string, build func(*resty.Request) *resty.Request, retry bool) Result {
+	if r.retry != nil && r.retry.QueueWrites && method != http.MethodGet {
+		r.writeMu.Lock()
+		defer r.writeMu.Unlock()
+
+		if err := sleepContext(ctx, r.limits.untilReset()); err != nil {
+			return &restReturn{endpoint: path, err: err}
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		call, err := build(r.R().SetContext(ctx)).
+			Execute(method, r.rest+path)
+		if call == nil {
+			// The request was never sent, such as when the body cannot
+			// be encoded.
+			return &restReturn{endpoint: path, err: err}
+		}
+
+		r.limits.update(call.Header())
+
+		if r.debug {
+			r.log.Debugw("rest_"+strings.ToLower(method), "path", path, "status", call.StatusCode(), "body", string(call.Body()))
+		}
+
+		rr := &restReturn{
+			endpoint: path,
+			code:     call.StatusCode(),
+			header:   call.Header(),
+			body:     call.Body(),
+			err:      err,
+		}
+
+		if !retry || r.retry == nil || attempt >= r.retry.MaxRetries || ctx.Err() != nil || !r.retry.shouldRetry(method, rr) {
+			return rr
+		}
+
+		wait := r.retry.backoff(attempt, r.limits.untilReset())
+		r.log.Debugw("rest_retry", "path", path, "status", rr.code, "attempt", attempt+1, "wait", wait)
+		if err := sleepContext(ctx, wait); err != nil {
+			return rr
+		}
 	}
 }
 
-func (r *restClient) get(path string, vals url.Values) Result {
-	call, err := r.R().
-		SetMultiValueQueryParams(vals).
-		Get(r.rest + path)
+// postMultipart posts fields and a file part named "file" as
+// multipart/form-data. The body is encoded while it is sent, so content is
+// never held in memory and the request is never retried.
+func (r *restClient) postMultipart(ctx context.Context, path string, fields url.Values, filename string, content io.Reader) Result {
+	pr, pw := io.Pipe()
+	mw := multipart.NewWriter(pw)
+	go func() {
+		pw.CloseWithError(writeMultipart(mw, fields, filename, content))
+	}()
+	// Unblock the writer if the request ends before reading the whole body.
+	defer pr.Close()
+
+	return r.send(ctx, http.MethodPost, path, func(req *resty.Request) *resty.Request {
+		return req.SetHeader("Content-Type", mw.FormDataContentType()).SetBody(pr)
+	}, false)
+}
+
+func writeMultipart(mw *multipart.Writer, fields url.Values, filename string, content io.Reader) error {
+	for k, vs := range fields {
+		for _, v := range vs {
+			if err := mw.WriteField(k, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	part, err := mw.CreateFormFile("file", filename)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, content); err != nil {
+		return err
+	}
+	return mw.Close()
+}
+
+// download copies the body of a GET of u into w. u may be absolute or
+// relative to the server. The auth headers are only sent to the server.
+func (r *restClient) download(ctx context.Context, u string, w io.Writer) (int64, error) {
+	base, err := url.Parse(r.server + "/")
+	if err != nil {
+		return 0, err
+	}
+	ref, err := url.Parse(u)
+	if err != nil {
+		return 0, err
+	}
+	target := base.ResolveReference(ref)
+
+	req, err := http.NewRequest(http.MethodGet, target.String(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	onServer := func(u *url.URL) bool {
+		return u.Scheme == base.Scheme && u.Host == base.Host
+	}
+	if onServer(target) {
+		for _, k := range authHeaders {
+			if v := r.Header.Get(k); v != "" {
+				req.Header.Set(k, v)
+			}
+		}
+	}
+
+	// Files are often served by a redirect to storage, which the api
+	// client does not follow.
+	hc := *r.GetClient()
+	hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) > DefaultMaxRedirects {
+			return fmt.Errorf("rc: stopped after %d redirects", DefaultMaxRedirects)
+		}
+		if !onServer(req.URL) {
+			for _, k := range authHeaders {
+				req.Header.Del(k)
+			}
+		}
+		return nil
+	}
+
+	resp, err := hc.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
 
 	if r.debug {
-		r.log.Debugw("rest_get", "path", path, "status", call.StatusCode(), "body", string(call.Body()))
+		r.log.Debugw("rest_download", "url", target.String(), "status", resp.StatusCode)
 	}
-	return &restReturn{
-		code: call.StatusCode(),
-		body: call.Body(),
-		err:  err,
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+		return 0, newAPIError(target.Path, resp.StatusCode, body)
 	}
+
+	return io.Copy(w, resp.Body)
 }
 
 type urlQ struct {
@@ -146,13 +328,18 @@ func (q *urlQ) Q() url.Values {
 	return q.vals
 }
 
-func (r *restClient) getInfo() Result {
+func (r *restClient) getInfo(ctx context.Context) Result {
 	call, err := r.R().
+		SetContext(ctx).
 		Get(r.info)
+	if call == nil {
+		return &restReturn{endpoint: RESTInfoPath, err: err}
+	}
 
 	return &restReturn{
-		code: call.StatusCode(),
-		body: call.Body(),
-		err:  err,
+		endpoint: RESTInfoPath,
+		code:     call.StatusCode(),
+		body:     call.Body(),
+		err:      err,
 	}
 }
@@ -1,10 +1,9 @@
 package rc
 
 import (
+	"context"
 	"net/url"
 	"time"
-
-	"github.com/mitchellh/mapstructure"
 )
 
 // Generated by https://quicktype.io
@@ -21,75 +20,133 @@ type RoomWrapper struct {
 }
 
 type ListRoom struct {
-	ID          string      `json:"_id"`
-	Name        string      `json:"name,omitempty"`
-	Type        string      `json:"t"`
-	UpdatedAt   time.Time   `json:"_updatedAt"`
-	LastMessage RoomMessage `json:"lastMessage,omitempty"`
-	Default     bool        `json:"default,omitempty"`
+	ID          string    `json:"_id"`
+	Name        string    `json:"name,omitempty"`
+	Type        string    `json:"t"`
+	UpdatedAt   Timestamp `json:"_updatedAt"`
+	LastMessage Message   `json:"lastMessage,omitempty"`
+	Default     bool      `json:"default,omitempty"`
 }
 
 type Room struct {
 	ListRoom
-	Ts            time.Time     `json:"ts"`
+	Ts            Timestamp     `json:"ts"`
 	Usernames     []interface{} `json:"usernames"`
 	Msgs          int64         `json:"msgs"`
 	UsersCount    int64         `json:"usersCount"`
-	LastMessageTS time.Time     `json:"lm"`
-}
-
-type RoomMessage struct {
-	ID        string        `json:"_id,omitempty"`
-	RoomID    string        `json:"rid,omitempty"`
-	Msg       string        `json:"msg,omitempty"`
-	Timestamp RoomTS        `json:"ts,omitempty"`
-	User      RoomUser      `json:"u,omitempty"`
-	Unread    bool          `json:"unread,omitempty"`
-	UpdatedAt RoomTS        `json:"_updatedAt,omitempty"`
-	URLS      []interface{} `json:"urls,omitempty"`
-	Mentions  []interface{} `json:"mentions,omitempty"`
-	Channels  []interface{} `json:"channels,omitempty"`
+	LastMessageTS Timestamp     `json:"lm"`
 }
 
 type RoomUser struct {
 	ID       string `json:"_id"`
 	Username string `json:"username"`
-	Name     string `json:"name",omitempty`
+	Name     string `json:"name,omitempty"`
 }
 
-type RoomTS struct {
-	Timestamp float64 `json:"$date"`
+func (c *Client) GetRooms() (*RoomList, error) {
+	return c.GetRoomsContext(context.Background())
 }
 
-func (c *Client) GetRooms() (*RoomList, error) {
+func (c *Client) GetRoomsContext(ctx context.Context) (*RoomList, error) {
+	rooms := &RoomList{}
+	if err := c.c.get(ctx, "/rooms.get", nil).JSON(rooms); err != nil {
+		return nil, err
+	}
+
+	return rooms, nil
+}
+
+// GetRoomsSince returns the rooms updated and removed since a time. A zero
+// time returns every room.
+func (c *Client) GetRoomsSince(since time.Time) (*RoomList, error) {
+	return c.GetRoomsSinceContext(context.Background(), since)
+}
+
+func (c *Client) GetRoomsSinceContext(ctx context.Context, since time.Time) (*RoomList, error) {
 	rooms := &RoomList{}
-	if err := c.c.get("/rooms.get", nil).JSON(rooms); err != nil {
+	if err := c.c.get(ctx, "/rooms.get", updatedSince(since)).JSON(rooms); err != nil {
 		return nil, err
 	}
 
 	return rooms, nil
 }
 
+// updatedSince returns the updatedSince parameter of the *.get delta
+// endpoints.
+func updatedSince(since time.Time) url.Values {
+	if since.IsZero() {
+		return nil
+	}
+	return query("updatedSince", since.UTC().Format(TimeFormat)).Q()
+}
+
 func (c *Client) GetRoomsRT() (*RoomList, error) {
+	return c.GetRoomsRTContext(context.Background())
+}
+
+func (c *Client) GetRoomsRTContext(ctx context.Context) (*RoomList, error) {
 	param := map[string]int{"$date": 0}
-	rroom, err := c.d.call("rooms/get", param)
+	rroom, err := c.d.call(ctx, "rooms/get", param)
 	if err != nil {
 		return nil, err
 	}
 
 	rooms := &RoomList{}
-	err = mapstructure.Decode(rroom, rooms)
-	if err != nil {
+	if err := decodeJSON(rroom, rooms); err != nil {
 		return nil, err
 	}
 	return rooms, nil
 }
 
 func (c *Client) GetRoomByName(name string) (*Room, error) {
+	return c.GetRoomByNameContext(context.Background(), name)
+}
+
+func (c *Client) GetRoomByNameContext(ctx context.Context, name string) (*Room, error) {
 	roomW := &RoomWrapper{}
-	if err := c.c.get("/rooms.info", url.Values{"roomName": []string{name}}).JSON(roomW); err != nil {
+	if err := c.c.get(ctx, "/rooms.info", url.Values{"roomName": []string{name}}).JSON(roomW); err != nil {
 		return nil, err
 	}
 	room := roomW.Room
 	return &room, nil
 }
+
+// Room types, as in the "t" field of a room.
+const (
+	RoomTypeChannel = "c"
+	RoomTypeGroup   = "p"
+	RoomTypeDirect  = "d"
+)
+
+// RoomCreateOption is a functional argument that sets optional values when
+// creating a channel or group.
+type RoomCreateOption func(*roomCreate)
+
+type roomCreate struct {
+	Name     string   `json:"name"`
+	Members  []string `json:"members,omitempty"`
+	ReadOnly bool     `json:"readOnly,omitempty"`
+}
+
+// RoomMembers adds users, by username, to a new room. The creator is
+// always a member.
+func RoomMembers(usernames ...string) RoomCreateOption {
+	return func(r *roomCreate) {
+		r.Members = append(r.Members, usernames...)
+	}
+}
+
+// RoomReadOnly creates a room where only owners and moderators can post.
+func RoomReadOnly() RoomCreateOption {
+	return func(r *roomCreate) {
+		r.ReadOnly = true
+	}
+}
+
+func newRoomCreate(name string, opts []RoomCreateOption) *roomCreate {
+	r := &roomCreate{Name: name}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
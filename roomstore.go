@@ -0,0 +1,342 @@
+package rc
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultRoomStoreResync is how often a RoomStore asks the server for
+// changes it may have missed.
+var DefaultRoomStoreResync = time.Minute
+
+// RoomStore is a local copy of the rooms and subscriptions of the user. It
+// starts with a full sync, follows rooms-changed and subscriptions-changed
+// events when Client has StreamOptions and periodically fetches the changes
+// since the last sync with updatedSince. Lookups never touch the network.
+type RoomStore struct {
+	c        *Client
+	interval time.Duration
+
+	mu    sync.RWMutex
+	rooms map[string]ListRoom
+	subs  map[string]Subscription // by room id
+
+	// roomsSince and subsSince are the newest _updatedAt seen, so the
+	// next sync asks for changes by the clock of the server.
+	roomsSince time.Time
+	subsSince  time.Time
+
+	watches []*streamSub
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// RoomStoreOption is a functional argument that sets optional values on
+// RoomStore
+type RoomStoreOption func(*RoomStore)
+
+// RoomStoreResync sets how often the store fetches changes. Zero disables
+// resyncing.
+func RoomStoreResync(d time.Duration) RoomStoreOption {
+	return func(s *RoomStore) {
+		s.interval = d
+	}
+}
+
+// NewRoomStore syncs a store and starts following changes. Close it when
+// done.
+func NewRoomStore(ctx context.Context, c *Client, opts ...RoomStoreOption) (*RoomStore, error) {
+	s := &RoomStore{
+		c:        c,
+		interval: DefaultRoomStoreResync,
+		rooms:    make(map[string]ListRoom),
+		subs:     make(map[string]Subscription),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	// Follow events before the full sync so no change falls between the two.
+	if c.d != nil {
+		for evt, fn := range map[NotificationEvent]func(*StreamEvent){
+			NotifyRoomsChanged: s.applyRoomEvent,
+			NotifySubsChanged:  s.applySubEvent,
+		} {
+			w, err := c.d.streams.watch(ctx, SubNotifyUser, evt, "", fn)
+			if err != nil {
+				s.unwatch()
+				return nil, err
+			}
+			s.watches = append(s.watches, w)
+		}
+	}
+
+	if err := s.Sync(ctx); err != nil {
+		s.unwatch()
+		return nil, err
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// Room returns a room by id.
+func (s *RoomStore) Room(id string) (ListRoom, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.rooms[id]
+	return r, ok
+}
+
+// RoomByName returns a room by name.
+func (s *RoomStore) RoomByName(name string) (ListRoom, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, r := range s.rooms {
+		if r.Name == name {
+			return r, true
+		}
+	}
+	return ListRoom{}, false
+}
+
+// Rooms returns every room, sorted by name.
+func (s *RoomStore) Rooms() []ListRoom {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rooms := make([]ListRoom, 0, len(s.rooms))
+	for _, r := range s.rooms {
+		rooms = append(rooms, r)
+	}
+	sort.Slice(rooms, func(i, j int) bool { return rooms[i].Name < rooms[j].Name })
+	return rooms
+}
+
+// Subscription returns the subscription of the user to a room.
+func (s *RoomStore) Subscription(roomID string) (Subscription, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub, ok := s.subs[roomID]
+	return sub, ok
+}
+
+// Unread returns the number of unread messages in a room.
+func (s *RoomStore) Unread(roomID string) int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.subs[roomID].Unread
+}
+
+// UnreadRooms returns the subscriptions with unread messages, sorted by
+// name.
+func (s *RoomStore) UnreadRooms() []Subscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var subs []Subscription
+	for _, sub := range s.subs {
+		if sub.Unread > 0 {
+			subs = append(subs, sub)
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].Name < subs[j].Name })
+	return subs
+}
+
+// Sync fetches the changes since the last sync, or everything the first
+// time.
+func (s *RoomStore) Sync(ctx context.Context) error {
+	s.mu.RLock()
+	roomsSince, subsSince := s.roomsSince, s.subsSince
+	s.mu.RUnlock()
+
+	rooms, err := s.c.GetRoomsSinceContext(ctx, roomsSince)
+	if err != nil {
+		return err
+	}
+	subs, err := s.c.GetSubscriptionsSinceContext(ctx, subsSince)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range rooms.Update {
+		s.putRoom(r)
+		s.roomsSince = latest(s.roomsSince, r.UpdatedAt.Time)
+	}
+	for _, r := range rooms.Remove {
+		delete(s.rooms, r.ID)
+	}
+	for _, sub := range subs.Update {
+		s.putSub(sub)
+		s.subsSince = latest(s.subsSince, parseTime(sub.UpdatedAt))
+	}
+	for _, sub := range subs.Remove {
+		s.removeSub(sub)
+	}
+
+	return nil
+}
+
+// Close stops following changes.
+func (s *RoomStore) Close() error {
+	var err error
+	s.once.Do(func() {
+		err = s.unwatch()
+		close(s.stop)
+		<-s.done
+	})
+	return err
+}
+
+func (s *RoomStore) unwatch() error {
+	var err error
+	for _, w := range s.watches {
+		if uerr := s.c.d.streams.unwatch(w); uerr != nil && err == nil {
+			err = uerr
+		}
+	}
+	s.watches = nil
+	return err
+}
+
+func (s *RoomStore) run() {
+	defer close(s.done)
+	if s.interval <= 0 {
+		<-s.stop
+		return
+	}
+
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := s.Sync(context.Background()); err != nil {
+				s.c.log.Debugw("room store resync", "error", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// putRoom stores r unless a newer version is stored. s.mu must be held.
+func (s *RoomStore) putRoom(r ListRoom) {
+	if old, ok := s.rooms[r.ID]; ok && old.UpdatedAt.After(r.UpdatedAt.Time) {
+		return
+	}
+	s.rooms[r.ID] = r
+}
+
+// putSub stores sub unless a newer version is stored. s.mu must be held.
+func (s *RoomStore) putSub(sub Subscription) {
+	if old, ok := s.subs[sub.RoomID]; ok && parseTime(old.UpdatedAt).After(parseTime(sub.UpdatedAt)) {
+		return
+	}
+	s.subs[sub.RoomID] = sub
+}
+
+// removeSub deletes sub, which may only carry its id. s.mu must be held.
+func (s *RoomStore) removeSub(sub Subscription) {
+	if sub.RoomID != "" {
+		delete(s.subs, sub.RoomID)
+		return
+	}
+	for rid, old := range s.subs {
+		if old.ID == sub.ID {
+			delete(s.subs, rid)
+		}
+	}
+}
+
+func (s *RoomStore) applyRoomEvent(e *StreamEvent) {
+	v, err := e.Decode()
+	if err != nil {
+		s.c.log.Debugw("decoding rooms-changed", "error", err)
+		return
+	}
+	evt := v.(*RoomsChangedEvent)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if evt.Action == "removed" {
+		delete(s.rooms, evt.Room.ID)
+		return
+	}
+
+	r := ListRoom{
+		ID:        evt.Room.ID,
+		Name:      evt.Room.Name,
+		Type:      evt.Room.Type,
+		UpdatedAt: evt.Room.UpdatedAt,
+	}
+	if old, ok := s.rooms[r.ID]; ok {
+		r.Default = old.Default
+		r.LastMessage = old.LastMessage
+	}
+	if evt.Room.LastMessage != nil {
+		r.LastMessage = *evt.Room.LastMessage
+	}
+	s.putRoom(r)
+}
+
+func (s *RoomStore) applySubEvent(e *StreamEvent) {
+	v, err := e.Decode()
+	if err != nil {
+		s.c.log.Debugw("decoding subscriptions-changed", "error", err)
+		return
+	}
+	evt := v.(*SubscriptionsChangedEvent)
+	cs := evt.Subscription
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub := Subscription{
+		ID:            cs.ID,
+		RoomID:        cs.RoomID,
+		Type:          cs.Type,
+		Name:          cs.Name,
+		User:          User{ID: cs.User.ID, Username: cs.User.Username},
+		Open:          cs.Open,
+		Alert:         cs.Alert,
+		Unread:        cs.Unread,
+		UserMentions:  cs.UserMentions,
+		GroupMentions: cs.GroupMentions,
+		UpdatedAt:     cs.UpdatedAt.Format(TimeFormat),
+	}
+	if evt.Action == "removed" {
+		s.removeSub(sub)
+		return
+	}
+	if old, ok := s.subs[sub.RoomID]; ok {
+		sub.Timestamp = old.Timestamp
+		sub.Fname = old.Fname
+	}
+	s.putSub(sub)
+}
+
+// latest returns the later of a and b.
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(TimeFormat, s)
+	return t
+}
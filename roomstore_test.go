@@ -0,0 +1,145 @@
+package rc
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestRoomStore(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	srv.AddUser("alice", "secret")
+	dev := srv.AddChannel("dev", "bot", "alice")
+
+	realtime := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token), StreamOptions())
+	if err := realtime.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer realtime.Close(context.Background())
+
+	rest := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	if err := rest.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	live, err := NewRoomStore(ctx, realtime, RoomStoreResync(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	polled, err := NewRoomStore(ctx, rest, RoomStoreResync(50*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stores := []*RoomStore{live, polled}
+
+	eventually := func(what string, cond func(*RoomStore) bool) {
+		t.Helper()
+		for _, s := range stores {
+			deadline := time.Now().Add(5 * time.Second)
+			for !cond(s) {
+				if time.Now().After(deadline) {
+					t.Fatalf("timed out waiting for %s", what)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+	}
+
+	for _, s := range stores {
+		if r, ok := s.RoomByName("dev"); !ok || r.ID != dev.ID {
+			t.Errorf("RoomByName(dev) = %+v, %v", r, ok)
+		}
+		if _, ok := s.Room(rctest.GeneralID); !ok {
+			t.Error("general missing")
+		}
+		if n := len(s.Rooms()); n != 2 {
+			t.Errorf("got %d rooms, want 2", n)
+		}
+		if n := s.Unread(dev.ID); n != 0 {
+			t.Errorf("initial unread = %d", n)
+		}
+	}
+
+	srv.PostMessage(dev.ID, "alice", "one")
+	srv.PostMessage(dev.ID, "alice", "two")
+	eventually("unread", func(s *RoomStore) bool { return s.Unread(dev.ID) == 2 })
+	for _, s := range stores {
+		if unread := s.UnreadRooms(); len(unread) != 1 || unread[0].RoomID != dev.ID {
+			t.Errorf("UnreadRooms = %+v", unread)
+		}
+	}
+
+	if err := rest.ReadMessages(dev.ID); err != nil {
+		t.Fatal(err)
+	}
+	eventually("read", func(s *RoomStore) bool { return s.Unread(dev.ID) == 0 })
+
+	srv.DeleteRoom(dev.ID)
+	eventually("removal", func(s *RoomStore) bool {
+		_, ok := s.Room(dev.ID)
+		_, subbed := s.Subscription(dev.ID)
+		return !ok && !subbed
+	})
+
+	for _, s := range stores {
+		if err := s.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRoomStoreServerClock(t *testing.T) {
+	// The server clock is far behind the client.
+	var mu sync.Mutex
+	since := map[string][]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		since[r.URL.Path] = append(since[r.URL.Path], r.URL.Query().Get("updatedSince"))
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/api/v1/rooms.get":
+			io.WriteString(w, `{"update":[
+				{"_id":"a","name":"a","t":"c","_updatedAt":"2001-01-01T00:00:02.000Z"},
+				{"_id":"b","name":"b","t":"c","_updatedAt":"2001-01-01T00:00:01.000Z"}
+			],"remove":[],"success":true}`)
+		case "/api/v1/subscriptions.get":
+			io.WriteString(w, `{"update":[
+				{"_id":"s","rid":"a","name":"a","t":"c","_updatedAt":"2001-01-01T00:00:03.000Z"}
+			],"remove":[],"success":true}`)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := NewRoomStore(context.Background(), New(ServerURL(srv.URL)), RoomStoreResync(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string][]string{
+		"/api/v1/rooms.get":         {"", "2001-01-01T00:00:02Z"},
+		"/api/v1/subscriptions.get": {"", "2001-01-01T00:00:03Z"},
+	}
+	for path, w := range want {
+		if got := strings.Join(since[path], " "); got != strings.Join(w, " ") {
+			t.Errorf("%s updatedSince = %q, want %q", path, got, w)
+		}
+	}
+}
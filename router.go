@@ -0,0 +1,285 @@
+package rc
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+)
+
+// DefaultRouterWorkers is the number of goroutines a Router runs handlers
+// on unless RouterWorkers is given.
+var DefaultRouterWorkers = 1
+
+// Router dispatches MessageStream, EventStream and StreamErrors to
+// registered handlers. Handlers run on a pool of workers; with a single
+// worker they run one at a time in the order the items arrived.
+type Router struct {
+	c       *Client
+	workers int
+	onPanic func(interface{})
+
+	mu      sync.RWMutex
+	msgs    []msgRoute
+	evts    []evtRoute
+	onError []func(error)
+}
+
+type msgRoute struct {
+	match func(Message) bool
+	fn    func(Message)
+}
+
+type evtRoute struct {
+	match func(*StreamEvent) bool
+	fn    func(*StreamEvent)
+}
+
+// RouterOption is a functional argument that sets optional values on Router
+type RouterOption func(*Router)
+
+// RouterWorkers sets the number of goroutines handlers run on.
+func RouterWorkers(n int) RouterOption {
+	return func(r *Router) {
+		if n > 0 {
+			r.workers = n
+		}
+	}
+}
+
+// OnHandlerPanic sets a function called with the recovered value when a
+// handler panics. By default the panic is logged.
+func OnHandlerPanic(fn func(v interface{})) RouterOption {
+	return func(r *Router) {
+		r.onPanic = fn
+	}
+}
+
+// NewRouter creates a Router for the realtime streams of c. Register the
+// handlers, then call Run.
+func NewRouter(c *Client, opts ...RouterOption) *Router {
+	r := &Router{
+		c:       c,
+		workers: DefaultRouterWorkers,
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.onPanic == nil {
+		r.onPanic = func(v interface{}) {
+			c.log.Errorw("handler panic", "panic", v, "stack", string(debug.Stack()))
+		}
+	}
+
+	return r
+}
+
+// OnMessage calls fn for every message posted to roomID, or to any room if
+// roomID is empty.
+func (r *Router) OnMessage(roomID string, fn func(Message)) {
+	r.OnMessageFunc(func(m Message) bool {
+		return roomID == "" || m.RoomID == roomID
+	}, fn)
+}
+
+// OnThread calls fn for every reply in the thread started by the message
+// tmid.
+func (r *Router) OnThread(tmid string, fn func(Message)) {
+	r.OnMessageFunc(func(m Message) bool {
+		return m.ThreadID == tmid
+	}, fn)
+}
+
+// OnMessageFunc calls fn for every message match returns true for.
+func (r *Router) OnMessageFunc(match func(Message) bool, fn func(Message)) {
+	r.mu.Lock()
+	r.msgs = append(r.msgs, msgRoute{match: match, fn: fn})
+	r.mu.Unlock()
+}
+
+// OnEvent calls fn for every event of the given kind.
+func (r *Router) OnEvent(kind NotificationEvent, fn func(*StreamEvent)) {
+	r.OnEventFunc(func(e *StreamEvent) bool {
+		k, ok := e.Kind()
+		return ok && k == kind
+	}, fn)
+}
+
+// OnEventFunc calls fn for every event match returns true for.
+func (r *Router) OnEventFunc(match func(*StreamEvent) bool, fn func(*StreamEvent)) {
+	r.mu.Lock()
+	r.evts = append(r.evts, evtRoute{match: match, fn: fn})
+	r.mu.Unlock()
+}
+
+// OnUserStatus calls fn for every NotifyUserStatus event.
+func (r *Router) OnUserStatus(fn func(*UserStatusEvent)) {
+	r.OnEvent(NotifyUserStatus, func(e *StreamEvent) {
+		if v, ok := r.decode(e); ok {
+			fn(v.(*UserStatusEvent))
+		}
+	})
+}
+
+// OnTyping calls fn for every NotifyTyping event in roomID, or in any room
+// if roomID is empty.
+func (r *Router) OnTyping(roomID string, fn func(*TypingEvent)) {
+	r.OnEvent(NotifyTyping, func(e *StreamEvent) {
+		v, ok := r.decode(e)
+		if !ok {
+			return
+		}
+		evt := v.(*TypingEvent)
+		if roomID == "" || evt.RoomID == roomID {
+			fn(evt)
+		}
+	})
+}
+
+// OnError calls fn for every error on StreamErrors and for events typed
+// handlers fail to decode. Without an error handler errors are logged.
+func (r *Router) OnError(fn func(error)) {
+	r.mu.Lock()
+	r.onError = append(r.onError, fn)
+	r.mu.Unlock()
+}
+
+// decode decodes e and reports a failure to the error handlers.
+func (r *Router) decode(e *StreamEvent) (interface{}, bool) {
+	v, err := e.Decode()
+	if err != nil {
+		r.error(err)
+		return nil, false
+	}
+	return v, true
+}
+
+func (r *Router) error(err error) {
+	r.mu.RLock()
+	handlers := r.onError
+	r.mu.RUnlock()
+
+	if len(handlers) == 0 {
+		r.c.log.Errorw("stream error", "error", err)
+		return
+	}
+	for _, fn := range handlers {
+		fn(err)
+	}
+}
+
+// Run dispatches the streams until ctx is done or Client is closed, then
+// waits for running handlers to return. It returns ctx.Err() if ctx ended
+// the run.
+func (r *Router) Run(ctx context.Context) error {
+	if r.c.d == nil {
+		return ErrNoRealtime
+	}
+
+	jobs := make(chan func())
+	var wg sync.WaitGroup
+	wg.Add(r.workers)
+	for i := 0; i < r.workers; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				r.run(job)
+			}
+		}()
+	}
+	defer func() {
+		close(jobs)
+		wg.Wait()
+	}()
+
+	msgs := r.c.MessageStream()
+	evts := r.c.EventStream()
+	errs := r.c.StreamErrors()
+
+	dispatch := func(job func()) bool {
+		select {
+		case jobs <- job:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	for msgs != nil || evts != nil || errs != nil {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case batch, ok := <-msgs:
+			if !ok {
+				msgs = nil
+				continue
+			}
+			for _, m := range batch {
+				for _, fn := range r.messageHandlers(m) {
+					m, fn := m, fn
+					if !dispatch(func() { fn(m) }) {
+						return ctx.Err()
+					}
+				}
+			}
+		case e, ok := <-evts:
+			if !ok {
+				evts = nil
+				continue
+			}
+			for _, fn := range r.eventHandlers(e) {
+				fn := fn
+				if !dispatch(func() { fn(e) }) {
+					return ctx.Err()
+				}
+			}
+		case err, ok := <-errs:
+			if !ok {
+				errs = nil
+				continue
+			}
+			if !dispatch(func() { r.error(err) }) {
+				return ctx.Err()
+			}
+		}
+	}
+
+	return nil
+}
+
+// run calls job and recovers a panic.
+func (r *Router) run(job func()) {
+	defer func() {
+		if v := recover(); v != nil {
+			r.onPanic(v)
+		}
+	}()
+	job()
+}
+
+func (r *Router) messageHandlers(m Message) []func(Message) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var fns []func(Message)
+	for _, rt := range r.msgs {
+		if rt.match(m) {
+			fns = append(fns, rt.fn)
+		}
+	}
+	return fns
+}
+
+func (r *Router) eventHandlers(e *StreamEvent) []func(*StreamEvent) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var fns []func(*StreamEvent)
+	for _, rt := range r.evts {
+		if rt.match(e) {
+			fns = append(fns, rt.fn)
+		}
+	}
+	return fns
+}
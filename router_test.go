@@ -0,0 +1,97 @@
+package rc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestRouter(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	srv.AddUser("alice", "secret")
+	dev := srv.AddChannel("dev", "alice", "bot")
+
+	client := New(
+		ServerURL(srv.URL),
+		Credentials(bot.Username, bot.Password),
+		StreamOptions(
+			RoomSubscription(rctest.GeneralID),
+			RoomSubscription(dev.ID),
+			EventSubscription(SubNotifyLogged, NotifyUserStatus),
+		),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	panics := make(chan interface{}, 1)
+	general := make(chan string, 10)
+	statuses := make(chan string, 10)
+
+	r := NewRouter(client, RouterWorkers(2), OnHandlerPanic(func(v interface{}) {
+		panics <- v
+	}))
+	r.OnMessage(rctest.GeneralID, func(m Message) {
+		general <- m.Text
+	})
+	r.OnMessage(dev.ID, func(m Message) {
+		panic(m.Text)
+	})
+	r.OnUserStatus(func(e *UserStatusEvent) {
+		statuses <- e.Username + ":" + e.Status
+	})
+	r.OnError(func(err error) {
+		t.Error(err)
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- r.Run(context.Background())
+	}()
+
+	srv.PostMessage(dev.ID, "alice", "boom")
+	srv.PostMessage(rctest.GeneralID, "alice", "hello")
+	srv.SetStatus("alice", "away")
+
+	select {
+	case v := <-panics:
+		if v != "boom" {
+			t.Errorf("recovered %v, want boom", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for panic")
+	}
+	select {
+	case msg := <-general:
+		if msg != "hello" {
+			t.Errorf("got message %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+	select {
+	case s := <-statuses:
+		if s != "alice:away" {
+			t.Errorf("got status %q", s)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for status")
+	}
+
+	if err := client.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after Close")
+	}
+}
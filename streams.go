@@ -1,13 +1,16 @@
 package rc
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/blushft/rc/internal/ddp"
 	"github.com/google/uuid"
-	"github.com/gopackage/ddp"
-	"github.com/mitchellh/mapstructure"
 )
 
 var (
@@ -17,9 +20,20 @@ var (
 
 type StreamSubscription struct {
 	name   string
+	scope  eventScope
 	events map[NotificationEvent]string
 }
 
+// eventScope is the id a stream expects in front of its event names, as in
+// "<rid>/typing" or "<uid>/notification".
+type eventScope int
+
+const (
+	scopeNone eventScope = iota
+	scopeRoom
+	scopeUser
+)
+
 type NotificationEvent int
 
 const (
@@ -74,14 +88,16 @@ var (
 			NotifyUserStatus:   "user-status",
 		}}
 	SubNotifyRoom = StreamSubscription{
-		name: "stream-notify-room",
+		name:  "stream-notify-room",
+		scope: scopeRoom,
 		events: map[NotificationEvent]string{
 			NotifyDeleteMessage: "deleteMessage",
 			NotifyTyping:        "typing",
 		}}
 
 	SubNotifyUser = StreamSubscription{
-		name: "stream-notify-user",
+		name:  "stream-notify-user",
+		scope: scopeUser,
 		events: map[NotificationEvent]string{
 			NotifyMessage:      "message",
 			NotifyOTR:          "otr",
@@ -91,44 +107,47 @@ var (
 			NotifySubsChanged:  "subscriptions-changed",
 		}}
 	SubNotifyRoomUsers = StreamSubscription{
-		name: "stream-notify-room-users",
+		name:  "stream-notify-room-users",
+		scope: scopeRoom,
 		events: map[NotificationEvent]string{
 			NotifyWebRTC: "webrtc",
 		}}
 )
 
-func getStreamSub(name string) *StreamSubscription {
-	switch name {
-	case "stream-notify-room-users":
-		return &SubNotifyRoomUsers
-	case "stream-notify-user":
-		return &SubNotifyUser
-	case "stram-notify-room":
-		return &SubNotifyRoom
-	case "stream-notify-logged":
-		return &SubNotifyLogged
-	case "stream-notify-all":
-		return &SubNotifyAll
-	default:
-		return nil
+// roomEventSub returns the room-scoped stream that carries evt.
+func roomEventSub(evt NotificationEvent) StreamSubscription {
+	if _, ok := SubNotifyRoom.events[evt]; ok {
+		return SubNotifyRoom
 	}
+	return SubNotifyRoomUsers
 }
 
 type StreamOption func(*streams)
 
+// EventSubscription subscribes to evt on sub. Events of SubNotifyUser are
+// those of the logged in user; room-scoped events need
+// RoomEventSubscription.
 func EventSubscription(sub StreamSubscription, evt NotificationEvent) StreamOption {
 	return func(str *streams) {
-		var ne []NotificationEvent
-		if v, ok := str.subEvts[sub.name]; ok {
-			ne = v
-		} else {
-			ne = make([]NotificationEvent, 0)
-		}
-		ne = append(ne, evt)
-		str.subEvts[sub.name] = ne
+		str.subEvts = append(str.subEvts, eventSpec{sub: sub, evt: evt})
+	}
+}
+
+// RoomEventSubscription subscribes to evt in a room, such as NotifyTyping
+// or NotifyDeleteMessage.
+func RoomEventSubscription(roomID string, evt NotificationEvent) StreamOption {
+	return func(str *streams) {
+		str.subEvts = append(str.subEvts, eventSpec{sub: roomEventSub(evt), evt: evt, room: roomID})
 	}
 }
 
+// eventSpec is an event subscription requested with a StreamOption.
+type eventSpec struct {
+	sub  StreamSubscription
+	evt  NotificationEvent
+	room string
+}
+
 func RoomSubscription(roomID string) StreamOption {
 	return func(str *streams) {
 		str.subRooms = append(str.subRooms, roomID)
@@ -136,23 +155,167 @@ func RoomSubscription(roomID string) StreamOption {
 }
 
 type streams struct {
-	subEvts  map[string][]NotificationEvent
-	subRooms []string
+	// disconnects counts lost connections. Room subscriptions compare it
+	// with the count they saw last to find gaps without taking mu. It is
+	// first to keep it 64-bit aligned for atomic access.
+	disconnects uint64
 
-	msgs []*SubChannel
-	evts []*SubChannel
+	subEvts  []eventSpec
+	subRooms []string
 
-	allMsgs chan []RoomMessage
+	mu     sync.Mutex
+	c      *ddp.Client
+	userID string
+	rooms  map[string]*streamSub
+	evts   map[string]*streamSub
+	// watchers are subscriptions of internal consumers, see watch.
+	watchers map[*streamSub]struct{}
+
+	// senders counts goroutines delivering to the shared channels so
+	// close can wait for them before closing the channels.
+	sendMu  sync.Mutex
+	closed  bool
+	senders sync.WaitGroup
+	quit    chan struct{}
+
+	msgBP  backpressure
+	evtBP  backpressure
+	onDrop func(stream string, total uint64)
+
+	allMsgs chan []Message
 	allEvts chan *StreamEvent
 	allErrs chan error
 }
 
+// streamSub is a stream subscription and the goroutine forwarding its
+// updates to the shared channels.
+type streamSub struct {
+	coll     string
+	args     []interface{}
+	listener ddp.UpdateListener
+	ch       *SubChannel
+	stop     chan struct{}
+	stopped  sync.Once
+	done     chan struct{}
+
+	// id is empty while the subscription is pending, that is until the
+	// server answered it. It is set under streams.mu. ready is closed once
+	// the server answered, with err set if the subscription failed.
+	id    string
+	ready chan struct{}
+	err   error
+
+	// room subscriptions remember what was delivered so messages missed
+	// while disconnected can be fetched without duplicates.
+	room        string
+	mu          sync.Mutex
+	last        time.Time
+	gap         time.Time
+	disconnects uint64
+	recent      []string
+}
+
+// recentMessages is how many delivered message versions a room
+// subscription remembers to drop duplicates after a gap fill.
+const recentMessages = 100
+
+// accept returns the messages in msgs that were not delivered yet and
+// records them as delivered. disconnects is the current count of lost
+// connections.
+func (s *streamSub) accept(msgs []Message, disconnects uint64) []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.checkGap(disconnects)
+	out := msgs[:0:0]
+	for _, m := range msgs {
+		// Edits and reactions resend the message with a new _updatedAt.
+		key := fmt.Sprintf("%s/%d", m.ID, m.UpdatedAt.UnixNano())
+		if s.seen(key) {
+			continue
+		}
+		s.recent = append(s.recent, key)
+		if len(s.recent) > recentMessages {
+			s.recent = s.recent[1:]
+		}
+		if m.Timestamp.After(s.last) {
+			s.last = m.Timestamp.Time
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func (s *streamSub) seen(key string) bool {
+	for _, r := range s.recent {
+		if r == key {
+			return true
+		}
+	}
+	return false
+}
+
+// checkGap starts a gap at the last delivered message if the connection
+// was lost since the previous check. s.mu must be held.
+func (s *streamSub) checkGap(disconnects uint64) {
+	if s.disconnects == disconnects {
+		return
+	}
+	s.disconnects = disconnects
+	if s.gap.IsZero() {
+		s.gap = s.last
+	}
+}
+
+// gapStart returns the timestamp of the last message delivered before the
+// connection was lost, or zero if there is no gap to fill.
+func (s *streamSub) gapStart(disconnects uint64) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkGap(disconnects)
+	g := s.gap
+	s.gap = time.Time{}
+	return g
+}
+
+// wait waits for a pending subscription to be answered.
+func (s *streamSub) wait(ctx context.Context) error {
+	select {
+	case <-s.ready:
+		return s.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// stopForwarding removes the listener and stops the forwarding goroutine.
+// It may be called more than once.
+func (s *streamSub) stopForwarding(c *ddp.Client) {
+	s.stopped.Do(func() {
+		c.CollectionByName(s.coll).RemoveUpdateListener(s.listener)
+		close(s.stop)
+		<-s.done
+	})
+}
+
+// close stops forwarding and unsubscribes from the server. A pending
+// subscription is unsubscribed by its subscriber once it is answered. s
+// must have been removed from the streams.
+func (s *streamSub) close(c *ddp.Client) error {
+	s.stopForwarding(c)
+	if s.id == "" {
+		return nil
+	}
+	return c.Unsubscribe(s.id)
+}
+
 func newStreams(opts ...StreamOption) (*streams, error) {
 	str := &streams{
-		subEvts:  make(map[string][]NotificationEvent),
 		subRooms: make([]string, 0),
-		msgs:     make([]*SubChannel, 0),
-		evts:     make([]*SubChannel, 0),
+		rooms:    make(map[string]*streamSub),
+		evts:     make(map[string]*streamSub),
+		watchers: make(map[*streamSub]struct{}),
+		quit:     make(chan struct{}),
 	}
 
 	for _, o := range opts {
@@ -164,200 +327,505 @@ func newStreams(opts ...StreamOption) (*streams, error) {
 		msgBuf = minMsgBuffer
 	}
 
-	evtBuf := 0
-	for _, ev := range str.subEvts {
-		evtBuf += len(ev) * DefaultEventBuffer
-	}
+	evtBuf := len(str.subEvts) * DefaultEventBuffer
 	if evtBuf == 0 {
 		evtBuf = minEvtBuffer
 	}
 
-	str.allMsgs = make(chan []RoomMessage, msgBuf)
+	if str.msgBP.size > 0 {
+		msgBuf = str.msgBP.size
+	}
+	if str.evtBP.size > 0 {
+		evtBuf = str.evtBP.size
+	}
+
+	str.allMsgs = make(chan []Message, msgBuf)
 	str.allEvts = make(chan *StreamEvent, evtBuf)
 	str.allErrs = make(chan error, 10)
 
 	return str, nil
 }
 
-func (str *streams) iterMsg(c *SubChannel) {
+func (str *streams) iterMsg(s *streamSub) {
+	defer close(s.done)
 	for {
 		select {
-		case mm := <-c.Updates:
-			m, ok := mm.([]RoomMessage)
+		case <-s.stop:
+			return
+		case mm := <-s.ch.Updates:
+			m, ok := mm.([]Message)
 			if !ok {
 				continue
 			}
-			str.allMsgs <- m
-		case err := <-c.Errors:
-			str.allErrs <- err
+			str.forwardMsgs(s, m)
+		case err := <-s.ch.Errors:
+			str.forwardErr(s, err)
 		}
 	}
 }
 
-func (str *streams) iterEvt(c *SubChannel) {
+func (str *streams) iterEvt(s *streamSub) {
+	defer close(s.done)
 	for {
 		select {
-		case mm := <-c.Updates:
+		case <-s.stop:
+			return
+		case mm := <-s.ch.Updates:
 			m, ok := mm.(*StreamEvent)
 			if !ok {
 				continue
 			}
-			str.allEvts <- m
-		case err := <-c.Errors:
-			str.allErrs <- err
+			str.forwardEvt(s, m)
+		case err := <-s.ch.Errors:
+			str.forwardErr(s, err)
 		}
 	}
 }
 
-func (str *streams) runStreams(c *ddp.Client) error {
+// forwardMsgs delivers the messages of s that were not delivered yet.
+func (str *streams) forwardMsgs(s *streamSub, msgs []Message) {
+	if !str.enter() {
+		return
+	}
+	defer str.senders.Done()
+
+	msgs = s.accept(msgs, atomic.LoadUint64(&str.disconnects))
+	if len(msgs) == 0 {
+		return
+	}
+	str.pushMsgs(s, msgs)
+}
+
+// enter registers a sender, reporting false once the streams are closed.
+func (str *streams) enter() bool {
+	str.sendMu.Lock()
+	defer str.sendMu.Unlock()
+	if str.closed {
+		return false
+	}
+	str.senders.Add(1)
+	return true
+}
+
+func (str *streams) isClosed() bool {
+	str.sendMu.Lock()
+	defer str.sendMu.Unlock()
+	return str.closed
+}
+
+// close stops every subscription and closes the shared channels. Failed
+// unsub frames are ignored: the server drops the subscriptions with the
+// connection, which is closed next.
+func (str *streams) close() {
+	str.sendMu.Lock()
+	if str.closed {
+		str.sendMu.Unlock()
+		return
+	}
+	str.closed = true
+	str.sendMu.Unlock()
+
+	str.mu.Lock()
+	subs := make([]*streamSub, 0, len(str.rooms)+len(str.evts))
+	for _, s := range str.rooms {
+		subs = append(subs, s)
+	}
+	for _, s := range str.evts {
+		subs = append(subs, s)
+	}
+	for s := range str.watchers {
+		subs = append(subs, s)
+	}
+	str.rooms = make(map[string]*streamSub)
+	str.evts = make(map[string]*streamSub)
+	str.watchers = make(map[*streamSub]struct{})
+	str.mu.Unlock()
+
+	for _, s := range subs {
+		s.close(str.c)
+	}
+
+	close(str.quit)
+	str.senders.Wait()
+	close(str.allMsgs)
+	close(str.allEvts)
+	close(str.allErrs)
+}
+
+// markGaps records a lost connection. Every room subscription starts a
+// gap at its last delivered message the next time it delivers or fillGaps
+// asks for the gap. It takes no locks, so it is safe to call from the ddp
+// read goroutine.
+func (str *streams) markGaps() {
+	atomic.AddUint64(&str.disconnects, 1)
+}
+
+func (str *streams) roomSubs() []*streamSub {
+	str.mu.Lock()
+	defer str.mu.Unlock()
+
+	subs := make([]*streamSub, 0, len(str.rooms))
+	for _, s := range str.rooms {
+		subs = append(subs, s)
+	}
+	return subs
+}
+
+func (str *streams) forwardEvt(s *streamSub, evt *StreamEvent) {
+	if !str.enter() {
+		return
+	}
+	defer str.senders.Done()
+
+	str.pushEvt(s, evt)
+}
+
+func (str *streams) forwardErr(s *streamSub, err error) {
+	if !str.enter() {
+		return
+	}
+	defer str.senders.Done()
+
+	select {
+	case str.allErrs <- err:
+	case <-s.stop:
+	}
+}
+
+func (str *streams) runStreams(ctx context.Context) error {
 	for _, v := range str.subRooms {
-		ns, err := subscribeToRoomMessages(v, c)
-		if err != nil {
+		if err := str.subscribeRoom(ctx, v); err != nil {
 			return err
 		}
-		str.msgs = append(str.msgs, ns)
 	}
 
-	for _, msgsub := range str.msgs {
-		go str.iterMsg(msgsub)
+	for _, e := range str.subEvts {
+		if err := str.subscribeEvent(ctx, e.sub, e.evt, e.room); err != nil {
+			return err
+		}
 	}
 
-	for k, vv := range str.subEvts {
-		ss := getStreamSub(k)
-		if ss == nil {
-			continue
+	return nil
+}
+
+func (str *streams) subscribeRoom(ctx context.Context, roomID string) error {
+	str.mu.Lock()
+	if str.isClosed() {
+		str.mu.Unlock()
+		return ErrClosed
+	}
+	if s, ok := str.rooms[roomID]; ok {
+		str.mu.Unlock()
+		return s.wait(ctx)
+	}
+	s := newRoomSub(roomID)
+	s.disconnects = atomic.LoadUint64(&str.disconnects)
+	str.rooms[roomID] = s
+	str.mu.Unlock()
+
+	id, err := str.start(ctx, s, str.iterMsg)
+
+	str.mu.Lock()
+	kept := str.rooms[roomID] == s
+	if kept {
+		if err == nil {
+			s.id = id
+		} else {
+			delete(str.rooms, roomID)
 		}
-		for _, v := range vv {
-			ns, err := subscribeToEvent(*ss, v, c)
-			if err != nil {
-				return err
-			}
-			str.evts = append(str.evts, ns)
+	}
+	str.mu.Unlock()
+
+	return str.finish(s, id, err, kept)
+}
+
+// start registers the listener of s, starts run to forward its updates
+// and sends the subscription. The listener comes first so no update sent
+// right after "ready" is lost. start does not take str.mu: the map entry
+// of s is a placeholder while the server is awaited, so other subscribes
+// and a lost connection are never held up by a slow server.
+func (str *streams) start(ctx context.Context, s *streamSub, run func(*streamSub)) (string, error) {
+	str.c.CollectionByName(s.coll).AddUpdateListener(s.listener)
+	go run(s)
+
+	id, err := sub(ctx, str.c, s.coll, s.args...)
+	if err != nil {
+		s.stopForwarding(str.c)
+		return "", err
+	}
+	return id, nil
+}
+
+// finish completes a subscription sent by start. kept reports whether s
+// was still registered when the answer came; if it was removed while
+// pending it is undone now. Callers waiting on s get err.
+func (str *streams) finish(s *streamSub, id string, err error, kept bool) error {
+	if err == nil && !kept {
+		s.stopForwarding(str.c)
+		str.c.Unsubscribe(id)
+		if str.isClosed() {
+			err = ErrClosed
 		}
 	}
+	s.err = err
+	close(s.ready)
+	return err
+}
+
+func (str *streams) unsubscribeRoom(roomID string) error {
+	str.mu.Lock()
+	s, ok := str.rooms[roomID]
+	delete(str.rooms, roomID)
+	str.mu.Unlock()
 
-	for _, evtsub := range str.evts {
-		go str.iterEvt(evtsub)
+	if !ok {
+		return nil
 	}
+	return s.close(str.c)
+}
 
-	return nil
+// setUser records the logged in user for user-scoped events.
+func (str *streams) setUser(id string) {
+	str.mu.Lock()
+	str.userID = id
+	str.mu.Unlock()
 }
 
-type StreamEvent struct {
-	Event string
-	Args  []interface{}
+// eventName returns the name evt is published under on sub, prefixed with
+// the room or user id for scoped streams. str.mu must be held.
+func (str *streams) eventName(sub StreamSubscription, evt NotificationEvent, roomID string) (string, error) {
+	name, ok := sub.events[evt]
+	if !ok {
+		return "", fmt.Errorf("%s does not have event %d", sub.name, evt)
+	}
+
+	switch sub.scope {
+	case scopeRoom:
+		if roomID == "" {
+			return "", fmt.Errorf("%s events need a room id", sub.name)
+		}
+		return roomID + "/" + name, nil
+	case scopeUser:
+		if str.userID == "" {
+			return "", fmt.Errorf("%s events need a logged in user", sub.name)
+		}
+		return str.userID + "/" + name, nil
+	default:
+		return name, nil
+	}
 }
 
-func subscribeToEvent(subName StreamSubscription, evt NotificationEvent, c *ddp.Client) (*SubChannel, error) {
-	subn := subName.name
-	sube, ok := subName.events[evt]
+func (str *streams) subscribeEvent(ctx context.Context, sub StreamSubscription, evt NotificationEvent, roomID string) error {
+	str.mu.Lock()
+	if str.isClosed() {
+		str.mu.Unlock()
+		return ErrClosed
+	}
+
+	name, err := str.eventName(sub, evt, roomID)
+	if err != nil {
+		str.mu.Unlock()
+		return err
+	}
+
+	key := eventKey(sub, name)
+	if s, ok := str.evts[key]; ok {
+		str.mu.Unlock()
+		return s.wait(ctx)
+	}
+	s := newEventSub(sub.name, name)
+	str.evts[key] = s
+	str.mu.Unlock()
+
+	id, err := str.start(ctx, s, str.iterEvt)
+
+	str.mu.Lock()
+	kept := str.evts[key] == s
+	if kept {
+		if err == nil {
+			s.id = id
+		} else {
+			delete(str.evts, key)
+		}
+	}
+	str.mu.Unlock()
+
+	return str.finish(s, id, err, kept)
+}
+
+func (str *streams) unsubscribeEvent(sub StreamSubscription, evt NotificationEvent, roomID string) error {
+	str.mu.Lock()
+	name, err := str.eventName(sub, evt, roomID)
+	if err != nil {
+		str.mu.Unlock()
+		return err
+	}
+
+	key := eventKey(sub, name)
+	s, ok := str.evts[key]
+	delete(str.evts, key)
+	str.mu.Unlock()
+
 	if !ok {
-		return nil, fmt.Errorf("%s does not have event %d", subn, evt)
+		return nil
 	}
-	err := c.Sub(subn, sube, true)
+	return s.close(str.c)
+}
+
+// watch subscribes to evt for an internal consumer such as
+// PresenceTracker. Events are passed to fn, from a single goroutine, instead
+// of EventStream; errors go to StreamErrors.
+func (str *streams) watch(ctx context.Context, sub StreamSubscription, evt NotificationEvent, roomID string, fn func(*StreamEvent)) (*streamSub, error) {
+	str.mu.Lock()
+	if str.isClosed() {
+		str.mu.Unlock()
+		return nil, ErrClosed
+	}
+
+	name, err := str.eventName(sub, evt, roomID)
 	if err != nil {
+		str.mu.Unlock()
+		return nil, err
+	}
+
+	s := newEventSub(sub.name, name)
+	str.watchers[s] = struct{}{}
+	str.mu.Unlock()
+
+	id, err := str.start(ctx, s, func(s *streamSub) {
+		defer close(s.done)
+		for {
+			select {
+			case <-s.stop:
+				return
+			case u := <-s.ch.Updates:
+				if e, ok := u.(*StreamEvent); ok {
+					fn(e)
+				}
+			case err := <-s.ch.Errors:
+				str.forwardErr(s, err)
+			}
+		}
+	})
+
+	str.mu.Lock()
+	_, kept := str.watchers[s]
+	if kept {
+		if err == nil {
+			s.id = id
+		} else {
+			delete(str.watchers, s)
+		}
+	}
+	str.mu.Unlock()
+
+	if err := str.finish(s, id, err, kept); err != nil {
 		return nil, err
 	}
+	return s, nil
+}
+
+// unwatch stops a subscription made with watch.
+func (str *streams) unwatch(s *streamSub) error {
+	str.mu.Lock()
+	_, ok := str.watchers[s]
+	delete(str.watchers, s)
+	str.mu.Unlock()
+
+	if !ok {
+		return nil
+	}
+	return s.close(str.c)
+}
+
+func eventKey(sub StreamSubscription, name string) string {
+	return sub.name + "/" + name
+}
+
+// StreamEvent is an event received on a stream-notify-* subscription. Use
+// Decode to get the typed payload.
+type StreamEvent struct {
+	Stream string
+	Event  string
+	Args   []interface{}
+}
 
+// newEventSub returns a subscription to the event sube of the stream subn.
+func newEventSub(subn, sube string) *streamSub {
 	fn := func(u ddp.Update) (interface{}, error) {
 		e, ok := u["eventName"].(string)
 		if !ok {
 			return nil, errors.New("invalid response")
 		}
+		if e != sube {
+			return nil, nil
+		}
 		args, ok := u["args"].([]interface{})
 		if !ok {
 			return nil, errors.New("invalid response")
 		}
 		res := &StreamEvent{
-			Event: e,
-			Args:  args,
+			Stream: subn,
+			Event:  e,
+			Args:   args,
 		}
 		return res, nil
 	}
 
-	list, sub := NewUpdateListener(fn)
-
-	c.CollectionByName(subn).
-		AddUpdateListener(list)
-
-	return sub, nil
+	return newStreamSub(subn, fn, sube, true)
 }
 
-func subscribeToRoomMessages(roomID string, c *ddp.Client) (*SubChannel, error) {
-	err := c.Sub("stream-room-messages", roomID, true)
-	if err != nil {
-		return nil, err
-	}
-
+// newRoomSub returns a subscription to the messages of a room.
+func newRoomSub(roomID string) *streamSub {
 	fn := func(u ddp.Update) (interface{}, error) {
-		rawmsgs := []RoomMessage{}
+		if e, ok := u["eventName"].(string); ok && e != roomID {
+			return nil, nil
+		}
 		m, ok := u["args"]
 		if !ok {
 			return nil, fmt.Errorf("unexpected args: %v", u)
 		}
-		decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
-			WeaklyTypedInput: true,
-			TagName:          "json",
-			Result:           &rawmsgs,
-		})
-		if err != nil {
-			return nil, err
-		}
-		err = decoder.Decode(m)
-		if err != nil {
-			return nil, err
-		}
-		msgs := []RoomMessage{}
-		for _, mm := range rawmsgs {
-			if mm.ID != "" {
-				msgs = append(msgs, mm)
-			}
-		}
-		return msgs, nil
+		return decodeRoomMessages(m)
 	}
 
-	list, sub := NewUpdateListener(fn)
-
-	c.CollectionByName("stream-room-messages").
-		AddUpdateListener(list)
-
-	return sub, nil
+	s := newStreamSub("stream-room-messages", fn, roomID, true)
+	s.room = roomID
+	s.last = time.Now().UTC()
+	return s
 }
 
-func newId() string {
-	sid := uuid.New().String()
-	return strings.Replace(sid, "-", "", -1)
-}
-
-func mapUserStatus(args []interface{}) (map[string]string, error) {
-	for _, x := range args {
-		status := map[string]string{}
-		switch v := x.(type) {
-		case []interface{}:
-			if len(v) > 0 {
-				status["id"] = v[0].(string)
-				status["user"] = v[1].(string)
-				status["status"] = userStatus(v[2].(int))
-				status["message"] = v[3].(string)
-				return status, nil
-			}
-			return nil, errors.New("not a status message")
+// decodeRoomMessages decodes the messages in a stream update or method
+// result.
+func decodeRoomMessages(v interface{}) ([]Message, error) {
+	rawmsgs := []Message{}
+	if err := decodeJSON(v, &rawmsgs); err != nil {
+		return nil, err
+	}
+	msgs := []Message{}
+	for _, mm := range rawmsgs {
+		if mm.ID != "" {
+			msgs = append(msgs, mm)
 		}
 	}
-	return nil, errors.New("not a status message")
+	return msgs, nil
 }
 
-func userStatus(i int) string {
-	switch i {
-	case 0:
-		return "offline"
-	case 1:
-		return "online"
-	case 2:
-		return "away"
-	case 3:
-		return "busy"
-	default:
-		return "unknown"
+// newStreamSub returns a pending subscription to coll with args.
+func newStreamSub(coll string, fn func(ddp.Update) (interface{}, error), args ...interface{}) *streamSub {
+	stop := make(chan struct{})
+	list, ch := newUpdateListener(fn, stop)
+	return &streamSub{
+		coll:     coll,
+		args:     args,
+		listener: list,
+		ch:       ch,
+		stop:     stop,
+		done:     make(chan struct{}),
+		ready:    make(chan struct{}),
 	}
 }
+
+func newId() string {
+	sid := uuid.New().String()
+	return strings.Replace(sid, "-", "", -1)
+}
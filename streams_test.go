@@ -0,0 +1,180 @@
+package rc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestMessageStream(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	srv.AddUser("alice", "secret")
+
+	client := New(
+		ServerURL(srv.URL),
+		Credentials(bot.Username, bot.Password),
+		StreamOptions(RoomSubscription(rctest.GeneralID)),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	sent := srv.PostMessage(rctest.GeneralID, "alice", "hello bot")
+
+	select {
+	case msgs := <-client.MessageStream():
+		if len(msgs) != 1 {
+			t.Fatalf("got %d messages, want 1", len(msgs))
+		}
+		m := msgs[0]
+		if m.ID != sent.ID || m.RoomID != rctest.GeneralID || m.Text != "hello bot" || m.User.Username != "alice" {
+			t.Errorf("got message %+v", m)
+		}
+	case err := <-client.StreamErrors():
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	if _, err := client.SendMessage(Message{RoomID: rctest.GeneralID, Text: "hi alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if msgs := srv.Messages(rctest.GeneralID); len(msgs) != 2 || msgs[1].Username != "bot" {
+		t.Errorf("server messages = %+v", msgs)
+	}
+}
+
+func TestSubscribeRoom(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	srv.AddUser("alice", "secret")
+	dev := srv.AddChannel("dev", "alice", "bot")
+
+	client := New(
+		ServerURL(srv.URL),
+		AccessToken(bot.ID, bot.Token),
+		StreamOptions(),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	if err := client.SubscribeRoom(dev.ID); err != nil {
+		t.Fatal(err)
+	}
+	srv.PostMessage(rctest.GeneralID, "alice", "not followed")
+	srv.PostMessage(dev.ID, "alice", "followed")
+
+	select {
+	case msgs := <-client.MessageStream():
+		if len(msgs) != 1 || msgs[0].Text != "followed" {
+			t.Errorf("got %+v, want the message in dev", msgs)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for message")
+	}
+
+	if err := client.UnsubscribeRoom(dev.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.SubscribeEvent(SubNotifyLogged, NotifyUserStatus); err != nil {
+		t.Fatal(err)
+	}
+	srv.PostMessage(dev.ID, "alice", "after unsubscribe")
+	srv.SetStatus("alice", "away")
+
+	select {
+	case evt := <-client.EventStream():
+		if evt.Event != "user-status" {
+			t.Errorf("got event %q", evt.Event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+
+	select {
+	case msgs := <-client.MessageStream():
+		t.Errorf("got %+v after unsubscribing", msgs)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRoomEventSubscription(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	srv.AddUser("alice", "secret")
+	dev := srv.AddChannel("dev", "alice", "bot")
+
+	client := New(
+		ServerURL(srv.URL),
+		AccessToken(bot.ID, bot.Token),
+		StreamOptions(
+			RoomEventSubscription(rctest.GeneralID, NotifyTyping),
+			EventSubscription(SubNotifyUser, NotifyNotification),
+		),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	if err := client.SubscribeEvent(SubNotifyRoom, NotifyTyping); err == nil {
+		t.Error("SubscribeEvent without a room: want error")
+	}
+	if err := client.SubscribeRoomEvent(dev.ID, NotifyDeleteMessage); err != nil {
+		t.Fatal(err)
+	}
+
+	waitEvent := func(want string) *StreamEvent {
+		t.Helper()
+		select {
+		case evt := <-client.EventStream():
+			if evt.Event != want {
+				t.Fatalf("got event %q, want %q", evt.Event, want)
+			}
+			return evt
+		case err := <-client.StreamErrors():
+			t.Fatal(err)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+		return nil
+	}
+
+	srv.Emit("stream-notify-room", dev.ID+"/typing", "alice", true)
+	srv.Emit("stream-notify-room", rctest.GeneralID+"/typing", "alice", true)
+	v, err := waitEvent(rctest.GeneralID + "/typing").Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typing := v.(*TypingEvent); typing.RoomID != rctest.GeneralID || typing.Username != "alice" || !typing.Typing {
+		t.Errorf("got %+v", typing)
+	}
+
+	srv.Emit("stream-notify-room", dev.ID+"/deleteMessage", map[string]interface{}{"_id": "m1"})
+	waitEvent(dev.ID + "/deleteMessage")
+
+	srv.Emit("stream-notify-user", bot.ID+"/notification", map[string]interface{}{"title": "hi"})
+	waitEvent(bot.ID + "/notification")
+
+	if err := client.UnsubscribeRoomEvent(dev.ID, NotifyDeleteMessage); err != nil {
+		t.Fatal(err)
+	}
+	srv.Emit("stream-notify-room", dev.ID+"/deleteMessage", map[string]interface{}{"_id": "m2"})
+	select {
+	case evt := <-client.EventStream():
+		t.Errorf("got %q after unsubscribing", evt.Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -1,5 +1,10 @@
 package rc
 
+import (
+	"context"
+	"time"
+)
+
 // Generated by https://quicktype.io
 
 type Subscriptions struct {
@@ -25,11 +30,30 @@ type Subscription struct {
 }
 
 func (c *Client) GetSubscriptions() ([]Subscription, error) {
+	return c.GetSubscriptionsContext(context.Background())
+}
+
+func (c *Client) GetSubscriptionsContext(ctx context.Context) ([]Subscription, error) {
 	subs := &Subscriptions{}
-	if err := c.c.get("/subscriptions.get", nil).JSON(&subs); err != nil {
+	if err := c.c.get(ctx, "/subscriptions.get", nil).JSON(&subs); err != nil {
 		return nil, err
 	}
 
 	updates := subs.Update
 	return updates, nil
 }
+
+// GetSubscriptionsSince returns the subscriptions updated and removed since
+// a time. A zero time returns every subscription.
+func (c *Client) GetSubscriptionsSince(since time.Time) (*Subscriptions, error) {
+	return c.GetSubscriptionsSinceContext(context.Background(), since)
+}
+
+func (c *Client) GetSubscriptionsSinceContext(ctx context.Context, since time.Time) (*Subscriptions, error) {
+	subs := &Subscriptions{}
+	if err := c.c.get(ctx, "/subscriptions.get", updatedSince(since)).JSON(subs); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
@@ -0,0 +1,172 @@
+package rc
+
+import (
+	"context"
+	"time"
+)
+
+type ThreadList struct {
+	Threads []Message `json:"threads"`
+	Pagination
+	Success bool `json:"success"`
+}
+
+// ThreadSync holds the replies in a thread updated and removed since a
+// time.
+type ThreadSync struct {
+	Update []Message        `json:"update"`
+	Remove []DeletedMessage `json:"remove"`
+}
+
+// Discussion is a room started from a parent room, and optionally from a
+// message in it. Fname holds the name given at creation.
+type Discussion struct {
+	ID        string      `json:"_id"`
+	ParentID  string      `json:"prid"`
+	Name      string      `json:"name"`
+	Fname     string      `json:"fname"`
+	Type      string      `json:"t"`
+	Usernames []string    `json:"usernames"`
+	Msgs      int64       `json:"msgs"`
+	User      ChannelUser `json:"u"`
+	Timestamp string      `json:"ts"`
+	UpdatedAt string      `json:"_updatedAt"`
+}
+
+// DiscussionOption is a functional argument that sets optional values on a
+// new discussion.
+type DiscussionOption func(*discussionCreate)
+
+type discussionCreate struct {
+	ParentID        string   `json:"prid"`
+	ParentMessageID string   `json:"pmid,omitempty"`
+	Name            string   `json:"t_name"`
+	Users           []string `json:"users,omitempty"`
+	Reply           string   `json:"reply,omitempty"`
+}
+
+// DiscussionMessage starts the discussion from a message of the parent
+// room.
+func DiscussionMessage(msgID string) DiscussionOption {
+	return func(d *discussionCreate) {
+		d.ParentMessageID = msgID
+	}
+}
+
+// DiscussionUsers adds users, by username, to the discussion.
+func DiscussionUsers(usernames ...string) DiscussionOption {
+	return func(d *discussionCreate) {
+		d.Users = append(d.Users, usernames...)
+	}
+}
+
+// DiscussionReply posts text as the first message of the discussion.
+func DiscussionReply(text string) DiscussionOption {
+	return func(d *discussionCreate) {
+		d.Reply = text
+	}
+}
+
+// GetThreads returns the messages of a room that started a thread, newest
+// first. q may be nil.
+func (c *Client) GetThreads(roomID string, q *Query) (*ThreadList, error) {
+	return c.GetThreadsContext(context.Background(), roomID, q)
+}
+
+func (c *Client) GetThreadsContext(ctx context.Context, roomID string, q *Query) (*ThreadList, error) {
+	if q == nil {
+		q = NewQuery()
+	}
+	vals := q.URLValues()
+	vals.Set("rid", roomID)
+
+	threads := &ThreadList{}
+	if err := c.c.get(ctx, "/chat.getThreadsList", vals).JSON(threads); err != nil {
+		return nil, err
+	}
+
+	return threads, nil
+}
+
+// GetThreadMessages returns the replies in a thread, newest first. q may be
+// nil.
+func (c *Client) GetThreadMessages(tmid string, q *Query) (*MessageList, error) {
+	return c.GetThreadMessagesContext(context.Background(), tmid, q)
+}
+
+func (c *Client) GetThreadMessagesContext(ctx context.Context, tmid string, q *Query) (*MessageList, error) {
+	if q == nil {
+		q = NewQuery()
+	}
+	vals := q.URLValues()
+	vals.Set("tmid", tmid)
+
+	list := &MessageList{}
+	if err := c.c.get(ctx, "/chat.getThreadMessages", vals).JSON(list); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// SyncThreadMessages returns the replies in a thread updated and removed
+// since a time.
+func (c *Client) SyncThreadMessages(tmid string, since time.Time) (*ThreadSync, error) {
+	return c.SyncThreadMessagesContext(context.Background(), tmid, since)
+}
+
+func (c *Client) SyncThreadMessagesContext(ctx context.Context, tmid string, since time.Time) (*ThreadSync, error) {
+	env := &struct {
+		Messages ThreadSync `json:"messages"`
+		Success  bool       `json:"success"`
+	}{}
+	q := query("tmid", tmid).V("updatedSince", since.UTC().Format(TimeFormat))
+	if err := c.c.get(ctx, "/chat.syncThreadMessages", q.Q()).JSON(env); err != nil {
+		return nil, err
+	}
+
+	sync := env.Messages
+	return &sync, nil
+}
+
+// FollowMessage subscribes the logged in user to the replies in a thread.
+func (c *Client) FollowMessage(msgID string) error {
+	return c.FollowMessageContext(context.Background(), msgID)
+}
+
+func (c *Client) FollowMessageContext(ctx context.Context, msgID string) error {
+	req := map[string]string{"mid": msgID}
+	return c.c.postStatus(ctx, "/chat.followMessage", req, nil)
+}
+
+func (c *Client) UnfollowMessage(msgID string) error {
+	return c.UnfollowMessageContext(context.Background(), msgID)
+}
+
+func (c *Client) UnfollowMessageContext(ctx context.Context, msgID string) error {
+	req := map[string]string{"mid": msgID}
+	return c.c.postStatus(ctx, "/chat.unfollowMessage", req, nil)
+}
+
+// CreateDiscussion starts a discussion named name in the room parentID.
+func (c *Client) CreateDiscussion(parentID, name string, opts ...DiscussionOption) (*Discussion, error) {
+	return c.CreateDiscussionContext(context.Background(), parentID, name, opts...)
+}
+
+func (c *Client) CreateDiscussionContext(ctx context.Context, parentID, name string, opts ...DiscussionOption) (*Discussion, error) {
+	req := &discussionCreate{ParentID: parentID, Name: name}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	env := &struct {
+		Discussion Discussion `json:"discussion"`
+		Success    bool       `json:"success"`
+	}{}
+	if err := c.c.postStatus(ctx, "/rooms.createDiscussion", req, env); err != nil {
+		return nil, err
+	}
+
+	d := env.Discussion
+	return &d, nil
+}
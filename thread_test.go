@@ -0,0 +1,118 @@
+package rc
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/blushft/rc/rctest"
+)
+
+func TestThreads(t *testing.T) {
+	srv := rctest.NewServer()
+	defer srv.Close()
+
+	bot := srv.AddUser("bot", "secret")
+	srv.AddUser("alice", "secret")
+
+	client := New(
+		ServerURL(srv.URL),
+		AccessToken(bot.ID, bot.Token),
+		StreamOptions(RoomSubscription(rctest.GeneralID)),
+	)
+	if err := client.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close(context.Background())
+
+	rest := New(ServerURL(srv.URL), AccessToken(bot.ID, bot.Token))
+	if err := rest.Connect(); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now().Add(-time.Second)
+	parent := srv.PostMessage(rctest.GeneralID, "alice", "printer on fire")
+
+	replies := make(chan Message, 10)
+	r := NewRouter(client)
+	r.OnThread(parent.ID, func(m Message) {
+		replies <- m
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Run(ctx)
+
+	srv.PostReply(parent.ID, "alice", "still burning")
+	if _, err := client.SendMessage(Message{RoomID: rctest.GeneralID, ThreadID: parent.ID, Text: "on my way"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rest.SendMessage(Message{RoomID: rctest.GeneralID, ThreadID: parent.ID, Text: "extinguisher?"}); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		select {
+		case m := <-replies:
+			if m.ThreadID != parent.ID {
+				t.Errorf("routed %+v", m)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for thread reply")
+		}
+	}
+
+	threads, err := rest.GetThreads(rctest.GeneralID, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads.Threads) != 1 {
+		t.Fatalf("threads = %+v", threads.Threads)
+	}
+	if th := threads.Threads[0]; th.ID != parent.ID || th.ThreadCount != 3 || len(th.Replies) != 2 || th.ThreadLastMessage.IsZero() {
+		t.Errorf("thread = %+v", th)
+	}
+
+	msgs, err := rest.GetThreadMessages(parent.ID, NewQuery().Count(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs.Messages) != 2 || msgs.Total != 3 || msgs.Messages[0].Text != "extinguisher?" {
+		t.Errorf("thread messages = %+v", msgs)
+	}
+	sync, err := rest.SyncThreadMessages(parent.ID, start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sync.Update) != 3 {
+		t.Errorf("sync = %+v", sync)
+	}
+
+	if err := rest.UnfollowMessage(parent.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := rest.FollowMessage(parent.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := rest.CreateDiscussion(rctest.GeneralID, "fire drill",
+		DiscussionMessage(parent.ID),
+		DiscussionUsers("alice"),
+		DiscussionReply("let's talk"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.ParentID != rctest.GeneralID || d.Fname != "fire drill" || len(d.Usernames) != 2 {
+		t.Errorf("discussion = %+v", d)
+	}
+	got, err := rest.GetMessage(parent.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.DiscussionID != d.ID {
+		t.Errorf("parent drid = %q, want %q", got.DiscussionID, d.ID)
+	}
+	if m := srv.Messages(d.ID); len(m) != 1 || m[0].Text != "let's talk" {
+		t.Errorf("discussion messages = %+v", m)
+	}
+}
@@ -0,0 +1,98 @@
+package rc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Timestamp is a time sent by the server. It decodes every shape the api
+// uses: ISO 8601 strings from the REST api, {"$date": ms} EJSON objects
+// from the realtime api and plain numbers of milliseconds since the epoch.
+// Missing and null times decode to the zero time.
+type Timestamp struct {
+	time.Time
+}
+
+// NewTimestamp returns t as a Timestamp in UTC.
+func NewTimestamp(t time.Time) Timestamp {
+	return Timestamp{t.UTC()}
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (t *Timestamp) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || bytes.Equal(b, []byte("null")) {
+		t.Time = time.Time{}
+		return nil
+	}
+
+	switch b[0] {
+	case '"':
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		if s == "" {
+			t.Time = time.Time{}
+			return nil
+		}
+		v, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return fmt.Errorf("rc: invalid timestamp %q: %v", s, err)
+		}
+		t.Time = v.UTC()
+		return nil
+	case '{':
+		var d struct {
+			Date json.RawMessage `json:"$date"`
+		}
+		if err := json.Unmarshal(b, &d); err != nil {
+			return err
+		}
+		if len(d.Date) == 0 {
+			return fmt.Errorf("rc: invalid timestamp %s", b)
+		}
+		return t.UnmarshalJSON(d.Date)
+	}
+
+	var ms float64
+	if err := json.Unmarshal(b, &ms); err != nil {
+		return fmt.Errorf("rc: invalid timestamp %s", b)
+	}
+	t.Time = msTime(ms)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. The zero time is encoded as null
+// and others in the format of the REST api.
+func (t Timestamp) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.UTC().Format(TimeFormat))
+}
+
+// msTime converts milliseconds since the epoch to UTC.
+func msTime(ms float64) time.Time {
+	whole := math.Trunc(ms)
+	ns := int64(whole)*int64(time.Millisecond) + int64(math.Round((ms-whole)*float64(time.Millisecond)))
+	return time.Unix(0, ns).UTC()
+}
+
+// millis returns t in milliseconds since the epoch, as used by {$date}.
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// decodeJSON decodes a value already decoded from json, such as a realtime
+// method result, into out the way the REST api results are decoded.
+func decodeJSON(v, out interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, out)
+}
@@ -0,0 +1,143 @@
+package rc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	want := time.Date(2019, 6, 11, 21, 40, 27, 125000000, time.UTC)
+
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{`"2019-06-11T21:40:27.125Z"`, want},
+		{`"2019-06-11T23:40:27.125+02:00"`, want},
+		{`{"$date": 1560289227125}`, want},
+		{`{"$date": "2019-06-11T21:40:27.125Z"}`, want},
+		{`1560289227125`, want},
+		{`null`, time.Time{}},
+		{`""`, time.Time{}},
+	}
+	for _, tt := range tests {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(tt.in), &ts); err != nil {
+			t.Errorf("%s: %v", tt.in, err)
+			continue
+		}
+		if !ts.Equal(tt.want) {
+			t.Errorf("%s = %v, want %v", tt.in, ts.Time, tt.want)
+		}
+	}
+
+	for _, in := range []string{`"yesterday"`, `{"date": 1}`, `true`} {
+		var ts Timestamp
+		if err := json.Unmarshal([]byte(in), &ts); err == nil {
+			t.Errorf("%s decoded to %v", in, ts.Time)
+		}
+	}
+
+	b, err := json.Marshal(struct {
+		Set   Timestamp `json:"set"`
+		Unset Timestamp `json:"unset"`
+	}{Set: NewTimestamp(want)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"set":"2019-06-11T21:40:27.125Z","unset":null}` {
+		t.Errorf("marshaled %s", b)
+	}
+}
+
+func TestMessageShapes(t *testing.T) {
+	// The REST api sends ISO strings where the realtime api sends EJSON.
+	rest := `{
+		"_id": "m1", "rid": "GENERAL", "msg": "see https://example.com @bob",
+		"ts": "2019-06-11T21:40:27.125Z", "_updatedAt": "2019-06-11T21:41:00.000Z",
+		"u": {"_id": "u1", "username": "alice", "name": "Alice"},
+		"mentions": [{"_id": "u2", "username": "bob"}],
+		"urls": [{"url": "https://example.com", "meta": {"ogTitle": "Example"}, "headers": {"contentType": "text/html"}}],
+		"attachments": [{"title": "log", "ts": "2019-06-11T21:40:00.000Z"}],
+		"reactions": {":+1:": {"usernames": ["bob"]}},
+		"editedAt": "2019-06-11T21:41:00.000Z", "editedBy": {"_id": "u1", "username": "alice"},
+		"tmid": "p1", "tlm": "2019-06-11T21:42:00.000Z"
+	}`
+	ddp := `{
+		"_id": "m1", "rid": "GENERAL", "msg": "see https://example.com @bob",
+		"ts": {"$date": 1560289227125}, "_updatedAt": {"$date": 1560289260000},
+		"u": {"_id": "u1", "username": "alice", "name": "Alice"},
+		"mentions": [{"_id": "u2", "username": "bob"}],
+		"urls": [{"url": "https://example.com", "meta": {"ogTitle": "Example"}, "headers": {"contentType": "text/html"}}],
+		"attachments": [{"title": "log", "ts": {"$date": 1560289200000}}],
+		"reactions": {":+1:": {"usernames": ["bob"]}},
+		"editedAt": {"$date": 1560289260000}, "editedBy": {"_id": "u1", "username": "alice"},
+		"tmid": "p1", "tlm": {"$date": 1560289320000}
+	}`
+
+	var fromREST Message
+	if err := json.Unmarshal([]byte(rest), &fromREST); err != nil {
+		t.Fatal(err)
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal([]byte(ddp), &raw); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := decodeRoomMessages([]interface{}{raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("decoded %d messages", len(msgs))
+	}
+	fromDDP := msgs[0]
+
+	for _, m := range []Message{fromREST, fromDDP} {
+		if m.Text != "see https://example.com @bob" || m.User.Name != "Alice" {
+			t.Errorf("message = %+v", m)
+		}
+		if m.Timestamp.Unix() != 1560289227 || m.Timestamp.Nanosecond() != 125000000 {
+			t.Errorf("ts = %v", m.Timestamp.Time)
+		}
+		if !m.EditedAt.Equal(m.UpdatedAt.Time) || m.EditedBy == nil || m.EditedBy.Username != "alice" {
+			t.Errorf("edited = %v by %+v", m.EditedAt.Time, m.EditedBy)
+		}
+		if len(m.Mentions) != 1 || m.Mentions[0].Username != "bob" {
+			t.Errorf("mentions = %+v", m.Mentions)
+		}
+		if len(m.URLs) != 1 || m.URLs[0].Meta["ogTitle"] != "Example" {
+			t.Errorf("urls = %+v", m.URLs)
+		}
+		if len(m.Attachments) != 1 || m.Attachments[0].Timestamp == nil || m.Attachments[0].Timestamp.Minute() != 40 {
+			t.Errorf("attachments = %+v", m.Attachments)
+		}
+		if m.Reactions[":+1:"].Usernames[0] != "bob" {
+			t.Errorf("reactions = %+v", m.Reactions)
+		}
+		if m.ThreadID != "p1" || m.ThreadLastMessage.Minute() != 42 {
+			t.Errorf("thread = %q at %v", m.ThreadID, m.ThreadLastMessage.Time)
+		}
+		if !m.PinnedAt.IsZero() || m.Pinned {
+			t.Errorf("pinned = %v", m.PinnedAt.Time)
+		}
+	}
+}
+
+func TestRoomLastMessage(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("fixtures", "json", "room.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r ListRoom
+	if err := json.Unmarshal(b, &r); err != nil {
+		t.Fatal(err)
+	}
+	if r.UpdatedAt.IsZero() || r.LastMessage.Timestamp.IsZero() || r.LastMessage.Text != "hello" {
+		t.Errorf("room = %+v", r)
+	}
+}
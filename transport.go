@@ -0,0 +1,214 @@
+package rc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/blushft/rc/internal/ddp"
+)
+
+// ErrTransportOptions is returned by Connect when TLSConfig or Proxy is
+// combined with a Transport or HTTPClient whose RoundTripper is not an
+// *http.Transport, which the options cannot be applied to.
+var ErrTransportOptions = errors.New("rc: TLSConfig and Proxy need an *http.Transport")
+
+// contextDialer is implemented by round trippers that also know how to
+// reach the server for the websocket, such as a replaying recorder.
+type contextDialer interface {
+	DialContext(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// FrameRecorder receives every DDP frame sent or received by Client.
+type FrameRecorder interface {
+	RecordFrame(outgoing bool, frame []byte)
+}
+
+// RecordFrames passes every realtime frame to r, for example to capture
+// test fixtures.
+func RecordFrames(r FrameRecorder) ClientOption {
+	return func(c *Client) {
+		c.frames = r
+	}
+}
+
+// transport holds the http settings shared by the REST client and the
+// DDP websocket dialer.
+type transport struct {
+	client    *http.Client
+	rt        http.RoundTripper
+	tlsConfig *tls.Config
+	proxy     func(*http.Request) (*url.URL, error)
+	timeout   time.Duration
+	headers   map[string]string
+}
+
+// HTTPClient sets the http.Client used for REST calls. Its transport
+// settings are also used to dial the realtime websocket when it is an
+// *http.Transport. TLSConfig and Proxy need such a transport; see
+// ErrTransportOptions.
+func HTTPClient(hc *http.Client) ClientOption {
+	return func(c *Client) {
+		c.tr.client = hc
+	}
+}
+
+// Transport sets the http.RoundTripper used for REST calls. TLSConfig and
+// Proxy can only be applied to an *http.Transport; see
+// ErrTransportOptions.
+func Transport(rt http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.tr.rt = rt
+	}
+}
+
+// TLSConfig sets the tls configuration used for https and wss connections,
+// for example to trust a private CA or present a client certificate.
+func TLSConfig(cfg *tls.Config) ClientOption {
+	return func(c *Client) {
+		c.tr.tlsConfig = cfg
+	}
+}
+
+// Proxy sends REST and websocket traffic through the http proxy at u.
+// Without it, the proxy is taken from the environment.
+func Proxy(u *url.URL) ClientOption {
+	return func(c *Client) {
+		c.tr.proxy = http.ProxyURL(u)
+	}
+}
+
+// Timeout bounds each REST request and the websocket handshake.
+func Timeout(d time.Duration) ClientOption {
+	return func(c *Client) {
+		c.tr.timeout = d
+	}
+}
+
+// Headers adds headers to every REST request and the websocket handshake.
+func Headers(h map[string]string) ClientOption {
+	return func(c *Client) {
+		if c.tr.headers == nil {
+			c.tr.headers = make(map[string]string)
+		}
+		for k, v := range h {
+			c.tr.headers[k] = v
+		}
+	}
+}
+
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// httpClient builds the http.Client for the REST client. It returns
+// ErrTransportOptions along with a client that ignores TLSConfig and Proxy
+// when they cannot be applied.
+func (t *transport) httpClient() (*http.Client, error) {
+	hc := &http.Client{}
+	if t.client != nil {
+		cp := *t.client
+		hc = &cp
+	}
+
+	if t.rt != nil {
+		hc.Transport = t.rt
+	}
+
+	if t.timeout > 0 {
+		hc.Timeout = t.timeout
+	}
+
+	if t.tlsConfig != nil || t.proxy != nil {
+		tr, ok := hc.Transport.(*http.Transport)
+		switch {
+		case ok:
+			tr = cloneTransport(tr)
+		case hc.Transport == nil:
+			tr = newTransport()
+		default:
+			return hc, ErrTransportOptions
+		}
+		if t.tlsConfig != nil {
+			tr.TLSClientConfig = t.tlsConfig
+		}
+		if t.proxy != nil {
+			tr.Proxy = t.proxy
+		}
+		hc.Transport = tr
+	}
+
+	return hc, nil
+}
+
+// dialer builds the websocket dialer from the same settings as the REST
+// client so both connections take the same route.
+func (t *transport) dialer() *ddp.Dialer {
+	d := &ddp.Dialer{
+		TLSConfig:        t.tlsConfig,
+		Proxy:            t.proxy,
+		HandshakeTimeout: t.timeout,
+		Header:           http.Header{},
+	}
+
+	rt := t.rt
+	if rt == nil && t.client != nil {
+		rt = t.client.Transport
+	}
+	if tr, ok := rt.(*http.Transport); ok {
+		if d.TLSConfig == nil {
+			d.TLSConfig = tr.TLSClientConfig
+		}
+		if d.Proxy == nil {
+			d.Proxy = tr.Proxy
+		}
+		d.DialContext = tr.DialContext
+	}
+	if cd, ok := rt.(contextDialer); ok {
+		d.DialContext = cd.DialContext
+	}
+	if d.Proxy == nil && rt == nil {
+		d.Proxy = http.ProxyFromEnvironment
+	}
+
+	for k, v := range t.headers {
+		d.Header.Set(k, v)
+	}
+
+	return d
+}
+
+// cloneTransport copies the fields of tr that the client relies on so
+// options never modify a transport owned by the caller.
+func cloneTransport(tr *http.Transport) *http.Transport {
+	return &http.Transport{
+		Proxy:                  tr.Proxy,
+		DialContext:            tr.DialContext,
+		TLSClientConfig:        tr.TLSClientConfig,
+		TLSHandshakeTimeout:    tr.TLSHandshakeTimeout,
+		DisableKeepAlives:      tr.DisableKeepAlives,
+		DisableCompression:     tr.DisableCompression,
+		MaxIdleConns:           tr.MaxIdleConns,
+		MaxIdleConnsPerHost:    tr.MaxIdleConnsPerHost,
+		MaxConnsPerHost:        tr.MaxConnsPerHost,
+		IdleConnTimeout:        tr.IdleConnTimeout,
+		ResponseHeaderTimeout:  tr.ResponseHeaderTimeout,
+		ExpectContinueTimeout:  tr.ExpectContinueTimeout,
+		ProxyConnectHeader:     tr.ProxyConnectHeader,
+		MaxResponseHeaderBytes: tr.MaxResponseHeaderBytes,
+	}
+}
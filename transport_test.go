@@ -0,0 +1,65 @@
+package rc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTransportOptions(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Ingress-Key") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"channels":[],"success":true}`))
+	}))
+	defer srv.Close()
+
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+	tlsCfg := &tls.Config{RootCAs: pool}
+
+	client := New(
+		ServerURL(srv.URL),
+		TLSConfig(tlsCfg),
+		Headers(map[string]string{"X-Ingress-Key": "secret"}),
+	)
+	if _, err := client.GetChannelList(); err != nil {
+		t.Fatalf("GetChannelList() error = %v", err)
+	}
+
+	d := client.tr.dialer()
+	if d.TLSConfig != tlsCfg {
+		t.Errorf("dialer TLSConfig not shared with REST client")
+	}
+	if d.Header.Get("X-Ingress-Key") != "secret" {
+		t.Errorf("dialer headers = %v, want X-Ingress-Key", d.Header)
+	}
+
+	untrusted := New(ServerURL(srv.URL))
+	if _, err := untrusted.GetChannelList(); err == nil {
+		t.Errorf("GetChannelList() without CA succeeded, want tls error")
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestTransportOptionsConflict(t *testing.T) {
+	rt := roundTripFunc(http.DefaultTransport.RoundTrip)
+
+	client := New(Transport(rt), TLSConfig(&tls.Config{}))
+	if err := client.Connect(); err != ErrTransportOptions {
+		t.Errorf("Connect() error = %v, want ErrTransportOptions", err)
+	}
+
+	// An *http.Transport takes the options.
+	client = New(Transport(&http.Transport{}), TLSConfig(&tls.Config{}), AccessToken("bot", "token"))
+	if err := client.Connect(); err != nil {
+		t.Errorf("Connect() error = %v", err)
+	}
+}
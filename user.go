@@ -1,6 +1,8 @@
 package rc
 
 import (
+	"context"
+	"net/http"
 	"net/url"
 	"time"
 )
@@ -71,8 +73,10 @@ type prefEnv struct {
 }
 
 type UserList struct {
-	Users  []User `json:"users"`
-	Status string `json:"status"`
+	Users []User `json:"users"`
+	Pagination
+	Status  string `json:"status"`
+	Success bool   `json:"success"`
 }
 
 type UserEnv struct {
@@ -96,18 +100,35 @@ type UserPresence struct {
 	Success bool   `json:"success"`
 }
 
+// GetMe returns the logged in user.
+func (c *Client) GetMe() (*Me, error) {
+	return c.GetMeContext(context.Background())
+}
+
+func (c *Client) GetMeContext(ctx context.Context) (*Me, error) {
+	me := &Me{}
+	if err := c.c.get(ctx, "/me", nil).JSON(me); err != nil {
+		return nil, err
+	}
+	return me, nil
+}
+
 func (c *Client) GetUsers() ([]User, error) {
+	return c.GetUsersContext(context.Background())
+}
+
+func (c *Client) GetUsersContext(ctx context.Context) ([]User, error) {
 	users := &UserList{}
-	if err := c.c.get("/users.list", nil).JSON(users); err != nil {
+	if err := c.c.get(ctx, "/users.list", nil).JSON(users); err != nil {
 		return nil, err
 	}
 
 	return users.Users, nil
 }
 
-func (c *Client) getUser(vals url.Values) (*User, error) {
+func (c *Client) getUser(ctx context.Context, vals url.Values) (*User, error) {
 	userW := &UserEnv{}
-	if err := c.c.get("/users.info", vals).JSON(userW); err != nil {
+	if err := c.c.get(ctx, "/users.info", vals).JSON(userW); err != nil {
 		return nil, err
 	}
 
@@ -116,29 +137,54 @@ func (c *Client) getUser(vals url.Values) (*User, error) {
 }
 
 func (c *Client) GetUserByName(username string) (*User, error) {
-	return c.getUser(query("username", username).Q())
+	return c.GetUserByNameContext(context.Background(), username)
+}
+
+func (c *Client) GetUserByNameContext(ctx context.Context, username string) (*User, error) {
+	return c.getUser(ctx, query("username", username).Q())
 }
 
 func (c *Client) GetUserByID(id string) (*User, error) {
-	return c.getUser(query("userId", id).Q())
+	return c.GetUserByIDContext(context.Background(), id)
+}
+
+func (c *Client) GetUserByIDContext(ctx context.Context, id string) (*User, error) {
+	return c.getUser(ctx, query("userId", id).Q())
 }
 
 func (c *Client) GetUsersPresence(from *time.Time) ([]User, error) {
+	return c.GetUsersPresenceContext(context.Background(), from)
+}
+
+func (c *Client) GetUsersPresenceContext(ctx context.Context, from *time.Time) ([]User, error) {
+	users, _, err := c.usersPresence(ctx, from)
+	return users, err
+}
+
+// usersPresence returns the users like GetUsersPresence and the time of
+// the server from the Date header, which is zero if the header is missing.
+func (c *Client) usersPresence(ctx context.Context, from *time.Time) ([]User, time.Time, error) {
 	userP := &UserPresence{}
 	vals := url.Values{}
 	if from != nil {
-		vals = query("from", from.Format(TimeFormat)).Q()
+		vals = query("from", from.UTC().Format(TimeFormat)).Q()
 	}
 
-	if err := c.c.get("/users.presence", vals).JSON(userP); err != nil {
-		return nil, err
+	res := c.c.get(ctx, "/users.presence", vals)
+	if err := res.JSON(userP); err != nil {
+		return nil, time.Time{}, err
 	}
-	return userP.Users, nil
+	date, _ := http.ParseTime(res.Header().Get("Date"))
+	return userP.Users, date, nil
 }
 
 func (c *Client) GetMyPreferences() (*Preferences, error) {
+	return c.GetMyPreferencesContext(context.Background())
+}
+
+func (c *Client) GetMyPreferencesContext(ctx context.Context) (*Preferences, error) {
 	userP := &prefEnv{}
-	if err := c.c.get("/users/getPreferences", nil).JSON(userP); err != nil {
+	if err := c.c.get(ctx, "/users/getPreferences", nil).JSON(userP); err != nil {
 		return nil, err
 	}
 	p := userP.Preferences